@@ -0,0 +1,233 @@
+// Package archivefs builds in-memory file systems from template archives, so
+// a template version can be previewed without extracting it to disk.
+package archivefs
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"strings"
+
+	"github.com/coder/preview/internal/memfs"
+)
+
+var (
+	// ErrLimitExceeded is returned when an archive is larger than its limits
+	// allow.
+	ErrLimitExceeded = errors.New("archive exceeds limits")
+	// ErrLink is returned for an archive with symbolic or hard links, which
+	// could point outside of the archive.
+	ErrLink = errors.New("links are not supported")
+)
+
+// Limits bound the contents of an archive. Zero values use the defaults.
+type Limits struct {
+	// MaxBytes is the maximum total size of the files, after decompression.
+	MaxBytes int64
+	// MaxFiles is the maximum number of files and directories.
+	MaxFiles int
+}
+
+func (l Limits) withDefaults() Limits {
+	if l.MaxBytes <= 0 {
+		l.MaxBytes = DefaultLimits.MaxBytes
+	}
+	if l.MaxFiles <= 0 {
+		l.MaxFiles = DefaultLimits.MaxFiles
+	}
+	return l
+}
+
+// DefaultLimits are generous for a Terraform template, which is mostly text.
+var DefaultLimits = Limits{
+	MaxBytes: 64 << 20, // 64 MiB
+	MaxFiles: 10_000,
+}
+
+// Read detects whether the stream is a zip, tar or gzipped tar archive, and
+// returns its contents.
+func Read(r io.Reader, limits Limits) (fs.FS, error) {
+	limits = limits.withDefaults()
+	br := bufio.NewReader(r)
+	magic, _ := br.Peek(4)
+
+	switch {
+	case bytes.HasPrefix(magic, []byte("PK\x03\x04")), bytes.HasPrefix(magic, []byte("PK\x05\x06")):
+		// Zip archives keep their index at the end, so the stream has to be
+		// buffered. The compressed size is bounded by the uncompressed size
+		// limit, plus some room for headers.
+		data, err := io.ReadAll(io.LimitReader(br, limits.MaxBytes+1<<20))
+		if err != nil {
+			return nil, fmt.Errorf("read zip: %w", err)
+		}
+		if int64(len(data)) > limits.MaxBytes+1<<20 {
+			return nil, fmt.Errorf("%w: more than %d bytes", ErrLimitExceeded, limits.MaxBytes)
+		}
+		return FromZip(bytes.NewReader(data), int64(len(data)), limits)
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, fmt.Errorf("read gzip: %w", err)
+		}
+		defer gz.Close()
+		return FromTar(gz, limits)
+	default:
+		return FromTar(br, limits)
+	}
+}
+
+// FromTar returns the contents of a tar archive. Links are rejected, and
+// other special files are skipped.
+func FromTar(r io.Reader, limits Limits) (fs.FS, error) {
+	b := newBuilder(limits)
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read tar: %w", err)
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			err = b.addDir(hdr.Name, hdr.FileInfo())
+		case tar.TypeReg:
+			err = b.addFile(hdr.Name, hdr.FileInfo(), tr)
+		case tar.TypeSymlink, tar.TypeLink:
+			err = fmt.Errorf("%w: %q in archive", ErrLink, hdr.Name)
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return b.files, nil
+}
+
+// FromZip returns the contents of a zip archive. Links are rejected, and
+// other special files are skipped.
+func FromZip(r io.ReaderAt, size int64, limits Limits) (fs.FS, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("read zip: %w", err)
+	}
+
+	b := newBuilder(limits)
+	for _, f := range zr.File {
+		info := f.FileInfo()
+		switch {
+		case info.IsDir():
+			err = b.addDir(f.Name, info)
+		case info.Mode().IsRegular():
+			err = b.addZipFile(f)
+		case info.Mode()&fs.ModeSymlink != 0:
+			err = fmt.Errorf("%w: %q in archive", ErrLink, f.Name)
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return b.files, nil
+}
+
+type builder struct {
+	limits Limits
+	files  memfs.FS
+	size   int64
+}
+
+func newBuilder(limits Limits) *builder {
+	return &builder{
+		limits: limits.withDefaults(),
+		files:  make(memfs.FS),
+	}
+}
+
+func (b *builder) addZipFile(f *zip.File) error {
+	rc, err := f.Open()
+	if err != nil {
+		return fmt.Errorf("open %q: %w", f.Name, err)
+	}
+	defer rc.Close()
+	return b.addFile(f.Name, f.FileInfo(), rc)
+}
+
+func (b *builder) addDir(name string, info fs.FileInfo) error {
+	name, err := cleanPath(name)
+	if err != nil || name == "." {
+		return err
+	}
+	if err := b.count(); err != nil {
+		return err
+	}
+
+	b.files[name] = &memfs.File{
+		Mode:    fs.ModeDir | info.Mode().Perm(),
+		ModTime: info.ModTime(),
+	}
+	return nil
+}
+
+func (b *builder) addFile(name string, info fs.FileInfo, r io.Reader) error {
+	clean, err := cleanPath(name)
+	if err != nil {
+		return err
+	}
+	if clean == "." {
+		return fmt.Errorf("invalid path %q in archive", name)
+	}
+	name = clean
+	if err := b.count(); err != nil {
+		return err
+	}
+
+	// The size in the header cannot be trusted, so the read is limited to
+	// the remaining budget.
+	remaining := b.limits.MaxBytes - b.size
+	data, err := io.ReadAll(io.LimitReader(r, remaining+1))
+	if err != nil {
+		return fmt.Errorf("read %q: %w", name, err)
+	}
+	if int64(len(data)) > remaining {
+		return fmt.Errorf("%w: more than %d bytes", ErrLimitExceeded, b.limits.MaxBytes)
+	}
+	b.size += int64(len(data))
+
+	b.files[name] = &memfs.File{
+		Data:    data,
+		Mode:    info.Mode().Perm(),
+		ModTime: info.ModTime(),
+	}
+	return nil
+}
+
+func (b *builder) count() error {
+	if len(b.files) >= b.limits.MaxFiles {
+		return fmt.Errorf("%w: more than %d files", ErrLimitExceeded, b.limits.MaxFiles)
+	}
+	return nil
+}
+
+// cleanPath returns the name as a valid fs.FS path. Absolute paths and paths
+// that escape the archive root are rejected.
+func cleanPath(name string) (string, error) {
+	clean := strings.TrimSuffix(strings.TrimPrefix(name, "./"), "/")
+	if clean == "" || clean == "." {
+		return ".", nil
+	}
+	if strings.Contains(clean, `\`) || !fs.ValidPath(clean) {
+		return "", fmt.Errorf("invalid path %q in archive", name)
+	}
+	return clean, nil
+}
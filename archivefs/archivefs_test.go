@@ -0,0 +1,255 @@
+package archivefs_test
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/fs"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/coder/preview/archivefs"
+)
+
+// entry is a file, directory or link of a test archive.
+type entry struct {
+	name string
+	data string
+	// size, if set, is the number of zero bytes the file holds instead of
+	// data.
+	size int64
+	dir  bool
+	link string
+	// hard makes the link a hard link, in tar archives.
+	hard bool
+}
+
+func tarArchive(t *testing.T, entries ...entry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, e := range entries {
+		hdr := &tar.Header{Name: e.name, Mode: 0o644, Typeflag: tar.TypeReg}
+		var r io.Reader = strings.NewReader(e.data)
+		hdr.Size = int64(len(e.data))
+		switch {
+		case e.dir:
+			hdr.Typeflag, hdr.Mode, hdr.Size = tar.TypeDir, 0o755, 0
+		case e.link != "" && e.hard:
+			hdr.Typeflag, hdr.Linkname, hdr.Size = tar.TypeLink, e.link, 0
+		case e.link != "":
+			hdr.Typeflag, hdr.Linkname, hdr.Size = tar.TypeSymlink, e.link, 0
+		case e.size > 0:
+			hdr.Size = e.size
+			r = io.LimitReader(zeros{}, e.size)
+		}
+		require.NoError(t, tw.WriteHeader(hdr))
+		_, err := io.Copy(tw, r)
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	return buf.Bytes()
+}
+
+func zipArchive(t *testing.T, entries ...entry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, e := range entries {
+		hdr := &zip.FileHeader{Name: e.name, Method: zip.Deflate}
+		var r io.Reader = strings.NewReader(e.data)
+		switch {
+		case e.dir:
+			hdr.Name = strings.TrimSuffix(e.name, "/") + "/"
+			hdr.SetMode(fs.ModeDir | 0o755)
+		case e.link != "":
+			hdr.SetMode(fs.ModeSymlink | 0o777)
+			r = strings.NewReader(e.link)
+		case e.size > 0:
+			hdr.SetMode(0o644)
+			r = io.LimitReader(zeros{}, e.size)
+		default:
+			hdr.SetMode(0o644)
+		}
+		w, err := zw.CreateHeader(hdr)
+		require.NoError(t, err)
+		_, err = io.Copy(w, r)
+		require.NoError(t, err)
+	}
+	require.NoError(t, zw.Close())
+	return buf.Bytes()
+}
+
+func gzipped(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	_, err := gw.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, gw.Close())
+	return buf.Bytes()
+}
+
+type zeros struct{}
+
+func (zeros) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
+
+func TestRead(t *testing.T) {
+	t.Parallel()
+
+	entries := []entry{
+		{name: "./", dir: true},
+		{name: "main.tf", data: `locals { a = 1 }`},
+		{name: "modules/", dir: true},
+		{name: "./modules/child/main.tf", data: `locals { b = 2 }`},
+	}
+	for _, tc := range []struct {
+		name string
+		data []byte
+	}{
+		{name: "Tar", data: tarArchive(t, entries...)},
+		{name: "TarGzip", data: gzipped(t, tarArchive(t, entries...))},
+		{name: "Zip", data: zipArchive(t, entries...)},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			dir, err := archivefs.Read(bytes.NewReader(tc.data), archivefs.Limits{})
+			require.NoError(t, err)
+			require.NoError(t, fstest.TestFS(dir, "main.tf", "modules/child/main.tf"))
+
+			data, err := fs.ReadFile(dir, "modules/child/main.tf")
+			require.NoError(t, err)
+			assert.Equal(t, `locals { b = 2 }`, string(data))
+		})
+	}
+}
+
+func TestReadInvalid(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		name  string
+		entry entry
+		// noZip is set if the entry cannot be written to a zip archive.
+		noZip bool
+		err   error
+	}{
+		{name: "Parent", entry: entry{name: "../main.tf", data: "x"}},
+		{name: "NestedParent", entry: entry{name: "modules/../../main.tf", data: "x"}},
+		{name: "ParentDir", entry: entry{name: "../modules/", dir: true}},
+		{name: "Absolute", entry: entry{name: "/etc/main.tf", data: "x"}},
+		{name: "AbsoluteDir", entry: entry{name: "/etc/", dir: true}},
+		{name: "Backslash", entry: entry{name: `modules\main.tf`, data: "x"}},
+		{name: "BackslashParent", entry: entry{name: `..\main.tf`, data: "x"}},
+		{name: "Symlink", entry: entry{name: "main.tf", link: "/etc/passwd"}, err: archivefs.ErrLink},
+		{name: "RelativeSymlink", entry: entry{name: "main.tf", link: "other.tf"}, err: archivefs.ErrLink},
+		{name: "HardLink", entry: entry{name: "main.tf", link: "../../etc/passwd", hard: true}, noZip: true, err: archivefs.ErrLink},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			entries := []entry{{name: "ok.tf", data: "x"}, tc.entry}
+			archives := []func() []byte{
+				func() []byte { return tarArchive(t, entries...) },
+				func() []byte { return gzipped(t, tarArchive(t, entries...)) },
+			}
+			if !tc.noZip {
+				archives = append(archives, func() []byte { return zipArchive(t, entries...) })
+			}
+			for _, archive := range archives {
+				_, err := archivefs.Read(bytes.NewReader(archive()), archivefs.Limits{})
+				require.Error(t, err)
+				if tc.err != nil {
+					require.ErrorIs(t, err, tc.err)
+				} else {
+					require.ErrorContains(t, err, "invalid path")
+				}
+			}
+		})
+	}
+}
+
+func TestReadLimits(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		name    string
+		limits  archivefs.Limits
+		entries []entry
+		ok      bool
+	}{
+		{
+			name:    "FilesWithin",
+			limits:  archivefs.Limits{MaxFiles: 3},
+			entries: []entry{{name: "a", dir: true}, {name: "a/b.tf"}, {name: "c.tf"}},
+			ok:      true,
+		},
+		{
+			name:    "Files",
+			limits:  archivefs.Limits{MaxFiles: 3},
+			entries: []entry{{name: "a.tf"}, {name: "b.tf"}, {name: "c.tf"}, {name: "d.tf"}},
+		},
+		{
+			name:    "Directories",
+			limits:  archivefs.Limits{MaxFiles: 2},
+			entries: []entry{{name: "a", dir: true}, {name: "b", dir: true}, {name: "c", dir: true}},
+		},
+		{
+			name:    "BytesWithin",
+			limits:  archivefs.Limits{MaxBytes: 1000},
+			entries: []entry{{name: "a.tf", size: 500}, {name: "b.tf", size: 500}},
+			ok:      true,
+		},
+		{
+			name:    "Bytes",
+			limits:  archivefs.Limits{MaxBytes: 1000},
+			entries: []entry{{name: "a.tf", size: 500}, {name: "b.tf", size: 501}},
+		},
+		{
+			// Zeros compress to a fraction of their size, so the archive is
+			// far smaller than its contents.
+			name:    "Bomb",
+			limits:  archivefs.Limits{MaxBytes: 1 << 20},
+			entries: []entry{{name: "bomb.tf", size: 16 << 20}},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			for name, data := range map[string][]byte{
+				"tar":  tarArchive(t, tc.entries...),
+				"gzip": gzipped(t, tarArchive(t, tc.entries...)),
+				"zip":  zipArchive(t, tc.entries...),
+			} {
+				_, err := archivefs.Read(bytes.NewReader(data), tc.limits)
+				if tc.ok {
+					require.NoError(t, err, name)
+					continue
+				}
+				require.ErrorIs(t, err, archivefs.ErrLimitExceeded, name)
+			}
+		})
+	}
+}
+
+func TestReadGzipBomb(t *testing.T) {
+	t.Parallel()
+
+	limits := archivefs.Limits{MaxBytes: 1 << 20}
+	data := gzipped(t, tarArchive(t, entry{name: "bomb.tf", size: 64 << 20}))
+	// The archive fits the limit, only its contents do not.
+	require.Less(t, int64(len(data)), limits.MaxBytes)
+
+	_, err := archivefs.Read(bytes.NewReader(data), limits)
+	require.ErrorIs(t, err, archivefs.ErrLimitExceeded)
+}
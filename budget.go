@@ -0,0 +1,164 @@
+package preview
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aquasecurity/trivy/pkg/iac/scanners/terraform/parser"
+	"github.com/aquasecurity/trivy/pkg/iac/terraform"
+	tfcontext "github.com/aquasecurity/trivy/pkg/iac/terraform/context"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// Budget bounds the work of a single preview, so that a pathological
+// template cannot run unchecked. Zero fields are unlimited.
+type Budget struct {
+	// MaxIterations bounds the number of evaluation iterations, counted
+	// over the root module and every submodule.
+	MaxIterations int
+	// MaxBlocks bounds the number of blocks of a module, after count and
+	// for_each are expanded.
+	MaxBlocks int
+	// MaxOutputBytes bounds the size of the module outputs. Strings count
+	// their length, and every other value 8 bytes.
+	MaxOutputBytes int
+}
+
+// abortEvaluation is the panic value the budget hook uses to stop the
+// evaluation, which cannot be interrupted otherwise.
+type abortEvaluation struct {
+	diags hcl.Diagnostics
+}
+
+// budgetEvalHook stops the evaluation once the context is done or the
+// budget is exceeded. It is called once per iteration of each module.
+func budgetEvalHook(ctx context.Context, budget Budget) func(ctx *tfcontext.Context, blocks terraform.Blocks, inputVars map[string]cty.Value) {
+	var iterations int
+	return func(_ *tfcontext.Context, blocks terraform.Blocks, _ map[string]cty.Value) {
+		if diags := canceled(ctx, "an evaluation iteration"); diags != nil {
+			panic(abortEvaluation{diags: diags})
+		}
+
+		iterations++
+		if budget.MaxIterations > 0 && iterations > budget.MaxIterations {
+			panic(abortEvaluation{diags: hcl.Diagnostics{
+				{
+					Severity: hcl.DiagError,
+					Summary:  "Evaluation iteration budget exceeded",
+					Detail:   fmt.Sprintf("The template needed more than %d evaluation iterations.", budget.MaxIterations),
+				},
+			}})
+		}
+		if budget.MaxBlocks > 0 && len(blocks) > budget.MaxBlocks {
+			panic(abortEvaluation{diags: hcl.Diagnostics{
+				{
+					Severity: hcl.DiagError,
+					Summary:  "Block budget exceeded",
+					Detail: fmt.Sprintf("A module has %d blocks after count and for_each are expanded, more than the limit of %d.",
+						len(blocks), budget.MaxBlocks),
+				},
+			}})
+		}
+	}
+}
+
+// evaluate runs the evaluation in its own goroutine, so that the preview
+// returns as soon as the context is done. The evaluation itself stops at
+// the next iteration, and closes evaluated once it has. A panic of the
+// evaluation is returned as an error, as nothing else can recover it.
+func evaluate(ctx context.Context, p *parser.Parser, evaluated chan<- struct{}) (terraform.Modules, cty.Value, hcl.Diagnostics) {
+	type result struct {
+		modules terraform.Modules
+		outputs cty.Value
+		diags   hcl.Diagnostics
+	}
+	done := make(chan result, 1)
+
+	go func() {
+		if evaluated != nil {
+			defer close(evaluated)
+		}
+		defer func() {
+			if r := recover(); r != nil {
+				if abort, ok := r.(abortEvaluation); ok {
+					done <- result{diags: abort.diags}
+					return
+				}
+				done <- result{diags: hcl.Diagnostics{
+					{
+						Severity: hcl.DiagError,
+						Summary:  "Evaluation panicked",
+						Detail:   fmt.Sprintf("The evaluation of the template failed unexpectedly: %v", r),
+					},
+				}}
+			}
+		}()
+
+		modules, outputs, err := p.EvaluateAll(ctx)
+		if err != nil {
+			done <- result{diags: hcl.Diagnostics{
+				{
+					Severity: hcl.DiagError,
+					Summary:  "Evaluate terraform files",
+					Detail:   err.Error(),
+				},
+			}}
+			return
+		}
+		done <- result{modules: modules, outputs: outputs}
+	}()
+
+	select {
+	case <-ctx.Done():
+		return nil, cty.NilVal, canceled(ctx, "the evaluation started")
+	case r := <-done:
+		return r.modules, r.outputs, r.diags
+	}
+}
+
+// outputBudget returns an error if the module outputs are larger than the
+// budget allows.
+func outputBudget(outputs cty.Value, budget Budget) hcl.Diagnostics {
+	if budget.MaxOutputBytes <= 0 {
+		return nil
+	}
+
+	if err := checkValueSize(outputs, budget.MaxOutputBytes); err == nil {
+		return nil
+	}
+	return hcl.Diagnostics{
+		{
+			Severity: hcl.DiagError,
+			Summary:  "Output budget exceeded",
+			Detail:   fmt.Sprintf("The module outputs are larger than the limit of %d bytes, and are omitted.", budget.MaxOutputBytes),
+		},
+	}
+}
+
+var errTooLarge = errors.New("value too large")
+
+// checkValueSize returns an error if the estimated size of the value is
+// over the limit. It stops walking the value once the limit is reached.
+func checkValueSize(v cty.Value, limit int) error {
+	// Walking a marked collection panics, so the marks are dropped first.
+	v, _ = v.UnmarkDeep()
+
+	var size int
+	err := cty.Walk(v, func(_ cty.Path, v cty.Value) (bool, error) {
+		switch {
+		case v.IsNull() || !v.IsKnown():
+			size += 8
+		case v.Type() == cty.String:
+			size += len(v.AsString())
+		case v.Type().IsPrimitiveType():
+			size += 8
+		}
+		if size > limit {
+			return false, errTooLarge
+		}
+		return true, nil
+	})
+	return err
+}
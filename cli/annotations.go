@@ -0,0 +1,353 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+
+	"github.com/coder/preview"
+	"github.com/coder/preview/lint"
+	"github.com/coder/preview/types"
+)
+
+// annotation is a diagnostic in the form code review tools show inline: the
+// rule it breaks, its severity and the source range it is about.
+type annotation struct {
+	RuleID string
+	// RuleDescription describes the kind of diagnostic the rule stands for.
+	RuleDescription string
+	Severity        types.DiagnosticSeverityString
+	Summary         string
+	Detail          string
+	Range           *hcl.Range
+}
+
+var (
+	quotedPattern = regexp.MustCompile(`"(?:[^"\\]|\\.)*"`)
+	numberPattern = regexp.MustCompile(`\b\d+\b`)
+	nonRuleChars  = regexp.MustCompile(`[^a-z0-9]+`)
+)
+
+// diagnosticAnnotations returns the annotations of preview diagnostics.
+func diagnosticAnnotations(diags hcl.Diagnostics) []annotation {
+	annotations := make([]annotation, 0, len(diags))
+	for _, diag := range diags {
+		annotations = append(annotations, diagnosticAnnotation(diag, nil))
+	}
+	return annotations
+}
+
+// previewAnnotations returns the annotations of the diagnostics of the
+// preview and of its parameters. The output is nil if the preview failed.
+func previewAnnotations(output *preview.Output, diags hcl.Diagnostics) []annotation {
+	annotations := diagnosticAnnotations(diags)
+	if output == nil {
+		return annotations
+	}
+	for _, p := range output.Parameters {
+		// A diagnostic of a parameter without a range, such as for a
+		// missing value, is about the whole parameter block.
+		var fallback *hcl.Range
+		if p.Source != nil {
+			fallback = &p.Source.HCLBlock().DefRange
+		}
+		for _, diag := range p.Diagnostics {
+			annotations = append(annotations, diagnosticAnnotation(diag, fallback))
+		}
+	}
+	return annotations
+}
+
+// diagnosticAnnotation returns the annotation of a preview diagnostic.
+// Diagnostics do not carry a code, so the rule is that of
+// diagnosticCode, such as 'parameter-value-is-not-valid'. The range is
+// the subject or the expression of the diagnostic, or else the fallback.
+func diagnosticAnnotation(diag *hcl.Diagnostic, fallback *hcl.Range) annotation {
+	code := diagnosticCode(diag.Summary)
+	ruleID := strings.Trim(nonRuleChars.ReplaceAllString(strings.ToLower(code), "-"), "-")
+	if ruleID == "" {
+		ruleID = "diagnostic"
+	}
+
+	rng := diag.Subject
+	if rng == nil && diag.Expression != nil {
+		exprRange := diag.Expression.Range()
+		rng = &exprRange
+	}
+	// The expression of a missing value has no file.
+	if rng == nil || rng.Filename == "" {
+		rng = fallback
+	}
+
+	return annotation{
+		RuleID:          ruleID,
+		RuleDescription: code,
+		Severity:        diagnosticSeverity(diag),
+		Summary:         diag.Summary,
+		Detail:          diag.Detail,
+		Range:           rng,
+	}
+}
+
+// diagnosticCode identifies the kind of a diagnostic by its summary, with any
+// quoted values and numbers removed, as those would make every diagnostic
+// unique. It matches the code label of the web server's metrics.
+func diagnosticCode(summary string) string {
+	code := quotedPattern.ReplaceAllString(summary, `"_"`)
+	return numberPattern.ReplaceAllString(code, "N")
+}
+
+// findingAnnotations returns the annotations of lint findings, with the code
+// of the finding as the rule.
+func findingAnnotations(findings lint.Findings, rules []lint.Rule) []annotation {
+	annotations := make([]annotation, 0, len(findings))
+	for _, f := range findings {
+		var description string
+		if idx := slices.IndexFunc(rules, func(r lint.Rule) bool { return r.Code == f.Code }); idx >= 0 {
+			description = rules[idx].Description
+		}
+		annotations = append(annotations, annotation{
+			RuleID:          f.Code,
+			RuleDescription: description,
+			Severity:        types.DiagnosticSeverityString(f.Severity),
+			Summary:         f.Summary,
+			Detail:          f.Detail,
+			Range:           f.Range,
+		})
+	}
+	return annotations
+}
+
+// annotationPaths turns the filenames of diagnostics, which are relative to
+// the template directory, into the paths code review tools expect: relative
+// to the root of the git repository, or else to the working directory.
+// Paths are never absolute, as tools cannot match those to the files of a
+// pull request.
+type annotationPaths struct {
+	// dir is the absolute template directory.
+	dir string
+	// base is the absolute directory paths are relative to.
+	base string
+}
+
+func newAnnotationPaths(dir string) (annotationPaths, error) {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return annotationPaths{}, fmt.Errorf("resolve %q: %w", dir, err)
+	}
+	base := repositoryRoot(absDir)
+	if base == "" {
+		base, err = os.Getwd()
+		if err != nil {
+			return annotationPaths{}, fmt.Errorf("get working directory: %w", err)
+		}
+	}
+	return annotationPaths{dir: absDir, base: base}, nil
+}
+
+// repositoryRoot returns the closest directory to dir with a '.git' entry,
+// or "" if there is none.
+func repositoryRoot(dir string) string {
+	for {
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// path returns the slash separated path of the file of a diagnostic.
+func (p annotationPaths) path(filename string) string {
+	if filename == "" {
+		return ""
+	}
+	abs := filepath.Join(p.dir, filepath.FromSlash(filename))
+	rel, err := filepath.Rel(p.base, abs)
+	if err != nil {
+		// Only possible on Windows, for another volume.
+		return filepath.ToSlash(abs)
+	}
+	return filepath.ToSlash(rel)
+}
+
+// writeAnnotations writes the annotations as SARIF, or as GitHub Actions
+// workflow commands.
+func writeAnnotations(w io.Writer, format, dir string, annotations []annotation) error {
+	paths, err := newAnnotationPaths(dir)
+	if err != nil {
+		return err
+	}
+	if format == outputGitHub {
+		return writeGitHubAnnotations(w, paths, annotations)
+	}
+	return writeSARIF(w, paths, annotations)
+}
+
+// sarifLog is the subset of SARIF 2.1.0 that code scanning tools read.
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	RuleIndex int             `json:"ruleIndex"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations,omitempty"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           *sarifRegion          `json:"region,omitempty"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn"`
+	EndLine     int `json:"endLine"`
+	EndColumn   int `json:"endColumn"`
+}
+
+func writeSARIF(w io.Writer, paths annotationPaths, annotations []annotation) error {
+	run := sarifRun{
+		Tool: sarifTool{Driver: sarifDriver{
+			Name:           "codertf",
+			InformationURI: "https://github.com/coder/preview",
+			Rules:          []sarifRule{},
+		}},
+		Results: make([]sarifResult, 0, len(annotations)),
+	}
+
+	ruleIndex := make(map[string]int)
+	for _, a := range annotations {
+		idx, ok := ruleIndex[a.RuleID]
+		if !ok {
+			idx = len(run.Tool.Driver.Rules)
+			ruleIndex[a.RuleID] = idx
+			run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, sarifRule{
+				ID:               a.RuleID,
+				ShortDescription: sarifMessage{Text: a.RuleDescription},
+			})
+		}
+
+		message := a.Summary
+		if a.Detail != "" {
+			message += "\n\n" + a.Detail
+		}
+		result := sarifResult{
+			RuleID:    a.RuleID,
+			RuleIndex: idx,
+			Level:     string(a.Severity),
+			Message:   sarifMessage{Text: message},
+		}
+		if a.Range != nil && a.Range.Filename != "" {
+			result.Locations = []sarifLocation{{
+				PhysicalLocation: sarifPhysicalLocation{
+					ArtifactLocation: sarifArtifactLocation{URI: paths.path(a.Range.Filename)},
+					Region: &sarifRegion{
+						StartLine:   a.Range.Start.Line,
+						StartColumn: a.Range.Start.Column,
+						EndLine:     a.Range.End.Line,
+						EndColumn:   a.Range.End.Column,
+					},
+				},
+			}}
+		}
+		run.Results = append(run.Results, result)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs:    []sarifRun{run},
+	})
+}
+
+// writeGitHubAnnotations writes an '::error' or '::warning' workflow command
+// for each annotation, which GitHub Actions shows on the lines of the pull
+// request.
+func writeGitHubAnnotations(w io.Writer, paths annotationPaths, annotations []annotation) error {
+	for _, a := range annotations {
+		props := []string{"title=" + escapeGitHubProperty(a.RuleID)}
+		if a.Range != nil && a.Range.Filename != "" {
+			props = append(props,
+				"file="+escapeGitHubProperty(paths.path(a.Range.Filename)),
+				fmt.Sprintf("line=%d", a.Range.Start.Line),
+				fmt.Sprintf("endLine=%d", a.Range.End.Line),
+			)
+			// Columns are only allowed within a single line.
+			if a.Range.Start.Line == a.Range.End.Line {
+				props = append(props,
+					fmt.Sprintf("col=%d", a.Range.Start.Column),
+					fmt.Sprintf("endColumn=%d", a.Range.End.Column),
+				)
+			}
+		}
+
+		message := a.Summary
+		if a.Detail != "" {
+			message += "\n" + a.Detail
+		}
+		if _, err := fmt.Fprintf(w, "::%s %s::%s\n", a.Severity, strings.Join(props, ","), escapeGitHubData(message)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// escapeGitHubData escapes the message of a workflow command.
+func escapeGitHubData(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(s)
+}
+
+// escapeGitHubProperty escapes a property value of a workflow command.
+func escapeGitHubProperty(s string) string {
+	return strings.NewReplacer(":", "%3A", ",", "%2C").Replace(escapeGitHubData(s))
+}
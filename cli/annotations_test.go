@@ -0,0 +1,146 @@
+package cli
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var updateGolden = flag.Bool("update", false, "update the golden files in testdata")
+
+func TestAnnotationsGolden(t *testing.T) {
+	t.Parallel()
+
+	paths := annotationPaths{
+		dir:  filepath.FromSlash("/src/repo/templates/docker"),
+		base: filepath.FromSlash("/src/repo"),
+	}
+	annotations := []annotation{
+		{
+			RuleID:          "missing-description",
+			RuleDescription: "Parameters should have a description.",
+			Severity:        "warning",
+			Summary:         "Parameter \"region\" has no description",
+			Range: &hcl.Range{
+				Filename: "main.tf",
+				Start:    hcl.Pos{Line: 3, Column: 1},
+				End:      hcl.Pos{Line: 3, Column: 32},
+			},
+		},
+		{
+			RuleID:          "parameter-value-is-not-valid",
+			RuleDescription: "Parameter value is not valid",
+			Severity:        "error",
+			Summary:         "Parameter value is not valid",
+			Detail:          "Value must be one of: eu, us.\nGot 100%, apparently: \"ap\".",
+			Range: &hcl.Range{
+				Filename: "modules/region/main.tf",
+				Start:    hcl.Pos{Line: 10, Column: 3},
+				End:      hcl.Pos{Line: 14, Column: 4},
+			},
+		},
+		{
+			RuleID:          "missing-description",
+			RuleDescription: "Parameters should have a description.",
+			Severity:        "warning",
+			Summary:         "Parameter \"size\" has no description",
+			Range: &hcl.Range{
+				Filename: "main.tf",
+				Start:    hcl.Pos{Line: 20, Column: 1},
+				End:      hcl.Pos{Line: 20, Column: 30},
+			},
+		},
+		{
+			RuleID:          "diagnostic",
+			RuleDescription: "",
+			Severity:        "error",
+			Summary:         "Template has no file",
+		},
+	}
+
+	for _, tc := range []struct {
+		name   string
+		golden string
+		write  func(*bytes.Buffer) error
+	}{
+		{
+			name:   "SARIF",
+			golden: "annotations.sarif.golden",
+			write:  func(buf *bytes.Buffer) error { return writeSARIF(buf, paths, annotations) },
+		},
+		{
+			name:   "GitHub",
+			golden: "annotations.github.golden",
+			write:  func(buf *bytes.Buffer) error { return writeGitHubAnnotations(buf, paths, annotations) },
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var buf bytes.Buffer
+			require.NoError(t, tc.write(&buf))
+			assertGolden(t, tc.golden, buf.Bytes())
+		})
+	}
+}
+
+func TestAnnotationPaths(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Repository", func(t *testing.T) {
+		t.Parallel()
+
+		root := t.TempDir()
+		require.NoError(t, os.Mkdir(filepath.Join(root, ".git"), 0o755))
+		dir := filepath.Join(root, "templates", "docker")
+		require.NoError(t, os.MkdirAll(dir, 0o755))
+
+		paths, err := newAnnotationPaths(dir)
+		require.NoError(t, err)
+		assert.Equal(t, "templates/docker/main.tf", paths.path("main.tf"))
+		assert.Equal(t, "templates/docker/modules/a/main.tf", paths.path("modules/a/main.tf"))
+		assert.Empty(t, paths.path(""))
+	})
+
+	t.Run("Relative", func(t *testing.T) {
+		t.Parallel()
+
+		// The tests run in the package directory of this repository.
+		paths, err := newAnnotationPaths("testdata")
+		require.NoError(t, err)
+		assert.Equal(t, "cli/testdata/main.tf", paths.path("main.tf"))
+	})
+
+	t.Run("NoRepository", func(t *testing.T) {
+		t.Parallel()
+
+		dir := t.TempDir()
+		paths, err := newAnnotationPaths(dir)
+		require.NoError(t, err)
+		if paths.base == dir {
+			t.Skip("temporary directory is in a git repository")
+		}
+		path := paths.path("main.tf")
+		assert.False(t, filepath.IsAbs(filepath.FromSlash(path)), path)
+	})
+}
+
+// assertGolden compares the output to the golden file in testdata, or
+// updates the file if the -update flag is set.
+func assertGolden(t *testing.T, name string, actual []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *updateGolden {
+		require.NoError(t, os.MkdirAll("testdata", 0o755))
+		require.NoError(t, os.WriteFile(path, actual, 0o644))
+	}
+	expected, err := os.ReadFile(path)
+	require.NoError(t, err, "run 'go test ./cli -update' to create the golden file")
+	assert.Equal(t, string(expected), string(actual))
+}
@@ -0,0 +1,44 @@
+package clidisplay
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/jedib0t/go-pretty/v6/text"
+)
+
+type ChangeOp string
+
+const (
+	ChangeAdded    ChangeOp = "+"
+	ChangeRemoved  ChangeOp = "-"
+	ChangeModified ChangeOp = "~"
+)
+
+// Change is a line of a list of changes, such as a parameter value that
+// changed since the previous preview.
+type Change struct {
+	Op   ChangeOp
+	Text string
+}
+
+// Changes writes the changes, colored by their operation, or that there are
+// none.
+func Changes(writer io.Writer, changes []Change) {
+	if len(changes) == 0 {
+		_, _ = fmt.Fprintln(writer, "No changes since the previous preview.")
+		return
+	}
+
+	_, _ = fmt.Fprintln(writer, "Changes since the previous preview:")
+	for _, change := range changes {
+		colors := text.Colors{text.FgYellow}
+		switch change.Op {
+		case ChangeAdded:
+			colors = text.Colors{text.FgGreen}
+		case ChangeRemoved:
+			colors = text.Colors{text.FgRed}
+		}
+		_, _ = fmt.Fprintln(writer, colors.Sprintf("  %s %s", change.Op, change.Text))
+	}
+}
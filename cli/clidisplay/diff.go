@@ -0,0 +1,45 @@
+package clidisplay
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/jedib0t/go-pretty/v6/text"
+
+	"github.com/coder/preview"
+)
+
+func TemplateDiff(writer io.Writer, diff *preview.TemplateDiff) {
+	if len(diff.Changes) == 0 {
+		_, _ = fmt.Fprintln(writer, "No changes")
+		return
+	}
+
+	tableWriter := table.NewWriter()
+	tableWriter.SetTitle("Template Changes")
+	tableWriter.SetStyle(table.StyleLight)
+	tableWriter.Style().Options.SeparateColumns = false
+	tableWriter.SetColumnConfigs([]table.ColumnConfig{
+		{Number: 3, WidthMax: 30, WidthMaxEnforcer: text.WrapSoft},
+		{Number: 4, WidthMax: 30, WidthMaxEnforcer: text.WrapSoft},
+		{Number: 5, WidthMax: 50, WidthMaxEnforcer: text.WrapSoft},
+	})
+	tableWriter.AppendHeader(table.Row{"Change", "Subject", "From", "To", "Detail"})
+	var breaking int
+	for _, change := range diff.Changes {
+		subject := change.Parameter
+		if change.Tag != "" {
+			subject = "tag " + change.Tag
+		}
+		kind := string(change.Kind)
+		if change.Breaking {
+			breaking++
+			kind += "\n(breaking)"
+		}
+		tableWriter.AppendRow(table.Row{kind, subject, change.From, change.To, change.Detail})
+		tableWriter.AppendSeparator()
+	}
+	_, _ = fmt.Fprintln(writer, tableWriter.Render())
+	_, _ = fmt.Fprintf(writer, "%d changes, %d breaking\n", len(diff.Changes), breaking)
+}
@@ -0,0 +1,24 @@
+package clidisplay
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/jedib0t/go-pretty/v6/text"
+
+	"github.com/coder/preview/lint"
+)
+
+func LintRules(writer io.Writer, rules []lint.Rule) {
+	tableWriter := table.NewWriter()
+	tableWriter.SetTitle("Lint Rules")
+	tableWriter.SetStyle(table.StyleLight)
+	tableWriter.Style().Options.SeparateColumns = false
+	tableWriter.SetColumnConfigs([]table.ColumnConfig{{Number: 3, WidthMax: 60, WidthMaxEnforcer: text.WrapSoft}})
+	tableWriter.AppendHeader(table.Row{"Code", "Severity", "Description"})
+	for _, rule := range rules {
+		tableWriter.AppendRow(table.Row{rule.Code, rule.Severity, rule.Description})
+	}
+	_, _ = fmt.Fprintln(writer, tableWriter.Render())
+}
@@ -5,12 +5,14 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"maps"
 	"slices"
 	"strings"
 
 	"github.com/hashicorp/hcl/v2"
 	"github.com/jedib0t/go-pretty/v6/table"
 
+	"github.com/coder/preview"
 	"github.com/coder/preview/types"
 	"github.com/coder/terraform-provider-coder/v2/provider"
 )
@@ -22,13 +24,14 @@ func WorkspaceTags(writer io.Writer, tags types.TagBlocks) hcl.Diagnostics {
 	tableWriter.SetTitle("Provisioner Tags")
 	tableWriter.SetStyle(table.StyleLight)
 	tableWriter.Style().Options.SeparateColumns = false
-	row := table.Row{"Key", "Value", "Refs"}
+	row := table.Row{"Key", "Value", "Inputs", "Refs"}
 	tableWriter.AppendHeader(row)
 	for _, tb := range tags {
 		for _, tag := range tb.Tags {
+			inputs := formatTagInputs(tag.Inputs)
 			if tag.Valid() {
 				k, v := tag.AsStrings()
-				tableWriter.AppendRow(table.Row{k, v, ""})
+				tableWriter.AppendRow(table.Row{k, v, inputs, ""})
 				continue
 				//diags = diags.Extend(tDiags)
 				//if !diags.HasErrors() {
@@ -39,7 +42,7 @@ func WorkspaceTags(writer io.Writer, tags types.TagBlocks) hcl.Diagnostics {
 
 			k := tag.KeyString()
 			refs := tag.References()
-			tableWriter.AppendRow(table.Row{k, "??", strings.Join(refs, "\n")})
+			tableWriter.AppendRow(table.Row{k, "??", inputs, strings.Join(refs, "\n")})
 
 			//refs := tb.AllReferences()
 			//refsStr := make([]string, 0, len(refs))
@@ -53,6 +56,49 @@ func WorkspaceTags(writer io.Writer, tags types.TagBlocks) hcl.Diagnostics {
 	return diags
 }
 
+func TagMatrix(writer io.Writer, matrix *preview.TagMatrix) {
+	tableWriter := table.NewWriter()
+	tableWriter.SetTitle("Provisioner Tag Sets")
+	tableWriter.SetStyle(table.StyleLight)
+	tableWriter.Style().Options.SeparateColumns = false
+	tableWriter.AppendHeader(table.Row{"Tags", "Example", "Count"})
+	for _, set := range matrix.Sets {
+		tags := make([]string, 0, len(set.Tags)+len(set.UnusableTags))
+		for _, k := range slices.Sorted(maps.Keys(set.Tags)) {
+			tags = append(tags, fmt.Sprintf("%s=%s", k, set.Tags[k]))
+		}
+		for _, k := range set.UnusableTags {
+			tags = append(tags, fmt.Sprintf("%s=??", k))
+		}
+
+		example := make([]string, 0, len(set.Example))
+		for _, k := range slices.Sorted(maps.Keys(set.Example)) {
+			example = append(example, fmt.Sprintf("%s=%s", k, set.Example[k]))
+		}
+
+		tableWriter.AppendRow(table.Row{strings.Join(tags, "\n"), strings.Join(example, "\n"), set.Count})
+		tableWriter.AppendSeparator()
+	}
+	_, _ = fmt.Fprintln(writer, tableWriter.Render())
+
+	summary := fmt.Sprintf("Previewed %d of %d combinations", matrix.Previewed, matrix.Combinations)
+	if matrix.Sampled {
+		summary += " (sampled)"
+	}
+	if matrix.Invalid > 0 {
+		summary += fmt.Sprintf(", %d returned errors and were excluded", matrix.Invalid)
+	}
+	_, _ = fmt.Fprintln(writer, summary)
+}
+
+func formatTagInputs(inputs types.TagInputs) string {
+	strs := make([]string, 0, len(inputs))
+	for _, in := range inputs {
+		strs = append(strs, in.String())
+	}
+	return strings.Join(strs, "\n")
+}
+
 func Parameters(writer io.Writer, params []types.Parameter, files map[string]*hcl.File) {
 	tableWriter := table.NewWriter()
 	//tableWriter.SetTitle("Parameters")
@@ -126,3 +172,20 @@ func maxLength(s string, max int) string {
 	}
 	return s
 }
+
+// ParameterValues writes the name and value of each parameter, in the order
+// of the parameters.
+func ParameterValues(writer io.Writer, params []types.Parameter) {
+	tableWriter := table.NewWriter()
+	tableWriter.SetStyle(table.StyleLight)
+	tableWriter.Style().Options.SeparateColumns = false
+	tableWriter.AppendHeader(table.Row{"Parameter", "Value"})
+	for _, p := range params {
+		value := "??"
+		if p.Value.Valid() && p.Value.IsKnown() {
+			value = p.Value.AsString()
+		}
+		tableWriter.AppendRow(table.Row{p.Name, value})
+	}
+	_, _ = fmt.Fprintln(writer, tableWriter.Render())
+}
@@ -0,0 +1,86 @@
+package clidisplay
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+// Value writes the value in HCL syntax. Unknown values are written as
+// '(unknown)', and sensitive values as '(sensitive)'.
+func Value(writer io.Writer, val cty.Value) {
+	var str strings.Builder
+	writeValue(&str, val, "")
+	_, _ = fmt.Fprintln(writer, str.String())
+}
+
+func writeValue(str *strings.Builder, val cty.Value, indent string) {
+	switch {
+	case val == cty.NilVal:
+		str.WriteString("(nil)")
+		return
+	case val.IsMarked():
+		if val.HasMark("sensitive") {
+			str.WriteString("(sensitive)")
+			return
+		}
+		val, _ = val.Unmark()
+	}
+
+	typ := val.Type()
+	switch {
+	case !val.IsKnown():
+		if typ == cty.DynamicPseudoType {
+			str.WriteString("(unknown)")
+			return
+		}
+		str.WriteString(fmt.Sprintf("(unknown %s)", typ.FriendlyName()))
+	case val.IsNull():
+		str.WriteString("null")
+	case typ == cty.String:
+		str.WriteString(fmt.Sprintf("%q", val.AsString()))
+	case typ == cty.Number:
+		str.WriteString(val.AsBigFloat().Text('f', -1))
+	case typ == cty.Bool:
+		str.WriteString(fmt.Sprint(val.True()))
+	case typ.IsListType() || typ.IsTupleType() || typ.IsSetType():
+		if val.LengthInt() == 0 {
+			str.WriteString("[]")
+			return
+		}
+		str.WriteString("[\n")
+		for it := val.ElementIterator(); it.Next(); {
+			_, elem := it.Element()
+			str.WriteString(indent + "  ")
+			writeValue(str, elem, indent+"  ")
+			str.WriteString(",\n")
+		}
+		str.WriteString(indent + "]")
+	case typ.IsMapType() || typ.IsObjectType():
+		if val.LengthInt() == 0 {
+			str.WriteString("{}")
+			return
+		}
+		elems := val.AsValueMap()
+		keys := make([]string, 0, len(elems))
+		width := 0
+		for key := range elems {
+			keys = append(keys, key)
+			width = max(width, len(key))
+		}
+		slices.Sort(keys)
+
+		str.WriteString("{\n")
+		for _, key := range keys {
+			str.WriteString(fmt.Sprintf("%s  %-*s = ", indent, width, key))
+			writeValue(str, elems[key], indent+"  ")
+			str.WriteString("\n")
+		}
+		str.WriteString(indent + "}")
+	default:
+		str.WriteString(val.GoString())
+	}
+}
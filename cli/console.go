@@ -0,0 +1,148 @@
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"maps"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+
+	"github.com/coder/preview"
+	"github.com/coder/preview/cli/clidisplay"
+	"github.com/coder/serpent"
+)
+
+const consoleHelp = `Type an HCL expression to evaluate it in the current module, such as
+  data.coder_parameter.region.value
+  local.word_bank
+  module.x
+
+Commands:
+  :module         List the modules.
+  :module <name>  Switch to a module, such as 'module.x', or 'root'.
+  :help           Show this help.
+  :quit           Exit. The end of the input exits as well.`
+
+func (r *RootCmd) Console() *serpent.Command {
+	var (
+		flags  previewFlags
+		module string
+	)
+
+	cmd := &serpent.Command{
+		Use:   "console",
+		Short: "Previews the template and evaluates HCL expressions against it, to debug references.",
+		Long: "Unknown values are shown as '(unknown)'. A reference that cannot be followed " +
+			"names the part of it that failed, and what is available there instead.",
+		Options: append(flags.options(),
+			serpent.Option{
+				Name:        "module",
+				Description: "Module to start in, such as 'module.x'. Defaults to the root module.",
+				Flag:        "module",
+				Default:     "",
+				Value:       serpent.StringOf(&module),
+			},
+		),
+		Handler: func(i *serpent.Invocation) error {
+			input, err := flags.input()
+			if err != nil {
+				return err
+			}
+			output, diags := preview.Preview(i.Context(), input, flags.dirFS())
+			if output == nil {
+				return diags
+			}
+			r.Files = output.Files
+
+			if len(diags) > 0 {
+				_, _ = fmt.Fprintf(i.Stderr, "Parsing Diagnostics:\n")
+				clidisplay.WriteDiagnostics(i.Stderr, output.Files, diags)
+			}
+
+			contexts := preview.ModuleContexts(output.Modules)
+			current, ok := findModule(contexts, module)
+			if !ok {
+				return fmt.Errorf("--module: unknown module %q, the modules are %s", module, moduleNames(contexts))
+			}
+
+			// The expression is added as a file, so that diagnostics show the
+			// part of it they are about.
+			files := maps.Clone(output.Files)
+			if files == nil {
+				files = make(map[string]*hcl.File)
+			}
+
+			scanner := bufio.NewScanner(i.Stdin)
+			for {
+				prompt := "> "
+				if current.Name != "" {
+					prompt = current.Name + "> "
+				}
+				_, _ = fmt.Fprint(i.Stdout, prompt)
+				if !scanner.Scan() {
+					_, _ = fmt.Fprintln(i.Stdout)
+					return scanner.Err()
+				}
+
+				line := strings.TrimSpace(scanner.Text())
+				command, arg, _ := strings.Cut(line, " ")
+				switch command {
+				case "":
+				case ":quit", ":q", "exit":
+					return nil
+				case ":help":
+					_, _ = fmt.Fprintln(i.Stdout, consoleHelp)
+				case ":module":
+					arg = strings.TrimSpace(arg)
+					if arg == "" {
+						_, _ = fmt.Fprintln(i.Stdout, moduleNames(contexts))
+						continue
+					}
+					next, ok := findModule(contexts, arg)
+					if !ok {
+						_, _ = fmt.Fprintf(i.Stdout, "Unknown module %q, the modules are %s\n", arg, moduleNames(contexts))
+						continue
+					}
+					current = next
+				default:
+					val, diags := preview.EvaluateExpression(current.Context, line)
+					files[preview.ExpressionFilename] = &hcl.File{Bytes: []byte(line)}
+					if len(diags) > 0 {
+						clidisplay.WriteDiagnostics(i.Stdout, files, diags)
+					}
+					if !diags.HasErrors() {
+						clidisplay.Value(i.Stdout, val)
+					}
+				}
+			}
+		},
+	}
+	return cmd
+}
+
+// findModule returns the module context with the name. The root module is
+// named 'root', or is the empty name.
+func findModule(contexts []preview.ModuleContext, name string) (preview.ModuleContext, bool) {
+	if name == "root" {
+		name = ""
+	}
+	for _, c := range contexts {
+		if c.Name == name {
+			return c, true
+		}
+	}
+	return preview.ModuleContext{}, false
+}
+
+func moduleNames(contexts []preview.ModuleContext) string {
+	names := make([]string, 0, len(contexts))
+	for _, c := range contexts {
+		name := c.Name
+		if name == "" {
+			name = "root"
+		}
+		names = append(names, name)
+	}
+	return strings.Join(names, ", ")
+}
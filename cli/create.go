@@ -0,0 +1,117 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/hcl/v2"
+
+	"github.com/coder/preview"
+	"github.com/coder/preview/cli/clidisplay"
+	"github.com/coder/serpent"
+)
+
+func (r *RootCmd) Create() *serpent.Command {
+	var (
+		flags       previewFlags
+		format      string
+		interactive bool
+	)
+
+	cmd := &serpent.Command{
+		Use:   "create",
+		Short: "Resolves the parameter values and workspace tags a new workspace would be created with.",
+		Long: "With --interactive, every parameter is asked for in the order of the form, and the template " +
+			"is previewed again after each answer, so dependent parameters appear or change like in the " +
+			"web form. Prompts are written to stderr. Values from --vars and --vars-file are the defaults " +
+			"of their prompts. Exits with 1 if the final preview has errors.",
+		Options: append(flags.options(),
+			serpent.Option{
+				Name:          "interactive",
+				Description:   "Ask for each parameter value.",
+				Flag:          "interactive",
+				FlagShorthand: "i",
+				Default:       "false",
+				Value:         serpent.BoolOf(&interactive),
+			},
+			serpent.Option{
+				Name:          "output",
+				Description:   "Output format of the values and workspace tags.",
+				Flag:          "output",
+				FlagShorthand: "o",
+				Default:       outputTable,
+				Value:         serpent.EnumOf(&format, outputTable, outputJSON, outputYAML),
+			},
+		),
+		Handler: func(i *serpent.Invocation) error {
+			input, err := flags.input()
+			if err != nil {
+				return err
+			}
+
+			var (
+				output *preview.Output
+				diags  hcl.Diagnostics
+			)
+			if interactive {
+				output, diags, err = newPrompter(i.Stdin, i.Stderr).promptParameters(i.Context(), input, flags.dirFS())
+				if err != nil {
+					return err
+				}
+			} else {
+				output, diags = preview.Preview(i.Context(), input, flags.dirFS())
+			}
+			if output == nil {
+				return diags
+			}
+			r.Files = output.Files
+
+			if format != outputTable {
+				if err := writeDocument(i.Stdout, format, newCreateDocument(output)); err != nil {
+					return err
+				}
+			} else {
+				clidisplay.ParameterValues(i.Stdout, output.Parameters)
+				_ = clidisplay.WorkspaceTags(i.Stdout, output.WorkspaceTags)
+			}
+
+			exitDiags := diags
+			for _, p := range output.Parameters {
+				exitDiags = append(exitDiags, hcl.Diagnostics(p.Diagnostics)...)
+			}
+			if len(exitDiags) > 0 {
+				_, _ = fmt.Fprintf(i.Stderr, "Diagnostics:\n")
+				clidisplay.WriteDiagnostics(i.Stderr, output.Files, exitDiags)
+			}
+			if exitDiags.HasErrors() {
+				return &ExitError{Code: ExitErrors}
+			}
+			return nil
+		},
+	}
+	return cmd
+}
+
+// createDocument is the machine readable form of the values a workspace is
+// created with.
+type createDocument struct {
+	// Values are those of the final parameters. Values of parameters that
+	// disappeared while answering are left out.
+	Values        map[string]string `json:"values"`
+	WorkspaceTags documentTags      `json:"workspace_tags"`
+}
+
+func newCreateDocument(output *preview.Output) createDocument {
+	doc := createDocument{
+		Values: make(map[string]string, len(output.Parameters)),
+		WorkspaceTags: documentTags{
+			Tags:     output.WorkspaceTags.Tags(),
+			Unusable: output.WorkspaceTags.UnusableTags().Provenance(),
+		},
+	}
+	for _, p := range output.Parameters {
+		if p.Value.Valid() && p.Value.IsKnown() {
+			doc.Values[p.Name] = p.Value.AsString()
+		}
+	}
+	return doc
+}
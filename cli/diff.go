@@ -0,0 +1,73 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"slices"
+
+	"github.com/coder/preview"
+	"github.com/coder/preview/cli/clidisplay"
+	"github.com/coder/serpent"
+)
+
+func (r *RootCmd) Diff() *serpent.Command {
+	var (
+		flags  previewFlags
+		format string
+	)
+
+	// The directories are the arguments, so '--dir' is left out.
+	options := slices.DeleteFunc(flags.options(), func(opt serpent.Option) bool {
+		return opt.Flag == "dir"
+	})
+
+	cmd := &serpent.Command{
+		Use:   "diff <old-dir> <new-dir>",
+		Short: "Previews two versions of a template with the same inputs, and reports what changes for existing workspaces.",
+		Long: "The inputs stand for an existing workspace, so its parameter values decide whether a change is " +
+			"breaking, such as a removed option that is selected. '--user' is looked up in the new version. " +
+			"Exits with 1 if a change is breaking.",
+		Options: append(options,
+			serpent.Option{
+				Name:          "output",
+				Description:   "Output format.",
+				Flag:          "output",
+				FlagShorthand: "o",
+				Default:       outputTable,
+				Value:         serpent.EnumOf(&format, outputTable, outputJSON, outputYAML),
+			},
+		),
+		Middleware: serpent.RequireNArgs(2),
+		Handler: func(i *serpent.Invocation) error {
+			flags.dir = i.Args[1]
+			input, err := flags.input()
+			if err != nil {
+				return err
+			}
+
+			diff, diags := preview.DiffTemplates(i.Context(), input, os.DirFS(i.Args[0]), os.DirFS(i.Args[1]))
+			if diff == nil {
+				return diags
+			}
+
+			if len(diags) > 0 {
+				_, _ = fmt.Fprintf(i.Stderr, "Preview Diagnostics:\n")
+				clidisplay.WriteDiagnostics(i.Stderr, nil, diags)
+			}
+
+			if format != outputTable {
+				if err := writeDocument(i.Stdout, format, diff); err != nil {
+					return err
+				}
+			} else {
+				clidisplay.TemplateDiff(i.Stdout, diff)
+			}
+
+			if diff.Breaking() {
+				return &ExitError{Code: ExitErrors}
+			}
+			return nil
+		},
+	}
+	return cmd
+}
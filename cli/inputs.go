@@ -0,0 +1,275 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/coder/preview"
+	"github.com/coder/preview/types"
+	"github.com/coder/preview/web"
+	"github.com/coder/serpent"
+)
+
+// previewFlags are the options shared by every command that previews a
+// template directory.
+type previewFlags struct {
+	dir       string
+	vars      []string
+	varsFile  string
+	groups    []string
+	ownerFile string
+	user      string
+	planJSON  string
+}
+
+func (f *previewFlags) options() serpent.OptionSet {
+	return serpent.OptionSet{
+		{
+			Name:          "dir",
+			Description:   "Directory with terraform files.",
+			Flag:          "dir",
+			FlagShorthand: "d",
+			Default:       ".",
+			Value:         serpent.StringOf(&f.dir),
+		},
+		{
+			Name:          "plan",
+			Description:   "Terraform plan file as json.",
+			Flag:          "plan",
+			FlagShorthand: "p",
+			Default:       "",
+			Value:         serpent.StringOf(&f.planJSON),
+		},
+		{
+			Name:          "vars",
+			Description:   "Parameter values as 'name=value'. The value may contain '=' and ','.",
+			Flag:          "vars",
+			FlagShorthand: "v",
+			Default:       "",
+			Value:         (*verbatimArray)(&f.vars),
+		},
+		{
+			Name: "vars-file",
+			Description: "JSON or YAML file with a map of parameter values. Lists are passed as " +
+				"the JSON array a multi-select parameter expects. Values from --vars take precedence.",
+			Flag:    "vars-file",
+			Default: "",
+			Value:   serpent.StringOf(&f.varsFile),
+		},
+		{
+			Name:          "groups",
+			Description:   "Groups.",
+			Flag:          "groups",
+			FlagShorthand: "g",
+			Default:       "",
+			Value:         serpent.StringArrayOf(&f.groups),
+		},
+		{
+			Name:        "owner-file",
+			Description: "JSON or YAML file with the workspace owner. Groups from --groups are added to its groups.",
+			Flag:        "owner-file",
+			Default:     "",
+			Value:       serpent.StringOf(&f.ownerFile),
+		},
+		{
+			Name: "user",
+			Description: "Workspace owner from the users.json file of the template directory, " +
+				"as selected in the web server. Groups from --groups are added to its groups.",
+			Flag:    "user",
+			Default: "",
+			Value:   serpent.StringOf(&f.user),
+		},
+	}
+}
+
+// verbatimArray is a repeatable flag that keeps every value as it is.
+// serpent.StringArray splits values as CSV, which mangles JSON values.
+type verbatimArray []string
+
+func (a *verbatimArray) Set(v string) error {
+	*a = append(*a, v)
+	return nil
+}
+
+func (a *verbatimArray) String() string {
+	return strings.Join(*a, " ")
+}
+
+func (*verbatimArray) Type() string {
+	return "string-array"
+}
+
+func (f *previewFlags) dirFS() fs.FS {
+	return os.DirFS(f.dir)
+}
+
+func (f *previewFlags) input() (preview.Input, error) {
+	rvars := make(map[string]string)
+	if f.varsFile != "" {
+		var values map[string]any
+		if err := decodeFile(f.varsFile, &values); err != nil {
+			return preview.Input{}, fmt.Errorf("--vars-file: %w", err)
+		}
+		for key, value := range values {
+			str, err := parameterValue(value)
+			if err != nil {
+				return preview.Input{}, fmt.Errorf("--vars-file: parameter %q: %w", key, err)
+			}
+			rvars[key] = str
+		}
+	}
+
+	// Values may contain '=', such as base64 strings or JSON, so only the
+	// first one separates the key.
+	var malformed []string
+	for _, val := range f.vars {
+		key, value, ok := strings.Cut(val, "=")
+		if !ok || key == "" {
+			malformed = append(malformed, fmt.Sprintf("%q", val))
+			continue
+		}
+		rvars[key] = value
+	}
+	if len(malformed) > 0 {
+		return preview.Input{}, fmt.Errorf("malformed --vars %s, expected 'name=value'", strings.Join(malformed, ", "))
+	}
+
+	owner, err := f.owner()
+	if err != nil {
+		return preview.Input{}, err
+	}
+
+	return preview.Input{
+		PlanJSONPath:    f.planJSON,
+		ParameterValues: rvars,
+		Owner:           owner,
+	}, nil
+}
+
+// owner returns the workspace owner from --owner-file or --user, with the
+// groups from --groups.
+func (f *previewFlags) owner() (types.WorkspaceOwner, error) {
+	var owner types.WorkspaceOwner
+	switch {
+	case f.ownerFile != "" && f.user != "":
+		return owner, fmt.Errorf("--owner-file and --user cannot be used together")
+	case f.ownerFile != "":
+		if err := decodeFile(f.ownerFile, &owner); err != nil {
+			return owner, fmt.Errorf("--owner-file: %w", err)
+		}
+	case f.user != "":
+		users, err := web.AvailableUsers(f.dirFS())
+		if err != nil {
+			return owner, fmt.Errorf("--user: %w", err)
+		}
+		var ok bool
+		owner, ok = users[f.user]
+		if !ok {
+			names := slices.Sorted(maps.Keys(users))
+			return owner, fmt.Errorf("--user: unknown user %q, %s has %q", f.user, web.UsersFile, names)
+		}
+	}
+
+	owner.Groups = append(owner.Groups, f.groups...)
+	return owner, nil
+}
+
+// decodeFile decodes a JSON or YAML file into v, by the JSON field names of
+// v.
+func decodeFile(path string, v any) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	// JSON is valid YAML, so both are decoded as YAML first, and then
+	// converted to JSON for the field names. YAML decodes numbers as
+	// integers or float64, so they do not keep the form they were written
+	// in: 1e+06 becomes 1000000 and 1.50 becomes 1.5. The JSON is decoded
+	// with json.Number, so that integers too large for a float64 are not
+	// rounded.
+	var doc any
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("decode %s: %w", path, err)
+	}
+	if err := checkKeys(doc, "."); err != nil {
+		return fmt.Errorf("decode %s: %w", path, err)
+	}
+	data, err = json.Marshal(doc)
+	if err != nil {
+		return fmt.Errorf("decode %s: %w", path, err)
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("decode %s: %w", path, err)
+	}
+	return nil
+}
+
+// checkKeys returns an error if a map of the decoded YAML document has a key
+// that is not a string, which JSON cannot represent. The path names the map
+// in the error.
+func checkKeys(doc any, path string) error {
+	switch doc := doc.(type) {
+	case map[string]any:
+		for key, value := range doc {
+			if err := checkKeys(value, strings.TrimSuffix(path, ".")+"."+key); err != nil {
+				return err
+			}
+		}
+	case map[any]any:
+		// Maps are only decoded as map[any]any if a key is not a string.
+		for key := range doc {
+			if _, ok := key.(string); !ok {
+				return fmt.Errorf("%s: key %v is a %T, keys must be strings, such as \"%v\"", path, key, key, key)
+			}
+		}
+	case []any:
+		for idx, item := range doc {
+			if err := checkKeys(item, fmt.Sprintf("%s[%d]", path, idx)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// parameterValue returns the string form of a decoded parameter value. A
+// list becomes the JSON array of strings a multi-select parameter expects.
+func parameterValue(value any) (string, error) {
+	switch value := value.(type) {
+	case []any:
+		items := make([]string, 0, len(value))
+		for _, item := range value {
+			if _, ok := item.([]any); ok {
+				return "", fmt.Errorf("nested lists are not supported")
+			}
+			str, err := parameterValue(item)
+			if err != nil {
+				return "", err
+			}
+			items = append(items, str)
+		}
+		data, err := json.Marshal(items)
+		return string(data), err
+	case map[string]any:
+		return "", fmt.Errorf("maps are not supported")
+	case nil:
+		return "", nil
+	case string:
+		return value, nil
+	case json.Number:
+		return value.String(), nil
+	default:
+		return fmt.Sprint(value), nil
+	}
+}
@@ -0,0 +1,161 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVarsFile(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		name     string
+		file     string
+		content  string
+		expected map[string]string
+		// err is a substring of the expected error, if any.
+		err string
+	}{
+		{
+			name:    "JSON",
+			file:    "vars.json",
+			content: `{"region": "eu", "count": 1000000, "ratio": 0.25, "big": 12345678901234567890, "enabled": true, "empty": null}`,
+			expected: map[string]string{
+				"region":  "eu",
+				"count":   "1000000",
+				"ratio":   "0.25",
+				"big":     "12345678901234567890",
+				"enabled": "true",
+				"empty":   "",
+			},
+		},
+		{
+			name: "YAML",
+			file: "vars.yaml",
+			content: `
+region: eu
+count: 1000000
+negative: -3
+ratio: 0.25
+exponent: 1e+06
+decimal: 1.50
+enabled: false
+quoted: "007"
+`,
+			expected: map[string]string{
+				"region":   "eu",
+				"count":    "1000000",
+				"negative": "-3",
+				"ratio":    "0.25",
+				"exponent": "1000000",
+				"decimal":  "1.5",
+				"enabled":  "false",
+				"quoted":   "007",
+			},
+		},
+		{
+			name:     "JSONList",
+			file:     "vars.json",
+			content:  `{"ides": ["vscode", "jetbrains"], "sizes": [1, 2000000]}`,
+			expected: map[string]string{"ides": `["vscode","jetbrains"]`, "sizes": `["1","2000000"]`},
+		},
+		{
+			name: "YAMLList",
+			file: "vars.yaml",
+			content: `
+ides:
+  - vscode
+  - jetbrains
+sizes: [1, 2000000]
+`,
+			expected: map[string]string{"ides": `["vscode","jetbrains"]`, "sizes": `["1","2000000"]`},
+		},
+		{
+			name:    "NonStringKey",
+			file:    "vars.yaml",
+			content: "1: one\n",
+			err:     `.: key 1 is a int, keys must be strings, such as "1"`,
+		},
+		{
+			name:    "NestedNonStringKey",
+			file:    "vars.yaml",
+			content: "outer:\n  true: yes\n",
+			err:     `.outer: key true is a bool, keys must be strings`,
+		},
+		{
+			name:    "Map",
+			file:    "vars.json",
+			content: `{"region": {"name": "eu"}}`,
+			err:     `parameter "region": maps are not supported`,
+		},
+		{
+			name:    "NestedList",
+			file:    "vars.yaml",
+			content: "ides: [[vscode]]\n",
+			err:     `parameter "ides": nested lists are not supported`,
+		},
+		{
+			name:    "NotAMap",
+			file:    "vars.yaml",
+			content: "- region\n",
+			err:     "decode",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			path := filepath.Join(t.TempDir(), tc.file)
+			require.NoError(t, os.WriteFile(path, []byte(tc.content), 0o600))
+
+			flags := previewFlags{varsFile: path}
+			input, err := flags.input()
+			if tc.err != "" {
+				require.ErrorContains(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, input.ParameterValues)
+		})
+	}
+}
+
+func TestVarsPrecedence(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "vars.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("region: eu\nsize: 10\n"), 0o600))
+
+	flags := previewFlags{
+		varsFile: path,
+		vars:     []string{"region=us", "token=a=b,c"},
+	}
+	input, err := flags.input()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"region": "us", "size": "10", "token": "a=b,c"}, input.ParameterValues)
+
+	flags.vars = []string{"region", "=us"}
+	_, err = flags.input()
+	require.EqualError(t, err, `malformed --vars "region", "=us", expected 'name=value'`)
+}
+
+func TestOwnerFile(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "owner.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+name: alice
+email: alice@example.com
+groups: [admins]
+`), 0o600))
+
+	flags := previewFlags{ownerFile: path, groups: []string{"devs"}}
+	owner, err := flags.owner()
+	require.NoError(t, err)
+	assert.Equal(t, "alice", owner.Name)
+	assert.Equal(t, "alice@example.com", owner.Email)
+	assert.Equal(t, []string{"admins", "devs"}, owner.Groups)
+}
@@ -0,0 +1,172 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+
+	"github.com/coder/preview"
+	"github.com/coder/preview/cli/clidisplay"
+	"github.com/coder/preview/lint"
+	"github.com/coder/preview/types"
+	"github.com/coder/serpent"
+)
+
+func (r *RootCmd) Lint() *serpent.Command {
+	var (
+		flags      previewFlags
+		format     string
+		severities []string
+		iconDir    string
+		listRules  bool
+	)
+
+	cmd := &serpent.Command{
+		Use:   "lint",
+		Short: "Checks the template against best practices, such as parameters without a display name.",
+		Long: "Findings are suppressed with a '# preview-lint-ignore: <code>[, <code>]' comment on the line " +
+			"before or at the end of the line they point to, or with '# preview-lint-ignore-file: <code>' " +
+			"anywhere in the file. The code 'all' suppresses every rule. " +
+			"Exits with 0 without findings, 2 with only warnings, and 1 with errors.",
+		Options: append(flags.options(),
+			serpent.Option{
+				Name: "output",
+				Description: "Output format. 'json' and 'yaml' write the findings and preview diagnostics as a single document. " +
+					"'sarif' writes them as SARIF 2.1.0, and 'github' as GitHub Actions workflow commands, with the " +
+					"rule codes as identifiers. Their file paths are relative to the git repository of --dir, or else to the working directory.",
+				Flag:          "output",
+				FlagShorthand: "o",
+				Default:       outputTable,
+				Value:         serpent.EnumOf(&format, outputTable, outputJSON, outputYAML, outputSARIF, outputGitHub),
+			},
+			serpent.Option{
+				Name:        "severity",
+				Description: "Severity of a rule as '<code>=error|warning|off'. 'off' disables the rule.",
+				Flag:        "severity",
+				Default:     "",
+				Value:       serpent.StringArrayOf(&severities),
+			},
+			serpent.Option{
+				Name: "icon-dir",
+				Description: "Directory that absolute icon paths, such as '/icon/go.svg', are resolved in, " +
+					"like the static directory of a Coder deployment. Absolute icon paths are not checked without it.",
+				Flag:    "icon-dir",
+				Default: "",
+				Value:   serpent.StringOf(&iconDir),
+			},
+			serpent.Option{
+				Name:        "list-rules",
+				Description: "List the rules and their default severity, and exit.",
+				Flag:        "list-rules",
+				Default:     "false",
+				Value:       serpent.BoolOf(&listRules),
+			},
+		),
+		Handler: func(i *serpent.Invocation) error {
+			if listRules {
+				clidisplay.LintRules(i.Stdout, lint.DefaultRules())
+				return nil
+			}
+
+			opts := lint.Options{Severity: make(map[string]lint.Severity)}
+			for _, s := range severities {
+				code, level, ok := strings.Cut(s, "=")
+				if !ok {
+					return fmt.Errorf("invalid --severity %q, expected '<code>=<severity>'", s)
+				}
+				sev, err := lint.ParseSeverity(level)
+				if err != nil {
+					return fmt.Errorf("--severity %q: %w", s, err)
+				}
+				opts.Severity[code] = sev
+			}
+
+			input, err := flags.input()
+			if err != nil {
+				return err
+			}
+			dfs := flags.dirFS()
+			output, diags := preview.Preview(i.Context(), input, dfs)
+			if output == nil {
+				switch format {
+				case outputSARIF, outputGitHub:
+					if err := writeAnnotations(i.Stdout, format, flags.dir, diagnosticAnnotations(diags)); err != nil {
+						return err
+					}
+					return diagnosticsExit(nil, diags)
+				case outputJSON, outputYAML:
+					if err := writeDocument(i.Stdout, format, newLintDocument(nil, diags)); err != nil {
+						return err
+					}
+					return diagnosticsExit(nil, diags)
+				}
+				return diags
+			}
+			r.Files = output.Files
+
+			tmpl := lint.NewTemplate(dfs, output)
+			if iconDir != "" {
+				tmpl.Icons = os.DirFS(iconDir)
+			}
+			findings, err := lint.Lint(tmpl, opts)
+			if err != nil {
+				return err
+			}
+			exitDiags := append(diags, findings.Diagnostics()...)
+
+			switch format {
+			case outputSARIF, outputGitHub:
+				annotations := append(findingAnnotations(findings, lint.DefaultRules()), diagnosticAnnotations(diags)...)
+				if err := writeAnnotations(i.Stdout, format, flags.dir, annotations); err != nil {
+					return err
+				}
+				return diagnosticsExit(nil, exitDiags)
+			case outputJSON, outputYAML:
+				if err := writeDocument(i.Stdout, format, newLintDocument(findings, diags)); err != nil {
+					return err
+				}
+				return diagnosticsExit(nil, exitDiags)
+			}
+
+			if len(diags) > 0 {
+				_, _ = fmt.Fprintf(i.Stderr, "Preview Diagnostics:\n")
+				clidisplay.WriteDiagnostics(i.Stderr, output.Files, diags)
+			}
+			if len(findings) > 0 {
+				clidisplay.WriteDiagnostics(i.Stdout, output.Files, findings.Diagnostics())
+			}
+			_, _ = fmt.Fprintf(i.Stdout, "%d findings\n", len(findings))
+			return diagnosticsExit(nil, exitDiags)
+		},
+	}
+	return cmd
+}
+
+// lintDocument is the machine readable form of the lint results.
+type lintDocument struct {
+	Findings []documentDiag `json:"findings"`
+	// Diagnostics are those of the preview the findings are based on.
+	Diagnostics []documentDiag `json:"diagnostics"`
+}
+
+func newLintDocument(findings lint.Findings, diags hcl.Diagnostics) lintDocument {
+	doc := lintDocument{
+		Findings:    make([]documentDiag, 0, len(findings)),
+		Diagnostics: make([]documentDiag, 0, len(diags)),
+	}
+	for _, f := range findings {
+		doc.Findings = append(doc.Findings, documentDiag{
+			Code:     f.Code,
+			Severity: types.DiagnosticSeverityString(f.Severity),
+			Summary:  f.Summary,
+			Detail:   f.Detail,
+			Subject:  newDocumentRange(f.Range),
+		})
+	}
+	for _, diag := range diags {
+		doc.Diagnostics = append(doc.Diagnostics, newDocumentDiag(diag))
+	}
+	return doc
+}
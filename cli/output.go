@@ -0,0 +1,218 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/zclconf/go-cty/cty"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+	"gopkg.in/yaml.v3"
+
+	"github.com/coder/preview"
+	"github.com/coder/preview/types"
+)
+
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+	outputYAML  = "yaml"
+	// outputSARIF and outputGitHub write only the diagnostics, for code
+	// review tools to show them on the lines they are about.
+	outputSARIF  = "sarif"
+	outputGitHub = "github"
+)
+
+// Exit codes of the commands that preview a template. They let scripts tell
+// a clean preview from one with only warnings.
+const (
+	ExitSuccess  = 0
+	ExitErrors   = 1
+	ExitWarnings = 2
+)
+
+// ExitError is returned by a command that completed and wrote its output,
+// but must exit with a code other than ExitSuccess. The diagnostics are
+// already part of the output.
+type ExitError struct {
+	Code int
+}
+
+func (e *ExitError) Error() string {
+	switch e.Code {
+	case ExitErrors:
+		return "preview has errors"
+	case ExitWarnings:
+		return "preview has warnings"
+	default:
+		return fmt.Sprintf("exit code %d", e.Code)
+	}
+}
+
+// ExitCode returns the code to exit with after the command returned the
+// error. Errors other than ExitError mean the command failed.
+func ExitCode(err error) int {
+	if err == nil {
+		return ExitSuccess
+	}
+	var exit *ExitError
+	if errors.As(err, &exit) {
+		return exit.Code
+	}
+	return ExitErrors
+}
+
+// diagnosticsExit returns the ExitError for the diagnostics of the preview
+// and of its parameters, such as a failed validation, or nil if there are
+// none.
+func diagnosticsExit(output *preview.Output, diags hcl.Diagnostics) error {
+	if output != nil {
+		for _, p := range output.Parameters {
+			diags = append(diags, hcl.Diagnostics(p.Diagnostics)...)
+		}
+	}
+
+	switch {
+	case diags.HasErrors():
+		return &ExitError{Code: ExitErrors}
+	case len(diags) > 0:
+		return &ExitError{Code: ExitWarnings}
+	default:
+		return nil
+	}
+}
+
+// previewDocument is the machine readable form of a preview, written by
+// '--output json' and '--output yaml'.
+type previewDocument struct {
+	Parameters    []types.Parameter `json:"parameters"`
+	WorkspaceTags documentTags      `json:"workspace_tags"`
+	Diagnostics   []documentDiag    `json:"diagnostics"`
+	ModuleOutput  json.RawMessage   `json:"module_output"`
+}
+
+type documentTags struct {
+	Tags     map[string]string     `json:"tags"`
+	Unusable []types.TagProvenance `json:"unusable"`
+}
+
+// documentDiag is a diagnostic with its source ranges, which the friendly
+// diagnostics of the parameters leave out.
+type documentDiag struct {
+	// Code is the rule of a lint finding.
+	Code     string                         `json:"code,omitempty"`
+	Severity types.DiagnosticSeverityString `json:"severity"`
+	Summary  string                         `json:"summary"`
+	Detail   string                         `json:"detail"`
+	Subject  *documentRange                 `json:"subject,omitempty"`
+	Context  *documentRange                 `json:"context,omitempty"`
+}
+
+type documentRange struct {
+	Filename string      `json:"filename"`
+	Start    documentPos `json:"start"`
+	End      documentPos `json:"end"`
+}
+
+type documentPos struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+	Byte   int `json:"byte"`
+}
+
+// newPreviewDocument builds the document. The output is nil if the preview
+// failed before it could produce one.
+func newPreviewDocument(output *preview.Output, diags hcl.Diagnostics) (previewDocument, error) {
+	doc := previewDocument{
+		Parameters:    []types.Parameter{},
+		WorkspaceTags: documentTags{Tags: map[string]string{}, Unusable: []types.TagProvenance{}},
+		Diagnostics:   make([]documentDiag, 0, len(diags)),
+		ModuleOutput:  json.RawMessage("null"),
+	}
+	for _, diag := range diags {
+		doc.Diagnostics = append(doc.Diagnostics, newDocumentDiag(diag))
+	}
+	if output == nil {
+		return doc, nil
+	}
+
+	if output.Parameters != nil {
+		doc.Parameters = output.Parameters
+	}
+	doc.WorkspaceTags = documentTags{
+		Tags:     output.WorkspaceTags.Tags(),
+		Unusable: output.WorkspaceTags.UnusableTags().Provenance(),
+	}
+	if output.ModuleOutput != cty.NilVal && !output.ModuleOutput.IsNull() {
+		data, err := ctyjson.Marshal(output.ModuleOutput, output.ModuleOutput.Type())
+		if err != nil {
+			return doc, fmt.Errorf("encode module output: %w", err)
+		}
+		doc.ModuleOutput = data
+	}
+	return doc, nil
+}
+
+func newDocumentDiag(diag *hcl.Diagnostic) documentDiag {
+	severity := types.DiagnosticSeverityError
+	if diag.Severity == hcl.DiagWarning {
+		severity = types.DiagnosticSeverityWarning
+	}
+	return documentDiag{
+		Severity: severity,
+		Summary:  diag.Summary,
+		Detail:   diag.Detail,
+		Subject:  newDocumentRange(diag.Subject),
+		Context:  newDocumentRange(diag.Context),
+	}
+}
+
+func newDocumentRange(rng *hcl.Range) *documentRange {
+	if rng == nil {
+		return nil
+	}
+	return &documentRange{
+		Filename: rng.Filename,
+		Start:    documentPos{Line: rng.Start.Line, Column: rng.Start.Column, Byte: rng.Start.Byte},
+		End:      documentPos{Line: rng.End.Line, Column: rng.End.Column, Byte: rng.End.Byte},
+	}
+}
+
+// writeDocument writes the value as indented JSON, or as YAML with the same
+// field names.
+func writeDocument(w io.Writer, format string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if format == outputJSON {
+		_, err = fmt.Fprintln(w, string(data))
+		return err
+	}
+
+	// JSON is valid YAML, so decoding it into a node keeps the field order
+	// and the value types. Only the flow style of JSON has to be dropped.
+	var node yaml.Node
+	if err := yaml.Unmarshal(data, &node); err != nil {
+		return err
+	}
+	blockStyle(&node)
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(&node); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// blockStyle resets the style of the node and its children, so that the
+// encoder picks block style and only quotes strings that need it.
+func blockStyle(node *yaml.Node) {
+	node.Style = 0
+	for _, child := range node.Content {
+		blockStyle(child)
+	}
+}
@@ -0,0 +1,212 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+
+	"github.com/coder/preview"
+	"github.com/coder/preview/types"
+)
+
+const outputTemplate = `
+terraform {
+  required_providers {
+    coder = {
+      source = "coder/coder"
+    }
+  }
+}
+
+data "coder_parameter" "size" {
+  name         = "size"
+  display_name = "Size"
+  description  = "Size of the workspace."
+  type         = "number"
+  default      = 1
+  validation {
+    min   = 1
+    max   = 10
+    error = "Size must be between 1 and 10."
+  }
+}
+
+output "size" {
+  value = data.coder_parameter.size.value
+}
+`
+
+func TestExitCode(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, ExitSuccess, ExitCode(nil))
+	assert.Equal(t, ExitWarnings, ExitCode(&ExitError{Code: ExitWarnings}))
+	assert.Equal(t, ExitErrors, ExitCode(&ExitError{Code: ExitErrors}))
+	assert.Equal(t, ExitWarnings, ExitCode(errors.Join(errors.New("wrapped"), &ExitError{Code: ExitWarnings})))
+	assert.Equal(t, ExitErrors, ExitCode(errors.New("failed")))
+	assert.Equal(t, ExitErrors, ExitCode(hcl.Diagnostics{{Severity: hcl.DiagError, Summary: "failed"}}))
+}
+
+func TestDiagnosticsExit(t *testing.T) {
+	t.Parallel()
+
+	warning := &hcl.Diagnostic{Severity: hcl.DiagWarning, Summary: "warning"}
+	failure := &hcl.Diagnostic{Severity: hcl.DiagError, Summary: "error"}
+	withParameterDiags := func(diags ...*hcl.Diagnostic) *preview.Output {
+		return &preview.Output{Parameters: []types.Parameter{{Diagnostics: types.Diagnostics(diags)}}}
+	}
+
+	for _, tc := range []struct {
+		name   string
+		output *preview.Output
+		diags  hcl.Diagnostics
+		code   int
+	}{
+		{name: "None", code: ExitSuccess},
+		{name: "NoParameterDiagnostics", output: withParameterDiags(), code: ExitSuccess},
+		{name: "Warning", diags: hcl.Diagnostics{warning}, code: ExitWarnings},
+		{name: "Error", diags: hcl.Diagnostics{failure}, code: ExitErrors},
+		{name: "ErrorAndWarning", diags: hcl.Diagnostics{warning, failure}, code: ExitErrors},
+		{name: "ParameterWarning", output: withParameterDiags(warning), code: ExitWarnings},
+		{name: "ParameterError", output: withParameterDiags(failure), diags: hcl.Diagnostics{warning}, code: ExitErrors},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := diagnosticsExit(tc.output, tc.diags)
+			assert.Equal(t, tc.code, ExitCode(err))
+			if tc.code == ExitSuccess {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestRootOutput(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "main.tf"), []byte(outputTemplate), 0o600))
+
+	for _, tc := range []struct {
+		name string
+		args []string
+		code int
+	}{
+		{name: "Valid", args: []string{"--vars", "size=5"}, code: ExitSuccess},
+		{name: "Invalid", args: []string{"--vars", "size=50"}, code: ExitErrors},
+		// The plan cannot be read, so there is no output at all.
+		{name: "Failed", args: []string{"--plan", "missing.json"}, code: ExitErrors},
+	} {
+		for _, format := range []string{outputTable, outputJSON, outputYAML, outputSARIF, outputGitHub} {
+			t.Run(tc.name+"/"+format, func(t *testing.T) {
+				t.Parallel()
+
+				var stdout, stderr bytes.Buffer
+				inv := (&RootCmd{}).Root().Invoke(append([]string{"--dir", dir, "--output", format}, tc.args...)...)
+				inv.Stdout, inv.Stderr = &stdout, &stderr
+				err := inv.Run()
+				require.Equal(t, tc.code, ExitCode(err), "error: %v\nstderr: %s", err, stderr.String())
+
+				out := stdout.String()
+				switch format {
+				case outputTable:
+					if tc.name == "Failed" {
+						// The diagnostics are returned, for main to write.
+						var diags hcl.Diagnostics
+						require.ErrorAs(t, err, &diags)
+						return
+					}
+					assert.Contains(t, out, "size")
+				case outputJSON, outputYAML:
+					var doc struct {
+						Parameters  []map[string]any `json:"parameters" yaml:"parameters"`
+						Diagnostics []map[string]any `json:"diagnostics" yaml:"diagnostics"`
+					}
+					if format == outputJSON {
+						require.NoError(t, json.Unmarshal(stdout.Bytes(), &doc), out)
+					} else {
+						require.NoError(t, yaml.Unmarshal(stdout.Bytes(), &doc), out)
+						// YAML is written in block style.
+						assert.False(t, strings.HasPrefix(out, "{"), out)
+					}
+					if tc.name == "Failed" {
+						assert.Empty(t, doc.Parameters)
+						require.Len(t, doc.Diagnostics, 1)
+						return
+					}
+					require.Len(t, doc.Parameters, 1)
+					assert.Equal(t, "size", doc.Parameters[0]["name"])
+					assert.Empty(t, doc.Diagnostics)
+				case outputSARIF:
+					var log sarifLog
+					require.NoError(t, json.Unmarshal(stdout.Bytes(), &log), out)
+					require.Len(t, log.Runs, 1)
+					if tc.code == ExitSuccess {
+						assert.Empty(t, log.Runs[0].Results)
+						return
+					}
+					require.Len(t, log.Runs[0].Results, 1)
+					assert.Equal(t, "error", log.Runs[0].Results[0].Level)
+				case outputGitHub:
+					if tc.code == ExitSuccess {
+						assert.Empty(t, out)
+						return
+					}
+					assert.True(t, strings.HasPrefix(out, "::error "), out)
+					assert.Equal(t, 1, strings.Count(out, "\n"), out)
+				}
+			})
+		}
+	}
+}
+
+func TestRootOutputInvalidFlags(t *testing.T) {
+	t.Parallel()
+
+	// Input errors happen before any output is written.
+	for _, args := range [][]string{
+		{"--vars-file", filepath.Join(t.TempDir(), "missing.yaml")},
+		{"--vars", "size"},
+		{"--output", "xml"},
+		{"--watch", "--output", "json"},
+	} {
+		var stdout, stderr bytes.Buffer
+		inv := (&RootCmd{}).Root().Invoke(append([]string{"--dir", t.TempDir()}, args...)...)
+		inv.Stdout, inv.Stderr = &stdout, &stderr
+		err := inv.Run()
+		require.Error(t, err, args)
+		assert.Equal(t, ExitErrors, ExitCode(err), args)
+		assert.Empty(t, stdout.String(), args)
+	}
+}
+
+func TestLintExitWarnings(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	// The parameter has no display name, a warning.
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "main.tf"), []byte(strings.Replace(outputTemplate, `display_name = "Size"`, "", 1)), 0o600))
+
+	for _, format := range []string{outputTable, outputJSON, outputYAML, outputSARIF, outputGitHub} {
+		t.Run(format, func(t *testing.T) {
+			t.Parallel()
+
+			var stdout, stderr bytes.Buffer
+			inv := (&RootCmd{}).Root().Invoke("lint", "--dir", dir, "--output", format)
+			inv.Stdout, inv.Stderr = &stdout, &stderr
+			err := inv.Run()
+			assert.Equal(t, ExitWarnings, ExitCode(err), "error: %v\nstderr: %s", err, stderr.String())
+			assert.Contains(t, stdout.String(), "missing-display-name")
+		})
+	}
+}
@@ -0,0 +1,286 @@
+package cli
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+
+	"github.com/coder/preview"
+	"github.com/coder/preview/types"
+	"github.com/coder/terraform-provider-coder/v2/provider"
+)
+
+// errPromptClosed is returned when the input ends before every parameter
+// has a value.
+var errPromptClosed = errors.New("input closed before every parameter had a value")
+
+// prompter asks for parameter values one line at a time.
+type prompter struct {
+	in  *bufio.Reader
+	out io.Writer
+}
+
+func newPrompter(in io.Reader, out io.Writer) *prompter {
+	return &prompter{in: bufio.NewReader(in), out: out}
+}
+
+// promptParameters walks the parameters like the dynamic form does. It asks
+// for the first parameter without an answer, in the order of
+// types.SortParameters, and previews the template again with the answer, so
+// that dependent parameters appear or change before they are asked. An
+// answered parameter is asked again if a later answer made its value
+// invalid, such as by removing the selected option.
+//
+// The values of the input are the initial values, shown as the defaults of
+// their prompts. The preview of the final values is returned.
+func (pr *prompter) promptParameters(ctx context.Context, input preview.Input, dir fs.FS) (*preview.Output, hcl.Diagnostics, error) {
+	values := maps.Clone(input.ParameterValues)
+	if values == nil {
+		values = make(map[string]string)
+	}
+	answered := make(map[string]bool)
+
+	for {
+		input.ParameterValues = values
+		output, diags := preview.Preview(ctx, input, dir)
+		if output == nil {
+			return nil, diags, nil
+		}
+
+		// Preview returns the parameters sorted by types.SortParameters.
+		var next *types.Parameter
+		for idx, p := range output.Parameters {
+			if !answered[p.Name] {
+				next = &output.Parameters[idx]
+				break
+			}
+			if _, err := parseAnswer(p, values[p.Name]); err != nil {
+				_, _ = fmt.Fprintf(pr.out, "The value of %q is no longer valid: %s\n", p.Name, err.Error())
+				next = &output.Parameters[idx]
+				break
+			}
+		}
+		if next == nil {
+			return output, diags, nil
+		}
+
+		value, err := pr.promptParameter(*next)
+		if err != nil {
+			return nil, diags, err
+		}
+		values[next.Name] = value
+		answered[next.Name] = true
+	}
+}
+
+// promptParameter asks for the value of the parameter until the answer is
+// valid. An empty answer keeps the current value.
+func (pr *prompter) promptParameter(p types.Parameter) (string, error) {
+	current := ""
+	if p.Value.Valid() && p.Value.IsKnown() {
+		current = p.Value.AsString()
+	}
+
+	title := p.Name
+	if p.DisplayName != "" {
+		title = fmt.Sprintf("%s (%s)", p.DisplayName, p.Name)
+	}
+	if valueRequired(p) {
+		title += " *"
+	}
+	_, _ = fmt.Fprintf(pr.out, "\n%s\n", title)
+	if p.Description != "" {
+		_, _ = fmt.Fprintf(pr.out, "  %s\n", p.Description)
+	}
+
+	question := "Value"
+	switch formType := promptFormType(p); formType {
+	case provider.ParameterFormTypeRadio, provider.ParameterFormTypeDropdown, provider.ParameterFormTypeMultiSelect:
+		selected := selectedOptions(formType, current)
+		for idx, opt := range p.Options {
+			mark := " "
+			if slices.Contains(selected, opt.Value.AsString()) {
+				mark = "*"
+			}
+			_, _ = fmt.Fprintf(pr.out, "  %s %d) %s (%s)\n", mark, idx+1, opt.Name, opt.Value.AsString())
+		}
+		question = "Select an option by number or value"
+		if formType == provider.ParameterFormTypeMultiSelect {
+			question = "Select options by number or value, separated by commas"
+		}
+	case provider.ParameterFormTypeCheckbox, provider.ParameterFormTypeSwitch:
+		question = "Enable (yes/no)"
+	case provider.ParameterFormTypeSlider:
+		question = "Number"
+		if len(p.Validations) > 0 && p.Validations[0].Min != nil && p.Validations[0].Max != nil {
+			question = fmt.Sprintf("Number from %d to %d", *p.Validations[0].Min, *p.Validations[0].Max)
+		}
+	case provider.ParameterFormTypeTagSelect:
+		question = "Values, separated by commas or as a JSON array"
+	}
+
+	for {
+		_, _ = fmt.Fprintf(pr.out, "%s [%s]: ", question, current)
+		line, err := pr.in.ReadString('\n')
+		if err != nil && (!errors.Is(err, io.EOF) || line == "") {
+			_, _ = fmt.Fprintln(pr.out)
+			if errors.Is(err, io.EOF) {
+				return "", errPromptClosed
+			}
+			return "", err
+		}
+
+		answer := strings.TrimSpace(line)
+		if answer == "" {
+			answer = current
+		}
+		value, err := parseAnswer(p, answer)
+		if err == nil {
+			return value, nil
+		}
+		_, _ = fmt.Fprintf(pr.out, "  %s\n", err.Error())
+	}
+}
+
+// promptFormType returns the form type the parameter is asked with. The form
+// type of a parameter with errors, such as a required one without a value, is
+// 'error', so the default form type of its type is used instead.
+func promptFormType(p types.Parameter) provider.ParameterFormType {
+	if p.FormType != provider.ParameterFormTypeDefault && p.FormType != provider.ParameterFormTypeError {
+		return p.FormType
+	}
+	_, formType, err := provider.ValidateFormType(provider.OptionType(p.Type), len(p.Options), provider.ParameterFormTypeDefault)
+	if err != nil {
+		return provider.ParameterFormTypeInput
+	}
+	return formType
+}
+
+// parseAnswer returns the parameter value for the answer, or an error if the
+// parameter does not accept it. Options are selected by their value or
+// their number in the prompt.
+func parseAnswer(p types.Parameter, answer string) (string, error) {
+	if answer == "" {
+		if valueRequired(p) {
+			return "", fmt.Errorf("a value is required")
+		}
+		return "", nil
+	}
+
+	var value string
+	switch formType := promptFormType(p); formType {
+	case provider.ParameterFormTypeRadio, provider.ParameterFormTypeDropdown:
+		opt, err := selectOption(p.Options, answer)
+		if err != nil {
+			return "", err
+		}
+		value = opt
+	case provider.ParameterFormTypeMultiSelect:
+		items, err := listAnswer(answer)
+		if err != nil {
+			return "", err
+		}
+		selected := make([]string, 0, len(items))
+		for _, item := range items {
+			opt, err := selectOption(p.Options, item)
+			if err != nil {
+				return "", err
+			}
+			selected = append(selected, opt)
+		}
+		data, _ := json.Marshal(selected)
+		value = string(data)
+	case provider.ParameterFormTypeTagSelect:
+		items, err := listAnswer(answer)
+		if err != nil {
+			return "", err
+		}
+		data, _ := json.Marshal(items)
+		value = string(data)
+	case provider.ParameterFormTypeCheckbox, provider.ParameterFormTypeSwitch:
+		switch strings.ToLower(answer) {
+		case "y", "yes", "true":
+			value = "true"
+		case "n", "no", "false":
+			value = "false"
+		default:
+			return "", fmt.Errorf("answer yes or no")
+		}
+	default:
+		if p.Type == types.ParameterTypeNumber {
+			if _, err := strconv.ParseFloat(answer, 64); err != nil {
+				return "", fmt.Errorf("%q is not a number", answer)
+			}
+		}
+		value = answer
+	}
+
+	for _, v := range p.Validations {
+		if err := v.Valid(string(p.Type), value); err != nil {
+			return "", err
+		}
+	}
+	return value, nil
+}
+
+// valueRequired returns true if the parameter is required, or has no
+// default, which the provider treats as required.
+func valueRequired(p types.Parameter) bool {
+	if p.Required {
+		return true
+	}
+	return p.Source != nil && p.Source.GetAttribute("default").IsNil()
+}
+
+// selectOption returns the value of the option with the value, or with the
+// number in the prompt.
+func selectOption(options []*types.ParameterOption, answer string) (string, error) {
+	for _, opt := range options {
+		if opt.Value.AsString() == answer {
+			return answer, nil
+		}
+	}
+	if n, err := strconv.Atoi(answer); err == nil && n >= 1 && n <= len(options) {
+		return options[n-1].Value.AsString(), nil
+	}
+	return "", fmt.Errorf("%q is not an option", answer)
+}
+
+// listAnswer splits the answer by commas, unless it is a JSON array.
+func listAnswer(answer string) ([]string, error) {
+	if strings.HasPrefix(answer, "[") {
+		var items []string
+		if err := json.Unmarshal([]byte(answer), &items); err != nil {
+			return nil, fmt.Errorf("invalid JSON array: %w", err)
+		}
+		return items, nil
+	}
+
+	items := make([]string, 0)
+	for _, item := range strings.Split(answer, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
+
+// selectedOptions returns the option values the current value selects.
+func selectedOptions(formType provider.ParameterFormType, current string) []string {
+	if formType != provider.ParameterFormTypeMultiSelect {
+		return []string{current}
+	}
+	var selected []string
+	_ = json.Unmarshal([]byte(current), &selected)
+	return selected
+}
@@ -0,0 +1,221 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/coder/preview"
+	"github.com/coder/preview/types"
+)
+
+// promptTemplate has a region parameter that is asked first, but whose
+// options depend on the cloud asked after it.
+const promptTemplate = `
+locals {
+  regions = {
+    aws = ["us-east-1", "eu-west-1"]
+    gcp = ["us-central1", "europe-west1"]
+  }
+}
+
+data "coder_parameter" "region" {
+  name    = "region"
+  type    = "string"
+  order   = 1
+  default = local.regions[data.coder_parameter.cloud.value][0]
+
+  dynamic "option" {
+    for_each = local.regions[data.coder_parameter.cloud.value]
+    content {
+      name  = option.value
+      value = option.value
+    }
+  }
+}
+
+data "coder_parameter" "cloud" {
+  name    = "cloud"
+  type    = "string"
+  order   = 2
+  default = "aws"
+
+  option {
+    name  = "AWS"
+    value = "aws"
+  }
+  option {
+    name  = "GCP"
+    value = "gcp"
+  }
+}
+
+data "coder_parameter" "size" {
+  name  = "size"
+  type  = "number"
+  order = 3
+}
+`
+
+func TestPromptParameters(t *testing.T) {
+	t.Parallel()
+
+	dir := fstest.MapFS{"main.tf": &fstest.MapFile{Data: []byte(promptTemplate)}}
+
+	for _, tc := range []struct {
+		name    string
+		initial map[string]string
+		answers string
+		values  map[string]string
+		// output are lines of the prompts, in order.
+		output []string
+		err    error
+	}{
+		{
+			name:    "Defaults",
+			answers: "\n\n5\n",
+			values:  map[string]string{"region": "us-east-1", "cloud": "aws", "size": "5"},
+			output:  []string{"region", "cloud", "size *", "Value []: "},
+		},
+		{
+			name:    "Initial",
+			initial: map[string]string{"cloud": "gcp", "size": "3"},
+			answers: "\n\n\n",
+			values:  map[string]string{"region": "us-central1", "cloud": "gcp", "size": "3"},
+			output:  []string{"us-central1 (us-central1)", "Value [3]: "},
+		},
+		{
+			name: "OptionNumbers",
+			// The region is selected before the cloud changes its options,
+			// so it is asked again.
+			answers: "2\n2\neurope-west1\n5\n",
+			values:  map[string]string{"region": "europe-west1", "cloud": "gcp", "size": "5"},
+			output: []string{
+				"2) eu-west-1 (eu-west-1)",
+				"2) GCP (gcp)",
+				`The value of "region" is no longer valid`,
+				"2) europe-west1 (europe-west1)",
+			},
+		},
+		{
+			name:    "InvalidAnswers",
+			answers: "us-central1\n\n\n\nmany\n5\n",
+			values:  map[string]string{"region": "us-east-1", "cloud": "aws", "size": "5"},
+			output: []string{
+				`"us-central1" is not an option`,
+				"a value is required",
+				`"many" is not a number`,
+			},
+		},
+		{
+			name:    "NoFinalNewline",
+			answers: "\n\n5",
+			values:  map[string]string{"region": "us-east-1", "cloud": "aws", "size": "5"},
+		},
+		{
+			name:    "Closed",
+			answers: "\n\n",
+			err:     errPromptClosed,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var out bytes.Buffer
+			pr := newPrompter(strings.NewReader(tc.answers), &out)
+			output, diags, err := pr.promptParameters(context.Background(), preview.Input{
+				ParameterValues: tc.initial,
+			}, dir)
+			if tc.err != nil {
+				require.ErrorIs(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+			require.NotNil(t, output, diags.Error())
+			require.False(t, diags.HasErrors(), diags.Error())
+
+			values := make(map[string]string)
+			for _, p := range output.Parameters {
+				require.Empty(t, p.Diagnostics, p.Name)
+				values[p.Name] = p.Value.AsString()
+			}
+			assert.Equal(t, tc.values, values)
+
+			prompts := out.String()
+			for _, line := range tc.output {
+				idx := strings.Index(prompts, line)
+				require.GreaterOrEqual(t, idx, 0, "%q not in:\n%s", line, out.String())
+				prompts = prompts[idx+len(line):]
+			}
+		})
+	}
+}
+
+func TestParseAnswer(t *testing.T) {
+	t.Parallel()
+
+	option := func(value string) *types.ParameterOption {
+		return &types.ParameterOption{Name: value, Value: types.StringLiteral(value)}
+	}
+	// The option values are numbers too, in another order.
+	numbers := types.Parameter{
+		ParameterData: types.ParameterData{
+			Name:    "cores",
+			Type:    types.ParameterTypeNumber,
+			Options: []*types.ParameterOption{option("4"), option("1"), option("2")},
+		},
+		Value: types.StringLiteral("4"),
+	}
+	multi := types.Parameter{
+		ParameterData: types.ParameterData{
+			Name:     "tools",
+			Type:     types.ParameterTypeListString,
+			FormType: "multi-select",
+			Options:  []*types.ParameterOption{option("git"), option("vim")},
+		},
+		Value: types.StringLiteral("[]"),
+	}
+	toggle := types.Parameter{
+		ParameterData: types.ParameterData{
+			Name: "gpu",
+			Type: types.ParameterTypeBoolean,
+		},
+		Value: types.StringLiteral("false"),
+	}
+
+	for _, tc := range []struct {
+		name   string
+		param  types.Parameter
+		answer string
+		value  string
+		err    string
+	}{
+		// A value is selected before an option number.
+		{name: "OptionValue", param: numbers, answer: "1", value: "1"},
+		{name: "OptionNumber", param: numbers, answer: "3", value: "2"},
+		{name: "OptionOutOfRange", param: numbers, answer: "5", err: `"5" is not an option`},
+		{name: "MultiByNumber", param: multi, answer: "2, 1", value: `["vim","git"]`},
+		{name: "MultiJSON", param: multi, answer: `["git"]`, value: `["git"]`},
+		{name: "MultiInvalid", param: multi, answer: "git,emacs", err: `"emacs" is not an option`},
+		{name: "Yes", param: toggle, answer: "Y", value: "true"},
+		{name: "No", param: toggle, answer: "false", value: "false"},
+		{name: "NotYesOrNo", param: toggle, answer: "maybe", err: "answer yes or no"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			value, err := parseAnswer(tc.param, tc.answer)
+			if tc.err != "" {
+				require.EqualError(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.value, value)
+		})
+	}
+}
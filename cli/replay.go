@@ -0,0 +1,187 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/coder/preview/web"
+	"github.com/coder/serpent"
+)
+
+func (r *RootCmd) Replay() *serpent.Command {
+	var (
+		dataDir string
+		verbose bool
+	)
+
+	cmd := &serpent.Command{
+		Use:   "replay <recording.jsonl>",
+		Short: "Replays a session recorded with 'web --record' against the current code, and reports the responses that changed.",
+		Long: "Recordings of template directories are replayed against the directory of the same name in --dir. " +
+			"The contents of uploaded templates are not recorded, so their recordings are skipped.",
+		Options: serpent.OptionSet{
+			{
+				Name:        "dir",
+				Description: "Directory to find the set of template directories.",
+				Flag:        "dir",
+				Default:     "testdata",
+				Value:       serpent.StringOf(&dataDir),
+			},
+			{
+				Name:        "verbose",
+				Description: "Also list the responses that did not change.",
+				Flag:        "verbose",
+				Default:     "false",
+				Value:       serpent.BoolOf(&verbose),
+			},
+		},
+		Middleware: serpent.RequireNArgs(1),
+		Handler: func(i *serpent.Invocation) error {
+			ctx := i.Context()
+
+			f, err := os.Open(i.Args[0])
+			if err != nil {
+				return err
+			}
+			recordings, err := web.ReadRecordings(f)
+			_ = f.Close()
+			if err != nil {
+				return err
+			}
+
+			var changed, skipped int
+			for _, rec := range recordings {
+				name := fmt.Sprintf("%s session %s request %d", rec.Template, shortID(rec.Session), rec.Request.ID)
+				if strings.HasPrefix(rec.Template, "uploads/") {
+					skipped++
+					_, _ = fmt.Fprintf(i.Stdout, "%s: skipped, uploaded templates are not recorded\n", name)
+					continue
+				}
+
+				// Recordings are not trusted to name a directory outside --dir.
+				if !filepath.IsLocal(filepath.FromSlash(rec.Template)) {
+					skipped++
+					_, _ = fmt.Fprintf(i.Stdout, "%s: skipped, template is not a directory in --dir\n", name)
+					continue
+				}
+				dirFS := os.DirFS(filepath.Join(dataDir, filepath.FromSlash(rec.Template)))
+				if _, err := fs.Stat(dirFS, "."); err != nil {
+					skipped++
+					_, _ = fmt.Fprintf(i.Stdout, "%s: skipped, template not found\n", name)
+					continue
+				}
+				if hash, err := web.TemplateHash(dirFS); err == nil && hash != rec.TemplateHash {
+					_, _ = fmt.Fprintf(i.Stderr, "%s: template files changed since the recording\n", name)
+				}
+
+				resp := web.Replay(ctx, dirFS, rec, web.Options{})
+				var recorded, current any
+				if err := json.Unmarshal(rec.Response, &recorded); err != nil {
+					return fmt.Errorf("%s: decode recorded response: %w", name, err)
+				}
+				data, err := json.Marshal(resp)
+				if err != nil {
+					return fmt.Errorf("%s: encode response: %w", name, err)
+				}
+				_ = json.Unmarshal(data, &current)
+
+				diffs := jsonDiff("", recorded, current)
+				if len(diffs) == 0 {
+					if verbose {
+						_, _ = fmt.Fprintf(i.Stdout, "%s: unchanged\n", name)
+					}
+					continue
+				}
+
+				changed++
+				_, _ = fmt.Fprintf(i.Stdout, "%s: %d differences\n", name, len(diffs))
+				for _, diff := range diffs {
+					_, _ = fmt.Fprintf(i.Stdout, "  %s\n", diff)
+				}
+			}
+
+			_, _ = fmt.Fprintf(i.Stdout, "%d of %d responses changed, %d skipped\n", changed, len(recordings), skipped)
+			if changed > 0 {
+				return fmt.Errorf("%d responses changed", changed)
+			}
+			return nil
+		},
+	}
+	return cmd
+}
+
+// jsonDiff lists the differences between two decoded JSON values, as
+// 'path: recorded -> current'.
+func jsonDiff(path string, recorded, current any) []string {
+	switch r := recorded.(type) {
+	case map[string]any:
+		c, ok := current.(map[string]any)
+		if !ok {
+			break
+		}
+		keys := make([]string, 0, len(r)+len(c))
+		for key := range r {
+			keys = append(keys, key)
+		}
+		for key := range c {
+			if _, ok := r[key]; !ok {
+				keys = append(keys, key)
+			}
+		}
+		slices.Sort(keys)
+
+		var diffs []string
+		for _, key := range keys {
+			diffs = append(diffs, jsonDiff(path+"."+key, r[key], c[key])...)
+		}
+		return diffs
+	case []any:
+		c, ok := current.([]any)
+		if !ok {
+			break
+		}
+		var diffs []string
+		for idx := range max(len(r), len(c)) {
+			var rv, cv any
+			if idx < len(r) {
+				rv = r[idx]
+			}
+			if idx < len(c) {
+				cv = c[idx]
+			}
+			diffs = append(diffs, jsonDiff(path+"["+strconv.Itoa(idx)+"]", rv, cv)...)
+		}
+		return diffs
+	}
+
+	if reflect.DeepEqual(recorded, current) {
+		return nil
+	}
+	if path == "" {
+		path = "."
+	}
+	return []string{fmt.Sprintf("%s: %s -> %s", path, jsonValue(recorded), jsonValue(current))}
+}
+
+func jsonValue(v any) string {
+	data, _ := json.Marshal(v)
+	const maxLen = 80
+	if len(data) > maxLen {
+		return string(data[:maxLen]) + "..."
+	}
+	return string(data)
+}
+
+func shortID(id string) string {
+	if len(id) > 8 {
+		return id[:8]
+	}
+	return id
+}
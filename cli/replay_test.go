@@ -0,0 +1,138 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/coder/preview/web"
+)
+
+const replayTemplate = `
+data "coder_parameter" "region" {
+  name    = "region"
+  type    = "string"
+  default = "eu"
+}
+
+data "coder_parameter" "size" {
+  name    = "size"
+  type    = "number"
+  default = data.coder_parameter.region.value == "us" ? 20 : 10
+}
+`
+
+func TestReplay(t *testing.T) {
+	t.Parallel()
+
+	// record returns a recording of a request to the template, as written
+	// by 'web --record'.
+	record := func(t *testing.T, dir, template string) web.Recording {
+		t.Helper()
+		rec := web.Recording{
+			Session:  "0123456789",
+			Template: template,
+			Request:  web.Request{ID: 1, Inputs: map[string]string{"region": "us"}},
+		}
+		resp := web.Replay(context.Background(), os.DirFS(dir), rec, web.Options{})
+		var err error
+		rec.Response, err = json.Marshal(resp)
+		require.NoError(t, err)
+		return rec
+	}
+
+	for _, tc := range []struct {
+		name string
+		// template is the recorded template name.
+		template string
+		// changed is written over the template after the recording.
+		changed string
+		output  []string
+		failed  bool
+	}{
+		{
+			name:     "Unchanged",
+			template: "demo",
+			output:   []string{"0 of 1 responses changed, 0 skipped"},
+		},
+		{
+			name:     "Changed",
+			template: "demo",
+			changed:  strings.Replace(replayTemplate, "? 20 : 10", "? 30 : 10", 1),
+			output: []string{
+				"demo session 01234567 request 1: 2 differences",
+				`.parameters[1].default_value.value: "20" -> "30"`,
+				`.parameters[1].value.value: "20" -> "30"`,
+				"1 of 1 responses changed, 0 skipped",
+			},
+			failed: true,
+		},
+		{
+			name:     "Upload",
+			template: "uploads/abc",
+			output:   []string{"skipped, uploaded templates are not recorded", "0 of 1 responses changed, 1 skipped"},
+		},
+		{
+			name:     "Outside",
+			template: "../demo",
+			output:   []string{"skipped, template is not a directory in --dir", "0 of 1 responses changed, 1 skipped"},
+		},
+		{
+			name:     "Absolute",
+			template: "/demo",
+			output:   []string{"skipped, template is not a directory in --dir", "0 of 1 responses changed, 1 skipped"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			root := t.TempDir()
+			dir := filepath.Join(root, "demo")
+			require.NoError(t, os.Mkdir(dir, 0o755))
+			require.NoError(t, os.WriteFile(filepath.Join(dir, "main.tf"), []byte(replayTemplate), 0o600))
+
+			rec := record(t, dir, tc.template)
+			line, err := json.Marshal(rec)
+			require.NoError(t, err)
+			path := filepath.Join(t.TempDir(), "session.jsonl")
+			require.NoError(t, os.WriteFile(path, append(line, '\n'), 0o600))
+			if tc.changed != "" {
+				require.NoError(t, os.WriteFile(filepath.Join(dir, "main.tf"), []byte(tc.changed), 0o600))
+			}
+
+			var stdout, stderr bytes.Buffer
+			inv := (&RootCmd{}).Root().Invoke("replay", "--dir", root, path)
+			inv.Stdout, inv.Stderr = &stdout, &stderr
+			err = inv.Run()
+			if tc.failed {
+				require.ErrorContains(t, err, "1 responses changed")
+			} else {
+				require.NoError(t, err, stdout.String())
+			}
+			for _, line := range tc.output {
+				assert.Contains(t, stdout.String(), line)
+			}
+		})
+	}
+}
+
+func TestJSONDiff(t *testing.T) {
+	t.Parallel()
+
+	recorded := map[string]any{"a": 1.0, "b": []any{"x", "y"}, "c": map[string]any{"d": true}}
+	current := map[string]any{"a": 2.0, "b": []any{"x"}, "c": map[string]any{"d": true}, "e": "new"}
+	assert.Equal(t, []string{
+		".a: 1 -> 2",
+		`.b[1]: "y" -> null`,
+		`.e: null -> "new"`,
+	}, jsonDiff("", recorded, current))
+	assert.Empty(t, jsonDiff("", recorded, recorded))
+	assert.Equal(t, []string{`.: 1 -> "1"`}, jsonDiff("", 1.0, "1"))
+}
@@ -4,8 +4,6 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
-	"os"
-	"strings"
 
 	"github.com/hashicorp/hcl/v2"
 	"github.com/hashicorp/hcl/v2/hclsyntax"
@@ -13,7 +11,6 @@ import (
 
 	"github.com/coder/preview"
 	"github.com/coder/preview/cli/clidisplay"
-	"github.com/coder/preview/types"
 	"github.com/coder/serpent"
 )
 
@@ -23,105 +20,118 @@ type RootCmd struct {
 
 func (r *RootCmd) Root() *serpent.Command {
 	var (
-		dir      string
-		vars     []string
-		groups   []string
-		planJSON string
+		flags  previewFlags
+		format string
+		watch  bool
 	)
 	cmd := &serpent.Command{
 		Use:   "codertf",
 		Short: "codertf is a command line tool for previewing terraform template outputs.",
-		Options: serpent.OptionSet{
-			{
-				Name:          "dir",
-				Description:   "Directory with terraform files.",
-				Flag:          "dir",
-				FlagShorthand: "d",
-				Default:       ".",
-				Value:         serpent.StringOf(&dir),
+		Long: "Exits with 0 if the preview has no diagnostics, 2 if it only has warnings, " +
+			"and 1 if it has errors or failed.",
+		Options: append(flags.options(),
+			serpent.Option{
+				Name: "output",
+				Description: "Output format. 'json' and 'yaml' write the parameters, workspace tags, " +
+					"diagnostics and module output as a single document. 'sarif' writes the diagnostics " +
+					"as SARIF 2.1.0, and 'github' as GitHub Actions workflow commands. Their file paths " +
+					"are relative to the git repository of --dir, or else to the working directory.",
+				Flag:          "output",
+				FlagShorthand: "o",
+				Default:       outputTable,
+				Value:         serpent.EnumOf(&format, outputTable, outputJSON, outputYAML, outputSARIF, outputGitHub),
 			},
-			{
-				Name:          "plan",
-				Description:   "Terraform plan file as json.",
-				Flag:          "plan",
-				FlagShorthand: "p",
-				Default:       "",
-				Value:         serpent.StringOf(&planJSON),
+			serpent.Option{
+				Name: "watch",
+				Description: "Preview again after every change to a '.tf', '.tfvars' or plan JSON file in --dir, " +
+					"and highlight the parameter values and diagnostics that changed since the previous preview. " +
+					"Only '--output table' is supported.",
+				Flag:    "watch",
+				Default: "false",
+				Value:   serpent.BoolOf(&watch),
 			},
-			{
-				Name:          "vars",
-				Description:   "Variables.",
-				Flag:          "vars",
-				FlagShorthand: "v",
-				Default:       "",
-				Value:         serpent.StringArrayOf(&vars),
-			},
-			{
-				Name:          "groups",
-				Description:   "Groups.",
-				Flag:          "groups",
-				FlagShorthand: "g",
-				Default:       "",
-				Value:         serpent.StringArrayOf(&groups),
-			},
-		},
+		),
 		Handler: func(i *serpent.Invocation) error {
-			dfs := os.DirFS(dir)
-
-			rvars := make(map[string]string)
-			for _, val := range vars {
-				parts := strings.Split(val, "=")
-				if len(parts) != 2 {
-					continue
+			if watch {
+				if format != outputTable {
+					return fmt.Errorf("--watch only supports --output %s", outputTable)
 				}
-				rvars[parts[0]] = parts[1]
+				return r.watchPreview(i, flags)
 			}
 
-			input := preview.Input{
-				PlanJSONPath:    planJSON,
-				ParameterValues: rvars,
-				Owner: types.WorkspaceOwner{
-					Groups: groups,
-				},
+			dfs := flags.dirFS()
+			input, err := flags.input()
+			if err != nil {
+				return err
 			}
 
 			ctx := i.Context()
 			output, diags := preview.Preview(ctx, input, dfs)
-			if output == nil {
-				return diags
+			if output != nil {
+				r.Files = output.Files
 			}
-			r.Files = output.Files
 
-			if len(diags) > 0 {
-				_, _ = fmt.Fprintf(os.Stderr, "Parsing Diagnostics:\n")
-				clidisplay.WriteDiagnostics(os.Stderr, output.Files, diags)
-			}
-
-			diags = clidisplay.WorkspaceTags(os.Stdout, output.WorkspaceTags)
-			if len(diags) > 0 {
-				_, _ = fmt.Fprintf(os.Stderr, "Workspace Tags Diagnostics:\n")
-				clidisplay.WriteDiagnostics(os.Stderr, output.Files, diags)
+			switch format {
+			case outputSARIF, outputGitHub:
+				if err := writeAnnotations(i.Stdout, format, flags.dir, previewAnnotations(output, diags)); err != nil {
+					return err
+				}
+				return diagnosticsExit(output, diags)
+			case outputJSON, outputYAML:
+				doc, err := newPreviewDocument(output, diags)
+				if err != nil {
+					return err
+				}
+				if err := writeDocument(i.Stdout, format, doc); err != nil {
+					return err
+				}
+				return diagnosticsExit(output, diags)
 			}
 
-			clidisplay.Parameters(os.Stdout, output.Parameters, output.Files)
-
-			if !output.ModuleOutput.IsNull() && !(output.ModuleOutput.Type().IsObjectType() && output.ModuleOutput.LengthInt() == 0) {
-				fmt.Println("Module output")
-				data, _ := ctyjson.Marshal(output.ModuleOutput, output.ModuleOutput.Type())
-				var buf bytes.Buffer
-				_ = json.Indent(&buf, data, "", "  ")
-				fmt.Println(buf.String())
+			if output == nil {
+				return diags
 			}
-
-			return nil
+			return writePreview(i, output, diags)
 		},
 	}
 	cmd.AddSubcommands(r.TerraformPlan())
 	cmd.AddSubcommands(r.WebsocketServer())
 	cmd.AddSubcommands(r.SetEnv())
+	cmd.AddSubcommands(r.Tags())
+	cmd.AddSubcommands(r.Replay())
+	cmd.AddSubcommands(r.Lint())
+	cmd.AddSubcommands(r.Diff())
+	cmd.AddSubcommands(r.Create())
+	cmd.AddSubcommands(r.Console())
 	return cmd
 }
 
+// writePreview writes the tags, parameters and module output of the preview
+// as tables, and returns the ExitError for its diagnostics.
+func writePreview(i *serpent.Invocation, output *preview.Output, diags hcl.Diagnostics) error {
+	if len(diags) > 0 {
+		_, _ = fmt.Fprintf(i.Stderr, "Parsing Diagnostics:\n")
+		clidisplay.WriteDiagnostics(i.Stderr, output.Files, diags)
+	}
+
+	tagDiags := clidisplay.WorkspaceTags(i.Stdout, output.WorkspaceTags)
+	if len(tagDiags) > 0 {
+		_, _ = fmt.Fprintf(i.Stderr, "Workspace Tags Diagnostics:\n")
+		clidisplay.WriteDiagnostics(i.Stderr, output.Files, tagDiags)
+	}
+
+	clidisplay.Parameters(i.Stdout, output.Parameters, output.Files)
+
+	if !output.ModuleOutput.IsNull() && !(output.ModuleOutput.Type().IsObjectType() && output.ModuleOutput.LengthInt() == 0) {
+		_, _ = fmt.Fprintln(i.Stdout, "Module output")
+		data, _ := ctyjson.Marshal(output.ModuleOutput, output.ModuleOutput.Type())
+		var buf bytes.Buffer
+		_ = json.Indent(&buf, data, "", "  ")
+		_, _ = fmt.Fprintln(i.Stdout, buf.String())
+	}
+	return diagnosticsExit(output, append(diags, tagDiags...))
+}
+
 func hclExpr(expr string) hcl.Expression {
 	file, diags := hclsyntax.ParseConfig([]byte(fmt.Sprintf(`expr = %s`, expr)), "test.tf", hcl.InitialPos)
 	if diags.HasErrors() {
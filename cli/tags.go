@@ -0,0 +1,126 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/coder/preview"
+	"github.com/coder/preview/cli/clidisplay"
+	"github.com/coder/serpent"
+)
+
+func (r *RootCmd) Tags() *serpent.Command {
+	var (
+		flags           previewFlags
+		asJSON          bool
+		matrix          bool
+		maxCombinations int64
+		seed            int64
+		concurrency     int64
+	)
+
+	cmd := &serpent.Command{
+		Use:   "tags",
+		Short: "Shows the workspace tags and the inputs each tag depends on.",
+		Options: append(flags.options(),
+			serpent.Option{
+				Name:        "json",
+				Description: "Output the tags and their inputs as json.",
+				Flag:        "json",
+				Default:     "false",
+				Value:       serpent.BoolOf(&asJSON),
+			},
+			serpent.Option{
+				Name: "matrix",
+				Description: "Preview every combination of the option and boolean parameters " +
+					"that influence the tags, and report the distinct tag sets.",
+				Flag:    "matrix",
+				Default: "false",
+				Value:   serpent.BoolOf(&matrix),
+			},
+			serpent.Option{
+				Name:        "max-combinations",
+				Description: "Maximum number of combinations to preview with --matrix. Larger spaces are sampled.",
+				Flag:        "max-combinations",
+				Default:     strconv.Itoa(preview.DefaultTagMatrixMaxCombinations),
+				Value:       serpent.Int64Of(&maxCombinations),
+			},
+			serpent.Option{
+				Name:        "seed",
+				Description: "Random seed used when sampling combinations with --matrix.",
+				Flag:        "seed",
+				Default:     "0",
+				Value:       serpent.Int64Of(&seed),
+			},
+			serpent.Option{
+				Name:        "concurrency",
+				Description: "Number of previews to run in parallel with --matrix. Defaults to the number of CPUs.",
+				Flag:        "concurrency",
+				Default:     "0",
+				Value:       serpent.Int64Of(&concurrency),
+			},
+		),
+		Handler: func(i *serpent.Invocation) error {
+			if matrix {
+				return r.tagMatrix(i, flags, asJSON, preview.TagMatrixOptions{
+					MaxCombinations: int(maxCombinations),
+					Seed:            seed,
+					Concurrency:     int(concurrency),
+				})
+			}
+
+			input, err := flags.input()
+			if err != nil {
+				return err
+			}
+			output, diags := preview.Preview(i.Context(), input, flags.dirFS())
+			if output == nil {
+				return diags
+			}
+			r.Files = output.Files
+
+			if len(diags) > 0 {
+				_, _ = fmt.Fprintf(i.Stderr, "Parsing Diagnostics:\n")
+				clidisplay.WriteDiagnostics(i.Stderr, output.Files, diags)
+			}
+
+			if asJSON {
+				enc := json.NewEncoder(i.Stdout)
+				enc.SetIndent("", "  ")
+				return enc.Encode(output.WorkspaceTags.Provenance())
+			}
+
+			_ = clidisplay.WorkspaceTags(i.Stdout, output.WorkspaceTags)
+			return nil
+		},
+	}
+
+	return cmd
+}
+
+func (r *RootCmd) tagMatrix(i *serpent.Invocation, flags previewFlags, asJSON bool, opts preview.TagMatrixOptions) error {
+	input, err := flags.input()
+	if err != nil {
+		return err
+	}
+	matrix, diags := preview.WorkspaceTagMatrix(i.Context(), input, flags.dirFS(), opts)
+	if matrix == nil {
+		return diags
+	}
+	r.Files = matrix.Files
+
+	if len(diags) > 0 {
+		_, _ = fmt.Fprintf(i.Stderr, "Parsing Diagnostics:\n")
+		clidisplay.WriteDiagnostics(i.Stderr, matrix.Files, diags)
+	}
+
+	if asJSON {
+		enc := json.NewEncoder(i.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(matrix)
+	}
+
+	clidisplay.TagMatrix(i.Stdout, matrix)
+	return nil
+}
@@ -0,0 +1,34 @@
+package cli
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTagMatrixDiagnostics(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "main.tf"), []byte(`
+data "coder_workspace_tags" "custom" {
+  tags = "not an object"
+}
+`), 0o600))
+
+	var stdout, stderr bytes.Buffer
+	root := &RootCmd{}
+	inv := root.Root().Invoke("tags", "--matrix", "--dir", dir)
+	inv.Stdout, inv.Stderr = &stdout, &stderr
+	require.NoError(t, inv.Run())
+
+	// The diagnostics show the source of the preview that produced them.
+	assert.Contains(t, stderr.String(), "Incorrect type for \"tags\" attribute")
+	assert.Contains(t, stderr.String(), `= "not an object"`)
+	assert.NotContains(t, stderr.String(), "source code not available")
+	assert.Contains(t, root.Files, "main.tf")
+}
@@ -0,0 +1,224 @@
+package cli
+
+import (
+	"fmt"
+	"maps"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/hcl/v2"
+
+	"github.com/coder/preview"
+	"github.com/coder/preview/cli/clidisplay"
+	"github.com/coder/preview/internal/watch"
+	"github.com/coder/preview/types"
+	"github.com/coder/serpent"
+)
+
+const (
+	// watchPoll is how often files are checked if filesystem notifications
+	// are not available.
+	watchPoll = time.Second
+	// clearScreen moves the cursor to the top left and clears the terminal.
+	clearScreen = "\033[H\033[2J"
+)
+
+// watchPreview previews the template again after every change to its files,
+// until the context is canceled. Each run clears the screen, and lists the
+// parameter values and diagnostics that changed since the previous run.
+func (r *RootCmd) watchPreview(i *serpent.Invocation, flags previewFlags) error {
+	ctx := i.Context()
+
+	var files []string
+	if flags.planJSON != "" {
+		// The plan is read from the template directory.
+		files = append(files, filepath.Join(flags.dir, filepath.FromSlash(flags.planJSON)))
+	}
+	for _, path := range []string{flags.varsFile, flags.ownerFile} {
+		if path != "" {
+			files = append(files, path)
+		}
+	}
+	// The watcher reports absolute paths.
+	for idx, path := range files {
+		if abs, err := filepath.Abs(path); err == nil {
+			files[idx] = abs
+		}
+	}
+	changes := make(chan struct{}, 1)
+	watcher := watch.New(watch.Options{
+		Dir:   flags.dir,
+		Files: files,
+		Key: func(path string) (string, bool) {
+			return "", slices.Contains(files, path) || relevantFile(path)
+		},
+		Changed: func(string) {
+			select {
+			case changes <- struct{}{}:
+			default:
+			}
+		},
+		Poll: watchPoll,
+		Unavailable: func(err error) {
+			_, _ = fmt.Fprintf(i.Stderr, "filesystem notifications unavailable, polling for changes every %s: %s\n", watchPoll, err.Error())
+		},
+	})
+	go watcher.Run(ctx)
+
+	var (
+		previous *watchSnapshot
+		runs     int
+	)
+	for {
+		runs++
+		_, _ = fmt.Fprint(i.Stdout, clearScreen)
+		_, _ = fmt.Fprintf(i.Stdout, "Preview #%d at %s, watching %s for changes\n\n", runs, time.Now().Format(time.TimeOnly), flags.dir)
+
+		current, err := r.watchRun(i, flags)
+		if err != nil {
+			_, _ = fmt.Fprintln(i.Stderr, err.Error())
+		}
+		if current != nil && previous != nil {
+			clidisplay.Changes(i.Stdout, previous.changes(current))
+			// A failed preview has no values, so the next run is compared
+			// to the last values there were.
+			if current.values == nil {
+				current.values, current.order = previous.values, previous.order
+			}
+		}
+		if current != nil {
+			previous = current
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-changes:
+		}
+	}
+}
+
+// watchRun previews the template once and writes it. The snapshot is nil if
+// the inputs could not be read.
+func (r *RootCmd) watchRun(i *serpent.Invocation, flags previewFlags) (*watchSnapshot, error) {
+	// The inputs are read again, as the files they name may have changed.
+	input, err := flags.input()
+	if err != nil {
+		return nil, err
+	}
+
+	output, diags := preview.Preview(i.Context(), input, flags.dirFS())
+	if output == nil {
+		clidisplay.WriteDiagnostics(i.Stderr, nil, diags)
+		return newWatchSnapshot(nil, diags), nil
+	}
+	r.Files = output.Files
+
+	// The exit code does not apply, the diagnostics are written.
+	_ = writePreview(i, output, diags)
+	return newWatchSnapshot(output, diags), nil
+}
+
+// watchSnapshot is what a run of the watch mode is compared by.
+type watchSnapshot struct {
+	// values are nil if the preview failed.
+	values map[string]string
+	order  []string
+	diags  map[string]*hcl.Diagnostic
+}
+
+func newWatchSnapshot(output *preview.Output, diags hcl.Diagnostics) *watchSnapshot {
+	snap := &watchSnapshot{diags: make(map[string]*hcl.Diagnostic)}
+	if output != nil {
+		snap.values = make(map[string]string, len(output.Parameters))
+		for _, p := range output.Parameters {
+			value := "??"
+			if p.Value.Valid() && p.Value.IsKnown() {
+				value = fmt.Sprintf("%q", p.Value.AsString())
+			}
+			snap.values[p.Name] = value
+			snap.order = append(snap.order, p.Name)
+			diags = append(diags, hcl.Diagnostics(p.Diagnostics)...)
+		}
+	}
+	for _, diag := range diags {
+		snap.diags[diagnosticKey(diag)] = diag
+	}
+	return snap
+}
+
+// changes returns the parameter values and diagnostics that changed from
+// the snapshot to the next one. The values of a failed preview are not
+// compared.
+func (s *watchSnapshot) changes(next *watchSnapshot) []clidisplay.Change {
+	var changes []clidisplay.Change
+	if s.values != nil && next.values != nil {
+		for _, name := range next.order {
+			old, ok := s.values[name]
+			switch {
+			case !ok:
+				changes = append(changes, clidisplay.Change{Op: clidisplay.ChangeAdded, Text: fmt.Sprintf("parameter %s = %s", name, next.values[name])})
+			case old != next.values[name]:
+				changes = append(changes, clidisplay.Change{Op: clidisplay.ChangeModified, Text: fmt.Sprintf("parameter %s: %s -> %s", name, old, next.values[name])})
+			}
+		}
+		for _, name := range s.order {
+			if _, ok := next.values[name]; !ok {
+				changes = append(changes, clidisplay.Change{Op: clidisplay.ChangeRemoved, Text: fmt.Sprintf("parameter %s", name)})
+			}
+		}
+	}
+
+	for _, key := range slices.Sorted(maps.Keys(next.diags)) {
+		if _, ok := s.diags[key]; !ok {
+			changes = append(changes, clidisplay.Change{Op: clidisplay.ChangeAdded, Text: diagnosticLine(next.diags[key])})
+		}
+	}
+	for _, key := range slices.Sorted(maps.Keys(s.diags)) {
+		if _, ok := next.diags[key]; !ok {
+			changes = append(changes, clidisplay.Change{Op: clidisplay.ChangeRemoved, Text: diagnosticLine(s.diags[key]) + " (resolved)"})
+		}
+	}
+	return changes
+}
+
+// diagnosticKey identifies a diagnostic across runs. Only the file of the
+// subject is part of it, so that a diagnostic does not count as changed when
+// lines above it are added.
+func diagnosticKey(diag *hcl.Diagnostic) string {
+	var filename string
+	if diag.Subject != nil {
+		filename = diag.Subject.Filename
+	}
+	return fmt.Sprintf("%d\x00%s\x00%s\x00%s", diag.Severity, filename, diag.Summary, diag.Detail)
+}
+
+func diagnosticLine(diag *hcl.Diagnostic) string {
+	line := fmt.Sprintf("%s: %s", diagnosticSeverity(diag), diag.Summary)
+	if diag.Subject != nil {
+		line += fmt.Sprintf(" (%s:%d)", diag.Subject.Filename, diag.Subject.Start.Line)
+	}
+	return line
+}
+
+func diagnosticSeverity(diag *hcl.Diagnostic) types.DiagnosticSeverityString {
+	if diag.Severity == hcl.DiagWarning {
+		return types.DiagnosticSeverityWarning
+	}
+	return types.DiagnosticSeverityError
+}
+
+// relevantFile reports whether a change to a file in the template directory
+// can change the preview.
+func relevantFile(path string) bool {
+	switch filepath.Ext(path) {
+	case ".tf", ".tfvars", ".json":
+		// '.json' covers plan JSON, and the '.tf.json' and '.tfvars.json'
+		// forms of the other two.
+		return !strings.HasPrefix(filepath.Base(path), ".")
+	default:
+		return false
+	}
+}
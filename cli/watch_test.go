@@ -0,0 +1,129 @@
+package cli
+
+import (
+	"testing"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/coder/preview"
+	"github.com/coder/preview/cli/clidisplay"
+	"github.com/coder/preview/types"
+)
+
+func TestWatchSnapshotChanges(t *testing.T) {
+	t.Parallel()
+
+	output := func(values ...string) *preview.Output {
+		out := &preview.Output{}
+		for idx := 0; idx < len(values); idx += 2 {
+			out.Parameters = append(out.Parameters, types.Parameter{
+				ParameterData: types.ParameterData{Name: values[idx]},
+				Value:         types.StringLiteral(values[idx+1]),
+			})
+		}
+		return out
+	}
+	diag := func(summary, filename string, line int) *hcl.Diagnostic {
+		d := &hcl.Diagnostic{Severity: hcl.DiagError, Summary: summary}
+		if filename != "" {
+			d.Subject = &hcl.Range{Filename: filename, Start: hcl.Pos{Line: line}}
+		}
+		return d
+	}
+
+	for _, tc := range []struct {
+		name     string
+		previous *watchSnapshot
+		next     *watchSnapshot
+		changes  []clidisplay.Change
+	}{
+		{
+			name:     "Unchanged",
+			previous: newWatchSnapshot(output("a", "1"), hcl.Diagnostics{diag("Broken", "main.tf", 3)}),
+			next:     newWatchSnapshot(output("a", "1"), hcl.Diagnostics{diag("Broken", "main.tf", 3)}),
+		},
+		{
+			name:     "Values",
+			previous: newWatchSnapshot(output("a", "1", "b", "2", "c", "3"), nil),
+			next:     newWatchSnapshot(output("a", "1", "b", "5", "d", "4"), nil),
+			changes: []clidisplay.Change{
+				{Op: clidisplay.ChangeModified, Text: `parameter b: "2" -> "5"`},
+				{Op: clidisplay.ChangeAdded, Text: `parameter d = "4"`},
+				{Op: clidisplay.ChangeRemoved, Text: "parameter c"},
+			},
+		},
+		{
+			name: "Unknown",
+			previous: newWatchSnapshot(&preview.Output{Parameters: []types.Parameter{{
+				ParameterData: types.ParameterData{Name: "a"},
+			}}}, nil),
+			next: newWatchSnapshot(output("a", "1"), nil),
+			changes: []clidisplay.Change{
+				{Op: clidisplay.ChangeModified, Text: `parameter a: ?? -> "1"`},
+			},
+		},
+		{
+			name: "Diagnostics",
+			previous: newWatchSnapshot(output(), hcl.Diagnostics{
+				diag("Broken", "main.tf", 3),
+				diag("Fixed", "main.tf", 5),
+			}),
+			next: newWatchSnapshot(output(), hcl.Diagnostics{
+				// Moving a diagnostic within its file is not a change.
+				diag("Broken", "main.tf", 10),
+				// The same diagnostic in another file is.
+				diag("Broken", "other.tf", 3),
+				diag("New", "", 0),
+			}),
+			changes: []clidisplay.Change{
+				{Op: clidisplay.ChangeAdded, Text: "error: New"},
+				{Op: clidisplay.ChangeAdded, Text: "error: Broken (other.tf:3)"},
+				{Op: clidisplay.ChangeRemoved, Text: "error: Fixed (main.tf:5) (resolved)"},
+			},
+		},
+		{
+			name: "ParameterDiagnostics",
+			previous: newWatchSnapshot(&preview.Output{Parameters: []types.Parameter{{
+				ParameterData: types.ParameterData{Name: "a"},
+				Value:         types.StringLiteral("1"),
+				Diagnostics:   types.Diagnostics{diag("Invalid", "main.tf", 1)},
+			}}}, nil),
+			next: newWatchSnapshot(output("a", "1"), nil),
+			changes: []clidisplay.Change{
+				{Op: clidisplay.ChangeRemoved, Text: "error: Invalid (main.tf:1) (resolved)"},
+			},
+		},
+		{
+			// A failed preview has no values to compare.
+			name:     "Failed",
+			previous: newWatchSnapshot(output("a", "1"), nil),
+			next:     newWatchSnapshot(nil, hcl.Diagnostics{diag("Parse failed", "main.tf", 1)}),
+			changes: []clidisplay.Change{
+				{Op: clidisplay.ChangeAdded, Text: "error: Parse failed (main.tf:1)"},
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tc.changes, tc.previous.changes(tc.next))
+		})
+	}
+}
+
+func TestRelevantFile(t *testing.T) {
+	t.Parallel()
+
+	for path, relevant := range map[string]bool{
+		"/tmpl/main.tf":               true,
+		"/tmpl/main.tf.json":          true,
+		"/tmpl/terraform.tfvars":      true,
+		"/tmpl/plan.json":             true,
+		"/tmpl/modules/child/main.tf": true,
+		"/tmpl/README.md":             false,
+		"/tmpl/.main.tf.swp":          false,
+		"/tmpl/.terraform.lock.hcl":   false,
+	} {
+		assert.Equal(t, relevant, relevantFile(path), path)
+	}
+}
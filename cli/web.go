@@ -12,12 +12,19 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"runtime"
 	"slices"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/go-chi/chi"
+	"golang.org/x/sync/semaphore"
 
 	"cdr.dev/slog"
 	"cdr.dev/slog/sloggers/sloghuman"
+	"github.com/coder/preview"
+	"github.com/coder/preview/archivefs"
 	"github.com/coder/preview/types"
 	"github.com/coder/preview/web"
 	"github.com/coder/serpent"
@@ -56,9 +63,23 @@ func debugMiddleware(logger slog.Logger) func(http.Handler) http.Handler {
 
 func (r *RootCmd) WebsocketServer() *serpent.Command {
 	var (
-		address string
-		siteDir string
-		dataDir string
+		address   string
+		siteDir   string
+		dataDir   string
+		cacheSize int64
+		hotReload bool
+		pollEvery time.Duration
+		origins   []string
+		token     string
+		tlsCert   string
+		tlsKey    string
+		record    string
+
+		maxPreviews    int64
+		previewTimeout time.Duration
+		maxIterations  int64
+		maxBlocks      int64
+		maxOutputBytes int64
 	)
 
 	cmd := &serpent.Command{
@@ -70,7 +91,7 @@ func (r *RootCmd) WebsocketServer() *serpent.Command {
 				Description: "Address to listen on.",
 				Required:    false,
 				Flag:        "addr",
-				Default:     "0.0.0.0:8100",
+				Default:     "127.0.0.1:8100",
 				Value:       serpent.StringOf(&address),
 			},
 			{
@@ -92,32 +113,140 @@ func (r *RootCmd) WebsocketServer() *serpent.Command {
 				Value:       serpent.StringOf(&dataDir),
 				Hidden:      false,
 			},
+			{
+				Name:        "cache-size",
+				Description: "Maximum bytes of template files kept in memory and shared between sessions.",
+				Required:    false,
+				Flag:        "cache-size",
+				Default:     fmt.Sprint(web.DefaultTemplateCacheSize),
+				Value:       serpent.Int64Of(&cacheSize),
+			},
+			{
+				Name:        "hot-reload",
+				Description: "Preview connected sessions again when their template files change.",
+				Required:    false,
+				Flag:        "hot-reload",
+				Default:     "true",
+				Value:       serpent.BoolOf(&hotReload),
+			},
+			{
+				Name:        "poll-interval",
+				Description: "How often to check for template changes if filesystem notifications are unavailable.",
+				Required:    false,
+				Flag:        "poll-interval",
+				Default:     "1s",
+				Value:       serpent.DurationOf(&pollEvery),
+			},
+			{
+				Name: "allowed-origins",
+				Description: "Host patterns of the browser origins allowed to use the server, matched with 'path.Match'. " +
+					"Use '*' to allow any origin.",
+				Required: false,
+				Flag:     "allowed-origins",
+				Default:  strings.Join(defaultAllowedOrigins, ","),
+				Value:    serpent.StringArrayOf(&origins),
+			},
+			{
+				Name:        "token",
+				Description: "Bearer token required on every request. Websocket clients can pass it as the 'token' query parameter.",
+				Required:    false,
+				Flag:        "token",
+				Env:         "PREVIEW_WEB_TOKEN",
+				Default:     "",
+				Value:       serpent.StringOf(&token),
+			},
+			{
+				Name:        "tls-cert-file",
+				Description: "Path to a TLS certificate. Serves HTTPS when set together with the key.",
+				Required:    false,
+				Flag:        "tls-cert-file",
+				Default:     "",
+				Value:       serpent.StringOf(&tlsCert),
+			},
+			{
+				Name:        "tls-key-file",
+				Description: "Path to the TLS certificate key.",
+				Required:    false,
+				Flag:        "tls-key-file",
+				Default:     "",
+				Value:       serpent.StringOf(&tlsKey),
+			},
+			{
+				Name:        "record",
+				Description: "Append every websocket request and response to this JSONL file, for use with 'codertf replay'.",
+				Required:    false,
+				Flag:        "record",
+				Default:     "",
+				Value:       serpent.StringOf(&record),
+			},
+			{
+				Name:        "max-concurrent-previews",
+				Description: "Maximum number of previews to run at once, over every session. Defaults to the number of CPUs.",
+				Required:    false,
+				Flag:        "max-concurrent-previews",
+				Default:     "0",
+				Value:       serpent.Int64Of(&maxPreviews),
+			},
+			{
+				Name:        "preview-timeout",
+				Description: "Maximum duration of a single preview. Zero is unlimited.",
+				Required:    false,
+				Flag:        "preview-timeout",
+				Default:     "30s",
+				Value:       serpent.DurationOf(&previewTimeout),
+			},
+			{
+				Name:        "max-iterations",
+				Description: "Maximum number of evaluation iterations of a single preview, over every module. Zero is unlimited.",
+				Required:    false,
+				Flag:        "max-iterations",
+				Default:     "500",
+				Value:       serpent.Int64Of(&maxIterations),
+			},
+			{
+				Name:        "max-blocks",
+				Description: "Maximum number of blocks in a module after count and for_each are expanded. Zero is unlimited.",
+				Required:    false,
+				Flag:        "max-blocks",
+				Default:     "10000",
+				Value:       serpent.Int64Of(&maxBlocks),
+			},
+			{
+				Name:        "max-output-bytes",
+				Description: "Maximum size of the module outputs of a single preview. Zero is unlimited.",
+				Required:    false,
+				Flag:        "max-output-bytes",
+				Default:     "8388608",
+				Value:       serpent.Int64Of(&maxOutputBytes),
+			},
 		},
 		// This command is mainly for developing the preview tool.
 		Hidden: true,
 		Handler: func(i *serpent.Invocation) error {
 			ctx := i.Context()
+			if (tlsCert == "") != (tlsKey == "") {
+				return fmt.Errorf("both --tls-cert-file and --tls-key-file must be set to serve TLS")
+			}
 			logger := slog.Make(sloghuman.Sink(i.Stderr)).Leveled(slog.LevelDebug)
 			dataDirFS := os.DirFS(dataDir)
+			cache := web.NewTemplateCache(cacheSize)
+			uploads := web.NewUploads(cache, web.DefaultMaxUploads, web.DefaultUploadTTL)
+
+			var watcher *web.Watcher
+			if hotReload {
+				watcher = web.NewWatcher(logger, dataDir, pollEvery)
+				go watcher.Run(ctx)
+			}
 
 			mux := chi.NewMux()
 			mux.Use(debugMiddleware(logger))
 
-			// Add CORS middleware
-			mux.Use(func(next http.Handler) http.Handler {
-				return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-					w.Header().Set("Access-Control-Allow-Origin", "*")
-					w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-					w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-
-					if r.Method == "OPTIONS" {
-						w.WriteHeader(http.StatusOK)
-						return
-					}
-
-					next.ServeHTTP(w, r)
-				})
-			})
+			policy := webPolicy{
+				origins: origins,
+				token:   token,
+			}
+			mux.Use(policy.cors)
+			mux.Use(policy.auth)
 
 			mux.HandleFunc("/users/{dir}", func(rw http.ResponseWriter, r *http.Request) {
 				dirFS, err := fs.Sub(dataDirFS, chi.URLParam(r, "dir"))
@@ -125,7 +254,7 @@ func (r *RootCmd) WebsocketServer() *serpent.Command {
 					http.Error(rw, "Could not read directory: "+err.Error(), http.StatusNotFound)
 					return
 				}
-				availableUsers, err := availableUsers(dirFS)
+				availableUsers, err := web.AvailableUsers(dirFS)
 				if err != nil {
 					http.Error(rw, err.Error(), http.StatusInternalServerError)
 					return
@@ -158,7 +287,49 @@ func (r *RootCmd) WebsocketServer() *serpent.Command {
 				rw.WriteHeader(http.StatusOK)
 				_ = json.NewEncoder(rw).Encode(dirs)
 			})
-			mux.HandleFunc("/ws/{dir}", websocketHandler(logger, dataDirFS))
+			metrics := web.NewPrometheusMetrics()
+			if maxPreviews <= 0 {
+				maxPreviews = int64(runtime.NumCPU())
+			}
+			opts := web.Options{
+				Metrics:     metrics,
+				Concurrency: semaphore.NewWeighted(maxPreviews),
+				Timeout:     previewTimeout,
+				Budget: preview.Budget{
+					MaxIterations:  int(maxIterations),
+					MaxBlocks:      int(maxBlocks),
+					MaxOutputBytes: int(maxOutputBytes),
+				},
+				ParseCache: cache.ParseCache(),
+			}
+			mux.Handle("/metrics", metrics)
+
+			// The debug page connects back to the server it is served from.
+			staticFS, err := fs.Sub(static, "static")
+			if err != nil {
+				return err
+			}
+			mux.Handle("/", http.FileServer(http.FS(staticFS)))
+
+			var recorder *web.Recorder
+			if record != "" {
+				var err error
+				recorder, err = web.NewRecorder(logger, record)
+				if err != nil {
+					return err
+				}
+				defer recorder.Close()
+			}
+
+			dirTmpl := dirTemplate(logger, dataDirFS, cache)
+			mux.HandleFunc("/ws/{dir}", websocketHandler(logger, policy, opts, recorder, dirTmpl, watcher))
+			mux.Post("/preview/{dir}", previewHandler(logger, opts, dirTmpl))
+
+			// Templates can also be uploaded as tar or zip archives.
+			uploadTmpl := uploadTemplate(uploads)
+			mux.Post("/uploads", uploadHandler(logger, uploads))
+			mux.HandleFunc("/ws/uploads/{id}", websocketHandler(logger, policy, opts, recorder, uploadTmpl, nil))
+			mux.Post("/preview/uploads/{id}", previewHandler(logger, opts, uploadTmpl))
 
 			srv := &http.Server{
 				Addr:    address,
@@ -187,7 +358,14 @@ func (r *RootCmd) WebsocketServer() *serpent.Command {
 
 			}
 
-			logger.Info(ctx, "Starting server", slog.F("address", address))
+			logger.Info(ctx, "Starting server",
+				slog.F("address", address),
+				slog.F("tls", tlsCert != ""),
+				slog.F("auth", token != ""),
+			)
+			if tlsCert != "" {
+				return srv.ListenAndServeTLS(tlsCert, tlsKey)
+			}
 			return srv.ListenAndServe()
 		},
 	}
@@ -195,15 +373,17 @@ func (r *RootCmd) WebsocketServer() *serpent.Command {
 	return cmd
 }
 
-func websocketHandler(logger slog.Logger, dirFS fs.FS) func(rw http.ResponseWriter, r *http.Request) {
-	return func(rw http.ResponseWriter, r *http.Request) {
+// maxPreviewRequestSize bounds the body of a stateless preview request. Plan
+// JSON is the largest part of it.
+const maxPreviewRequestSize = 32 << 20 // 32 MiB
 
-		logger.Debug(r.Context(), "WebSocket connection attempt",
-			slog.F("remote_addr", r.RemoteAddr),
-			slog.F("path", r.URL.Path),
-			slog.F("query", r.URL.RawQuery))
+// templateFunc returns the template a request refers to. The caller must
+// release it.
+type templateFunc func(r *http.Request) (*web.CachedTemplate, int, error)
 
-		// Validate all parameters BEFORE upgrading the connection
+// dirTemplate resolves templates from the 'dir' URL parameter.
+func dirTemplate(logger slog.Logger, dirFS fs.FS, cache *web.TemplateCache) templateFunc {
+	return func(r *http.Request) (*web.CachedTemplate, int, error) {
 		dir := chi.URLParam(r, "dir")
 		logger.Debug(r.Context(), "Directory parameter", slog.F("dir", dir))
 
@@ -212,23 +392,113 @@ func websocketHandler(logger slog.Logger, dirFS fs.FS) func(rw http.ResponseWrit
 			logger.Error(r.Context(), "Directory validation failed",
 				slog.Error(err),
 				slog.F("dir", dir))
-			http.Error(rw, "Could not stat directory: "+err.Error(), http.StatusBadRequest)
+			return nil, http.StatusBadRequest, fmt.Errorf("could not stat directory: %w", err)
+		}
+		if !dinfo.IsDir() {
+			return nil, http.StatusBadRequest, fmt.Errorf("not a directory")
+		}
+
+		sub, err := fs.Sub(dirFS, dir)
+		if err != nil {
+			return nil, http.StatusNotFound, fmt.Errorf("could not read directory: %w", err)
+		}
+		tmpl, err := cache.Acquire(dir, sub)
+		if err != nil {
+			return nil, http.StatusInternalServerError, err
+		}
+		return tmpl, http.StatusOK, nil
+	}
+}
+
+// uploadTemplate resolves templates from the 'id' URL parameter.
+func uploadTemplate(uploads *web.Uploads) templateFunc {
+	return func(r *http.Request) (*web.CachedTemplate, int, error) {
+		id := chi.URLParam(r, "id")
+		tmpl, ok := uploads.Acquire(id)
+		if !ok {
+			return nil, http.StatusNotFound, fmt.Errorf("unknown or expired upload %q", id)
+		}
+		return tmpl, http.StatusOK, nil
+	}
+}
+
+func uploadHandler(logger slog.Logger, uploads *web.Uploads) func(rw http.ResponseWriter, r *http.Request) {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		limits := archivefs.DefaultLimits
+		dirFS, err := archivefs.Read(http.MaxBytesReader(rw, r.Body, limits.MaxBytes), limits)
+		if err != nil {
+			http.Error(rw, "Invalid archive: "+err.Error(), http.StatusBadRequest)
 			return
 		}
 
-		if !dinfo.IsDir() {
-			http.Error(rw, "Not a directory", http.StatusBadRequest)
+		id, err := uploads.Add(dirFS)
+		if err != nil {
+			http.Error(rw, err.Error(), http.StatusInternalServerError)
 			return
 		}
+		logger.Debug(r.Context(), "template uploaded", slog.F("id", id))
+
+		rw.Header().Set("Content-Type", "application/json")
+		rw.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(rw).Encode(web.UploadResponse{ID: id})
+	}
+}
+
+func previewHandler(logger slog.Logger, opts web.Options, template templateFunc) func(rw http.ResponseWriter, r *http.Request) {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		var req web.PreviewRequest
+		err := json.NewDecoder(http.MaxBytesReader(rw, r.Body, maxPreviewRequestSize)).Decode(&req)
+		if err != nil {
+			http.Error(rw, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		tmpl, status, err := template(r)
+		if err != nil {
+			http.Error(rw, err.Error(), status)
+			return
+		}
+		defer tmpl.Release()
+
+		resp := web.Preview(r.Context(), tmpl.FS(), req, opts)
+		logger.Debug(r.Context(), "stateless preview",
+			slog.F("path", r.URL.Path),
+			slog.F("diagnostics", len(resp.Diagnostics)),
+		)
+
+		rw.Header().Set("Content-Type", "application/json")
+		rw.WriteHeader(http.StatusOK)
+		_ = json.NewEncoder(rw).Encode(resp)
+	}
+}
+
+// websocketHandler serves sessions for the template. If the watcher is not
+// nil, sessions are reloaded when the 'dir' template changes. If the
+// recorder is not nil, every session is recorded.
+func websocketHandler(logger slog.Logger, policy webPolicy, opts web.Options, recorder *web.Recorder, template templateFunc, watcher *web.Watcher) func(rw http.ResponseWriter, r *http.Request) {
+	return func(rw http.ResponseWriter, r *http.Request) {
+
+		logger.Debug(r.Context(), "WebSocket connection attempt",
+			slog.F("remote_addr", r.RemoteAddr),
+			slog.F("path", r.URL.Path),
+			slog.F("query", loggedQuery(r)))
+
+		// Validate all parameters BEFORE upgrading the connection
+		tmpl, status, err := template(r)
+		if err != nil {
+			http.Error(rw, err.Error(), status)
+			return
+		}
+		// The template is replaced on reloads, so the release must read the
+		// variable once the reloads have stopped.
+		defer func() { tmpl.Release() }()
 
 		// Log before WebSocket upgrade
 		logger.Debug(r.Context(), "Attempting WebSocket upgrade")
 
 		// Create WebSocket options with proper origin check
 		options := &websocket.AcceptOptions{
-			OriginPatterns: []string{
-				"*",
-			},
+			OriginPatterns: policy.origins,
 		}
 
 		conn, err := websocket.Accept(rw, r, options)
@@ -240,15 +510,10 @@ func websocketHandler(logger slog.Logger, dirFS fs.FS) func(rw http.ResponseWrit
 		logger.Debug(r.Context(), "WebSocket connection established")
 
 		var owner types.WorkspaceOwner
-		dirFS, err := fs.Sub(dirFS, dir)
-		if err != nil {
-			_ = conn.Close(websocket.StatusInternalError, err.Error())
-			return
-		}
 		planPath := r.URL.Query().Get("plan")
 		user := r.URL.Query().Get("user")
 		if user != "" {
-			available, err := availableUsers(dirFS)
+			available, err := web.AvailableUsers(tmpl.FS())
 			if err != nil {
 				_ = conn.Close(websocket.StatusInternalError, err.Error())
 				return
@@ -257,44 +522,57 @@ func websocketHandler(logger slog.Logger, dirFS fs.FS) func(rw http.ResponseWrit
 			var ok bool
 			owner, ok = available[user]
 			if !ok {
-				_ = conn.Close(websocket.StatusInternalError, err.Error())
+				_ = conn.Close(websocket.StatusInternalError, fmt.Sprintf("unknown user %q", user))
 				return
 			}
 		}
 
-		session := web.NewSession(logger, dirFS, web.SessionInputs{
+		sessionOpts := opts
+		sessionOpts.DeltaResponses = r.URL.Query().Get("delta") == "true"
+		if recorder != nil {
+			// The template is named by its path below '/ws/', so that
+			// recordings of directories can be replayed against '--dir'.
+			sessionOpts.Recorder = recorder.Session(strings.TrimPrefix(r.URL.Path, "/ws/"))
+		}
+
+		session := web.NewSession(logger, tmpl.FS(), web.SessionInputs{
 			PlanPath: planPath,
+			UserName: user,
 			User:     owner,
-		})
-		session.Listen(r.Context(), conn)
-	}
-}
-
-func availableUsers(dirFS fs.FS) (map[string]types.WorkspaceOwner, error) {
-	entries, err := fs.ReadDir(dirFS, ".")
-	if err != nil {
-		return nil, fmt.Errorf("could not read directory: %w", err)
-	}
-
-	idx := slices.IndexFunc(entries, func(entry fs.DirEntry) bool {
-		return entry.Name() == "users.json"
-	})
-	if idx == -1 {
-		return map[string]types.WorkspaceOwner{}, nil
-	}
+		}, sessionOpts)
+
+		ctx, cancel := context.WithCancel(r.Context())
+		var wg sync.WaitGroup
+		defer wg.Wait()
+		defer cancel()
+		if watcher != nil {
+			changes, unsubscribe := watcher.Subscribe(chi.URLParam(r, "dir"))
+			defer unsubscribe()
+
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for {
+					select {
+					case <-ctx.Done():
+						return
+					case <-changes:
+					}
 
-	file, err := dirFS.Open(entries[idx].Name())
-	if err != nil {
-		return nil, fmt.Errorf("could not open users file: %w", err)
-	}
-	defer file.Close()
+					next, _, err := template(r)
+					if err != nil {
+						logger.Warn(ctx, "reload template", slog.Error(err))
+						continue
+					}
+					session.Reload(ctx, next.FS())
+					tmpl.Release()
+					tmpl = next
+				}
+			}()
+		}
 
-	var users map[string]types.WorkspaceOwner
-	if err := json.NewDecoder(file).Decode(&users); err != nil {
-		return nil, fmt.Errorf("could not decode users file: %w", err)
+		session.Listen(ctx, conn)
 	}
-
-	return users, nil
 }
 
 func pnpmWebserver(ctx context.Context, inv *serpent.Invocation, siteDir string) (*os.Process, error) {
@@ -0,0 +1,103 @@
+package cli
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// defaultAllowedOrigins only allows pages served from the local machine, such
+// as the frontend dev server.
+var defaultAllowedOrigins = []string{"localhost:*", "127.0.0.1:*"}
+
+// webPolicy controls which browsers and clients can use the web server.
+type webPolicy struct {
+	// origins are host patterns, matched with path.Match like the websocket
+	// OriginPatterns.
+	origins []string
+	// token is the bearer token clients must send. An empty token disables
+	// authentication.
+	token string
+}
+
+// originAllowed reports whether a request from the origin is allowed. Requests
+// without an origin do not come from a browser, and are allowed.
+func (p webPolicy) originAllowed(r *http.Request, origin string) bool {
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	if strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	for _, pattern := range p.origins {
+		if ok, _ := path.Match(strings.ToLower(pattern), strings.ToLower(u.Host)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// cors rejects requests from origins that are not allowed. Browsers send
+// simple cross-origin requests, such as a form POST, without asking first,
+// so leaving out the CORS headers would only hide the response from the page
+// and not stop the request from running.
+func (p webPolicy) cors(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Origin")
+		origin := r.Header.Get("Origin")
+		if !p.originAllowed(r, origin) {
+			http.Error(w, "Origin not allowed", http.StatusForbidden)
+			return
+		}
+		if origin != "" {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		}
+
+		if r.Method == "OPTIONS" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// auth requires the bearer token on every request. Browsers cannot set
+// headers on websocket connections, so the token is also accepted as the
+// 'token' query parameter.
+func (p webPolicy) auth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if p.token == "" || r.Method == "OPTIONS" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok {
+			got = r.URL.Query().Get("token")
+		}
+		if subtle.ConstantTimeCompare([]byte(got), []byte(p.token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// loggedQuery returns the query of the request without the token, so that
+// it can be logged.
+func loggedQuery(r *http.Request) string {
+	query := r.URL.Query()
+	query.Del("token")
+	return query.Encode()
+}
@@ -0,0 +1,116 @@
+package cli
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebPolicyCORS(t *testing.T) {
+	t.Parallel()
+
+	policy := webPolicy{origins: defaultAllowedOrigins}
+
+	for _, tc := range []struct {
+		name   string
+		method string
+		origin string
+		// status is the expected status. The handler answers with 200, and
+		// preflight requests are answered by the policy.
+		status  int
+		handled bool
+		allowed string
+	}{
+		{name: "NoOrigin", method: http.MethodPost, status: http.StatusOK, handled: true},
+		{name: "SameHost", method: http.MethodPost, origin: "http://preview.example.com", status: http.StatusOK, handled: true, allowed: "http://preview.example.com"},
+		{name: "Allowed", method: http.MethodPost, origin: "http://localhost:5173", status: http.StatusOK, handled: true, allowed: "http://localhost:5173"},
+		{name: "AllowedCase", method: http.MethodGet, origin: "http://LOCALHOST:5173", status: http.StatusOK, handled: true, allowed: "http://LOCALHOST:5173"},
+		{name: "Disallowed", method: http.MethodPost, origin: "https://evil.example.com", status: http.StatusForbidden},
+		{name: "DisallowedGet", method: http.MethodGet, origin: "https://evil.example.com", status: http.StatusForbidden},
+		{name: "Opaque", method: http.MethodPost, origin: "null", status: http.StatusForbidden},
+		{name: "Preflight", method: http.MethodOptions, origin: "http://127.0.0.1:5173", status: http.StatusOK, allowed: "http://127.0.0.1:5173"},
+		{name: "DisallowedPreflight", method: http.MethodOptions, origin: "https://evil.example.com", status: http.StatusForbidden},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var handled bool
+			handler := policy.cors(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				handled = true
+				w.WriteHeader(http.StatusOK)
+			}))
+
+			// A simple request, that browsers send without a preflight.
+			r := httptest.NewRequest(tc.method, "http://preview.example.com/uploads", strings.NewReader("data"))
+			r.Header.Set("Content-Type", "text/plain")
+			if tc.origin != "" {
+				r.Header.Set("Origin", tc.origin)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			assert.Equal(t, tc.status, w.Code)
+			assert.Equal(t, tc.handled, handled)
+			assert.Equal(t, tc.allowed, w.Header().Get("Access-Control-Allow-Origin"))
+		})
+	}
+}
+
+func TestWebPolicyAuth(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		name    string
+		token   string
+		method  string
+		header  string
+		query   string
+		handled bool
+	}{
+		{name: "Disabled", method: http.MethodGet, handled: true},
+		{name: "Header", token: "secret", method: http.MethodGet, header: "Bearer secret", handled: true},
+		{name: "Query", token: "secret", method: http.MethodGet, query: "?token=secret", handled: true},
+		{name: "Missing", token: "secret", method: http.MethodGet},
+		{name: "Wrong", token: "secret", method: http.MethodGet, header: "Bearer wrong"},
+		{name: "WrongScheme", token: "secret", method: http.MethodGet, header: "Basic secret"},
+		{name: "WrongQuery", token: "secret", method: http.MethodGet, query: "?token=secre"},
+		// Browsers send preflight requests without credentials.
+		{name: "Preflight", token: "secret", method: http.MethodOptions, handled: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var handled bool
+			handler := webPolicy{token: tc.token}.auth(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				handled = true
+				w.WriteHeader(http.StatusOK)
+			}))
+
+			r := httptest.NewRequest(tc.method, "/directories"+tc.query, nil)
+			if tc.header != "" {
+				r.Header.Set("Authorization", tc.header)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			require.Equal(t, tc.handled, handled)
+			if tc.handled {
+				assert.Equal(t, http.StatusOK, w.Code)
+				return
+			}
+			assert.Equal(t, http.StatusUnauthorized, w.Code)
+			assert.Equal(t, "Bearer", w.Header().Get("WWW-Authenticate"))
+		})
+	}
+}
+
+func TestLoggedQuery(t *testing.T) {
+	t.Parallel()
+
+	r := httptest.NewRequest(http.MethodGet, "/ws/demo?plan=plan.json&token=secret&delta=true", nil)
+	assert.Equal(t, "delta=true&plan=plan.json", loggedQuery(r))
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"errors"
+	"fmt"
 	"log"
 	"os"
 
@@ -16,6 +17,12 @@ func main() {
 
 	err := cmd.Invoke().WithOS().Run()
 	if err != nil {
+		// The output already has the diagnostics.
+		var exit *cli.ExitError
+		if errors.As(err, &exit) {
+			os.Exit(cli.ExitCode(err))
+		}
+
 		var diags hcl.Diagnostics
 		if errors.As(err, &diags) {
 			var files map[string]*hcl.File
@@ -28,7 +35,9 @@ func main() {
 				log.Printf("diagnostic writer: %s", werr.Error())
 			}
 		}
-		log.Fatal(err.Error())
-		os.Exit(1)
+		// A preview replaces the default logger, which then drops this, so
+		// the error is written directly.
+		_, _ = fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(cli.ExitCode(err))
 	}
 }
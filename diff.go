@@ -0,0 +1,359 @@
+package preview
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+
+	"github.com/coder/preview/types"
+)
+
+type ChangeKind string
+
+const (
+	ChangeParameterAdded   ChangeKind = "parameter_added"
+	ChangeParameterRemoved ChangeKind = "parameter_removed"
+	ChangeType             ChangeKind = "type_changed"
+	ChangeMutable          ChangeKind = "mutable_changed"
+	ChangeOptionAdded      ChangeKind = "option_added"
+	ChangeOptionRemoved    ChangeKind = "option_removed"
+	ChangeDefault          ChangeKind = "default_changed"
+	ChangeValidation       ChangeKind = "validation_changed"
+	ChangeTagAdded         ChangeKind = "tag_added"
+	ChangeTagRemoved       ChangeKind = "tag_removed"
+	ChangeTagValue         ChangeKind = "tag_changed"
+)
+
+// TemplateChange is a single difference between two versions of a template.
+type TemplateChange struct {
+	Kind ChangeKind `json:"kind"`
+	// Parameter is the name of the parameter the change is about, if any.
+	Parameter string `json:"parameter,omitempty"`
+	// Tag is the key of the workspace tag the change is about, if any.
+	Tag string `json:"tag,omitempty"`
+	// From and To are the old and new value, such as the type or the
+	// default, depending on the kind.
+	From string `json:"from,omitempty"`
+	To   string `json:"to,omitempty"`
+	// Breaking is set if existing workspaces, with the previewed inputs,
+	// cannot be updated to the new version as they are.
+	Breaking bool   `json:"breaking"`
+	Detail   string `json:"detail"`
+}
+
+// TemplateDiff is what changes for existing workspaces when a template is
+// updated to a new version.
+type TemplateDiff struct {
+	Changes []TemplateChange `json:"changes"`
+}
+
+// Breaking returns true if any change is breaking.
+func (d TemplateDiff) Breaking() bool {
+	return slices.ContainsFunc(d.Changes, func(c TemplateChange) bool { return c.Breaking })
+}
+
+// DiffTemplates previews both versions of a template with the same input,
+// and reports the differences of the parameters and workspace tags. The
+// input stands for an existing workspace, so its parameter values decide
+// whether a change is breaking, such as a removed option that is selected.
+//
+// The diagnostics of each preview are returned with their summary prefixed
+// by the version they belong to.
+func DiffTemplates(ctx context.Context, input Input, from, to fs.FS) (*TemplateDiff, hcl.Diagnostics) {
+	fromOutput, fromDiags := Preview(ctx, input, from)
+	toOutput, toDiags := Preview(ctx, input, to)
+	diags := versionDiagnostics("old version", fromDiags).Extend(versionDiagnostics("new version", toDiags))
+	if fromOutput == nil || toOutput == nil {
+		return nil, diags
+	}
+	return DiffOutputs(fromOutput, toOutput, input.ParameterValues), diags
+}
+
+// versionDiagnostics returns copies of the diagnostics, with the version in
+// their summary.
+func versionDiagnostics(version string, diags hcl.Diagnostics) hcl.Diagnostics {
+	prefixed := make(hcl.Diagnostics, 0, len(diags))
+	for _, diag := range diags {
+		cpy := *diag
+		cpy.Summary = fmt.Sprintf("%s: %s", version, diag.Summary)
+		prefixed = append(prefixed, &cpy)
+	}
+	return prefixed
+}
+
+// DiffOutputs returns the differences between the previews of two versions
+// of a template. The values are the parameter values both were previewed
+// with. The parameters are ordered as in the new version, followed by the
+// removed ones, and the tags by key.
+func DiffOutputs(from, to *Output, values map[string]string) *TemplateDiff {
+	diff := &TemplateDiff{Changes: make([]TemplateChange, 0)}
+
+	fromParams := make(map[string]types.Parameter, len(from.Parameters))
+	for _, p := range from.Parameters {
+		fromParams[p.Name] = p
+	}
+	toParams := make(map[string]bool, len(to.Parameters))
+	for _, p := range to.Parameters {
+		toParams[p.Name] = true
+
+		old, ok := fromParams[p.Name]
+		if !ok {
+			change := TemplateChange{
+				Kind:      ChangeParameterAdded,
+				Parameter: p.Name,
+				Detail:    "The parameter is new.",
+			}
+			_, given := values[p.Name]
+			switch {
+			case !p.Required && parameterHasDefault(p):
+			case given && !hcl.Diagnostics(p.Diagnostics).HasErrors():
+				change.Detail = "The parameter is new and has no default, but the inputs give it a valid value."
+			default:
+				change.Breaking = true
+				change.Detail = "The parameter is new and has no default, so existing workspaces must set a value to update."
+			}
+			diff.Changes = append(diff.Changes, change)
+			continue
+		}
+		diff.Changes = append(diff.Changes, diffParameter(old, p)...)
+	}
+	for _, p := range from.Parameters {
+		if toParams[p.Name] {
+			continue
+		}
+		diff.Changes = append(diff.Changes, TemplateChange{
+			Kind:      ChangeParameterRemoved,
+			Parameter: p.Name,
+			From:      p.Value.AsString(),
+			Detail:    "The parameter was removed, and the value of existing workspaces is dropped.",
+		})
+	}
+
+	diff.Changes = append(diff.Changes, diffTags(from.WorkspaceTags.Tags(), to.WorkspaceTags.Tags())...)
+	return diff
+}
+
+func diffParameter(from, to types.Parameter) []TemplateChange {
+	var changes []TemplateChange
+	change := func(c TemplateChange) {
+		c.Parameter = to.Name
+		changes = append(changes, c)
+	}
+
+	// The value of an existing workspace, with the previewed inputs. An
+	// unknown value cannot break.
+	value, known := from.Value.AsString(), from.Value.IsKnown()
+
+	if from.Type != to.Type {
+		change(TemplateChange{
+			Kind:     ChangeType,
+			From:     string(from.Type),
+			To:       string(to.Type),
+			Breaking: true,
+			Detail:   "The type changed, so the value of existing workspaces may no longer be accepted.",
+		})
+	}
+
+	if from.Mutable != to.Mutable {
+		detail := "The parameter became immutable, so existing workspaces can no longer change it."
+		if to.Mutable {
+			detail = "The parameter became mutable."
+		}
+		change(TemplateChange{
+			Kind:   ChangeMutable,
+			From:   fmt.Sprint(from.Mutable),
+			To:     fmt.Sprint(to.Mutable),
+			Detail: detail,
+		})
+	}
+
+	if fromDefault, toDefault := from.DefaultValue.AsString(), to.DefaultValue.AsString(); fromDefault != toDefault {
+		change(TemplateChange{
+			Kind:   ChangeDefault,
+			From:   fromDefault,
+			To:     toDefault,
+			Detail: "The default changed. Existing workspaces keep their value.",
+		})
+	}
+
+	fromOptions, toOptions := optionValues(from), optionValues(to)
+	for _, opt := range toOptions {
+		if !slices.Contains(fromOptions, opt) {
+			change(TemplateChange{
+				Kind:   ChangeOptionAdded,
+				To:     opt,
+				Detail: "The option is new.",
+			})
+		}
+	}
+	for _, opt := range fromOptions {
+		if slices.Contains(toOptions, opt) {
+			continue
+		}
+		c := TemplateChange{
+			Kind:   ChangeOptionRemoved,
+			From:   opt,
+			Detail: "The option was removed.",
+		}
+		if known && slices.Contains(selectedValues(from, value), opt) {
+			c.Breaking = true
+			c.Detail = "The option was removed, but it is selected, so existing workspaces must choose another one to update."
+		}
+		change(c)
+	}
+
+	changes = append(changes, diffValidations(from, to, value, known)...)
+	return changes
+}
+
+// diffValidations reports the validations that are new, removed or changed.
+// A change is breaking if the new validation rejects the known value.
+func diffValidations(from, to types.Parameter, value string, known bool) []TemplateChange {
+	fromDesc, toDesc := validationDescriptions(from), validationDescriptions(to)
+	if slices.Equal(fromDesc, toDesc) {
+		return nil
+	}
+
+	verb := "changed"
+	if validationTightened(from.Validations, to.Validations) {
+		verb = "is stricter"
+	}
+	c := TemplateChange{
+		Kind:      ChangeValidation,
+		Parameter: to.Name,
+		From:      strings.Join(fromDesc, ", "),
+		To:        strings.Join(toDesc, ", "),
+		Detail:    fmt.Sprintf("The validation %s, and still accepts the value.", verb),
+	}
+	if !known {
+		c.Detail = fmt.Sprintf("The validation %s.", verb)
+		return []TemplateChange{c}
+	}
+	for _, v := range to.Validations {
+		if err := v.Valid(string(to.Type), value); err != nil {
+			c.Breaking = true
+			c.Detail = fmt.Sprintf("The validation %s, and rejects the value of existing workspaces: %s", verb, err.Error())
+			break
+		}
+	}
+	return []TemplateChange{c}
+}
+
+// validationTightened returns true if the new validation may reject values
+// the old one accepted: a higher minimum, a lower maximum, or a new regex or
+// monotonic constraint.
+func validationTightened(from, to []*types.ParameterValidation) bool {
+	var old types.ParameterValidation
+	if len(from) > 0 {
+		old = *from[0]
+	}
+	for _, v := range to {
+		switch {
+		case v.Min != nil && (old.Min == nil || *v.Min > *old.Min),
+			v.Max != nil && (old.Max == nil || *v.Max < *old.Max),
+			v.Regex != nil && (old.Regex == nil || *v.Regex != *old.Regex),
+			v.Monotonic != nil && old.Monotonic == nil:
+			return true
+		}
+	}
+	return false
+}
+
+// validationDescriptions describes each set validation attribute, such as
+// 'min=1'.
+func validationDescriptions(p types.Parameter) []string {
+	var desc []string
+	for _, v := range p.Validations {
+		if v.Min != nil {
+			desc = append(desc, fmt.Sprintf("min=%d", *v.Min))
+		}
+		if v.Max != nil {
+			desc = append(desc, fmt.Sprintf("max=%d", *v.Max))
+		}
+		if v.Regex != nil {
+			desc = append(desc, fmt.Sprintf("regex=%q", *v.Regex))
+		}
+		if v.Monotonic != nil {
+			desc = append(desc, fmt.Sprintf("monotonic=%s", *v.Monotonic))
+		}
+		if v.Invalid != nil && *v.Invalid {
+			desc = append(desc, "invalid")
+		}
+	}
+	return desc
+}
+
+func diffTags(from, to map[string]string) []TemplateChange {
+	var changes []TemplateChange
+	const detail = "Builds of existing workspaces need a provisioner with the new tags."
+	for _, key := range slices.Sorted(maps.Keys(to)) {
+		old, ok := from[key]
+		switch {
+		case !ok:
+			changes = append(changes, TemplateChange{
+				Kind:     ChangeTagAdded,
+				Tag:      key,
+				To:       to[key],
+				Breaking: true,
+				Detail:   detail,
+			})
+		case old != to[key]:
+			changes = append(changes, TemplateChange{
+				Kind:     ChangeTagValue,
+				Tag:      key,
+				From:     old,
+				To:       to[key],
+				Breaking: true,
+				Detail:   detail,
+			})
+		}
+	}
+	for _, key := range slices.Sorted(maps.Keys(from)) {
+		if _, ok := to[key]; ok {
+			continue
+		}
+		changes = append(changes, TemplateChange{
+			Kind:     ChangeTagRemoved,
+			Tag:      key,
+			From:     from[key],
+			Breaking: true,
+			Detail:   detail,
+		})
+	}
+	return changes
+}
+
+func optionValues(p types.Parameter) []string {
+	values := make([]string, 0, len(p.Options))
+	for _, opt := range p.Options {
+		values = append(values, opt.Value.AsString())
+	}
+	return values
+}
+
+// selectedValues returns the values of the options the value selects. A
+// multi-select value is a JSON array.
+func selectedValues(p types.Parameter, value string) []string {
+	if p.Type != types.ParameterTypeListString {
+		return []string{value}
+	}
+	var selected []string
+	if err := json.Unmarshal([]byte(value), &selected); err != nil {
+		return nil
+	}
+	return selected
+}
+
+// parameterHasDefault returns true if the parameter block sets a default.
+func parameterHasDefault(p types.Parameter) bool {
+	if p.Source == nil {
+		return p.DefaultValue.AsString() != ""
+	}
+	return !p.Source.GetAttribute("default").IsNil()
+}
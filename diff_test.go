@@ -0,0 +1,161 @@
+package preview_test
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/coder/preview"
+)
+
+func TestDiffTemplates(t *testing.T) {
+	t.Parallel()
+
+	from := fstest.MapFS{
+		"main.tf": &fstest.MapFile{Data: []byte(`
+data "coder_parameter" "region" {
+  name    = "region"
+  type    = "string"
+  default = "us"
+  mutable = true
+
+  option {
+    name  = "US"
+    value = "us"
+  }
+  option {
+    name  = "EU"
+    value = "eu"
+  }
+}
+
+data "coder_parameter" "cpu" {
+  name    = "cpu"
+  type    = "number"
+  default = 2
+  validation {
+    min   = 1
+    max   = 8
+    error = "cpu must be between 1 and 8"
+  }
+}
+
+data "coder_parameter" "legacy" {
+  name    = "legacy"
+  default = "x"
+}
+
+data "coder_workspace_tags" "tags" {
+  tags = {
+    "region" = data.coder_parameter.region.value
+  }
+}
+`)},
+	}
+	to := fstest.MapFS{
+		"main.tf": &fstest.MapFile{Data: []byte(`
+data "coder_parameter" "region" {
+  name    = "region"
+  type    = "string"
+  default = "us"
+  mutable = false
+
+  option {
+    name  = "US"
+    value = "us"
+  }
+  option {
+    name  = "Asia"
+    value = "ap"
+  }
+}
+
+data "coder_parameter" "cpu" {
+  name    = "cpu"
+  type    = "number"
+  default = 4
+  validation {
+    min   = 4
+    max   = 8
+    error = "cpu must be between 4 and 8"
+  }
+}
+
+data "coder_parameter" "image" {
+  name = "image"
+}
+
+data "coder_parameter" "editor" {
+  name    = "editor"
+  default = "vim"
+}
+
+data "coder_workspace_tags" "tags" {
+  tags = {
+    "region" = data.coder_parameter.region.value
+    "pool"   = "shared"
+  }
+}
+`)},
+	}
+
+	type change struct {
+		kind     preview.ChangeKind
+		subject  string
+		breaking bool
+	}
+	changes := func(diff *preview.TemplateDiff) []change {
+		got := make([]change, 0, len(diff.Changes))
+		for _, c := range diff.Changes {
+			subject := c.Parameter
+			if c.Tag != "" {
+				subject = c.Tag
+			}
+			got = append(got, change{kind: c.Kind, subject: subject, breaking: c.Breaking})
+		}
+		return got
+	}
+
+	t.Run("Defaults", func(t *testing.T) {
+		t.Parallel()
+
+		diff, diags := preview.DiffTemplates(t.Context(), preview.Input{}, from, to)
+		require.False(t, diags.HasErrors(), diags.Error())
+		assert.ElementsMatch(t, []change{
+			{kind: preview.ChangeMutable, subject: "region"},
+			{kind: preview.ChangeOptionAdded, subject: "region"},
+			{kind: preview.ChangeOptionRemoved, subject: "region"},
+			{kind: preview.ChangeDefault, subject: "cpu"},
+			{kind: preview.ChangeValidation, subject: "cpu", breaking: true},
+			{kind: preview.ChangeParameterAdded, subject: "image", breaking: true},
+			{kind: preview.ChangeParameterAdded, subject: "editor"},
+			{kind: preview.ChangeParameterRemoved, subject: "legacy"},
+			{kind: preview.ChangeTagAdded, subject: "pool", breaking: true},
+		}, changes(diff))
+		assert.True(t, diff.Breaking())
+	})
+
+	t.Run("SelectedOption", func(t *testing.T) {
+		t.Parallel()
+
+		diff, diags := preview.DiffTemplates(t.Context(), preview.Input{
+			ParameterValues: map[string]string{"region": "eu", "cpu": "6"},
+		}, from, to)
+		require.NotNil(t, diff, diags.Error())
+
+		got := changes(diff)
+		assert.Contains(t, got, change{kind: preview.ChangeOptionRemoved, subject: "region", breaking: true})
+		assert.Contains(t, got, change{kind: preview.ChangeValidation, subject: "cpu"})
+	})
+	t.Run("NewParameterWithValue", func(t *testing.T) {
+		t.Parallel()
+
+		diff, diags := preview.DiffTemplates(t.Context(), preview.Input{
+			ParameterValues: map[string]string{"image": "ubuntu"},
+		}, from, to)
+		require.NotNil(t, diff, diags.Error())
+		assert.Contains(t, changes(diff), change{kind: preview.ChangeParameterAdded, subject: "image"})
+	})
+}
@@ -0,0 +1,224 @@
+package preview
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/aquasecurity/trivy/pkg/iac/terraform"
+	tfcontext "github.com/aquasecurity/trivy/pkg/iac/terraform/context"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// ExpressionFilename is the filename of the ranges in the diagnostics of
+// EvaluateExpression.
+const ExpressionFilename = "<expression>"
+
+// ModuleContext is the evaluation context of a module after a preview. It
+// holds the values the blocks of the module evaluated to, such as 'data',
+// 'local' and 'module'.
+type ModuleContext struct {
+	// Name is the full name of the module block, such as 'module.x' or
+	// 'module.x.module.y', or empty for the root module.
+	Name    string
+	Context *tfcontext.Context
+}
+
+// ModuleContexts returns the evaluation context of each module, in the order
+// of the modules. A module without blocks has no context and is left out.
+func ModuleContexts(modules terraform.Modules) []ModuleContext {
+	contexts := make([]ModuleContext, 0, len(modules))
+	for _, mod := range modules {
+		blocks := mod.GetBlocks()
+		if len(blocks) == 0 || blocks[0].Context() == nil {
+			continue
+		}
+
+		var name string
+		if mb := blocks[0].ModuleBlock(); mb != nil {
+			name = mb.FullName()
+		}
+		// Every module is evaluated with its own context, and each block has
+		// a child of it.
+		contexts = append(contexts, ModuleContext{
+			Name:    name,
+			Context: blocks[0].Context().Root(),
+		})
+	}
+	return contexts
+}
+
+// EvaluateExpression parses the HCL expression and evaluates it in the
+// context, such as that of a module.
+//
+// The references of the expression are followed one step at a time first. A
+// reference that cannot be followed is an error that names the part of the
+// reference that failed, and what is available instead. A reference that is
+// unknown is a warning that names the part of it that is unknown. The value
+// is cty.DynamicVal if there are errors.
+func EvaluateExpression(evalCtx *tfcontext.Context, src string) (cty.Value, hcl.Diagnostics) {
+	expr, diags := hclsyntax.ParseExpression([]byte(src), ExpressionFilename, hcl.InitialPos)
+	if diags.HasErrors() {
+		return cty.DynamicVal, diags
+	}
+
+	for _, trav := range expr.Variables() {
+		diags = diags.Extend(traversalDiagnostics(evalCtx, trav))
+	}
+	if diags.HasErrors() {
+		return cty.DynamicVal, diags
+	}
+
+	val, valDiags := expr.Value(evalCtx.Inner())
+	return val, diags.Extend(valDiags)
+}
+
+// traversalDiagnostics follows the traversal from its root variable, and
+// returns an error for the first step that fails, or a warning for the
+// first step that is unknown.
+func traversalDiagnostics(evalCtx *tfcontext.Context, trav hcl.Traversal) hcl.Diagnostics {
+	rng := trav.SourceRange()
+	root := trav.RootName()
+	val, ok := lookupVariable(evalCtx, root)
+	if !ok {
+		return hcl.Diagnostics{{
+			Severity: hcl.DiagError,
+			Summary:  fmt.Sprintf("Reference to undefined %q", root),
+			Detail:   fmt.Sprintf("Defined are %s.", strings.Join(variableNames(evalCtx), ", ")),
+			Subject:  &rng,
+		}}
+	}
+
+	path := root
+	for _, step := range trav[1:] {
+		if !val.IsKnown() {
+			return hcl.Diagnostics{{
+				Severity: hcl.DiagWarning,
+				Summary:  fmt.Sprintf("%s is unknown", path),
+				Detail:   fmt.Sprintf("%s and everything referenced through it, such as %s, is unknown.", path, traversalString(trav)),
+				Subject:  &rng,
+			}}
+		}
+		if val.IsNull() {
+			return hcl.Diagnostics{{
+				Severity: hcl.DiagError,
+				Summary:  fmt.Sprintf("%s is null", path),
+				Detail:   fmt.Sprintf("%s cannot be followed by %s.", path, traverserString(step)),
+				Subject:  &rng,
+			}}
+		}
+
+		unmarked, _ := val.Unmark()
+		next, stepDiags := step.TraversalStep(unmarked)
+		if stepDiags.HasErrors() {
+			detail := stepDiags[0].Detail
+			if available := availableSteps(unmarked); available != "" {
+				detail = fmt.Sprintf("%s %s has %s.", detail, path, available)
+			}
+			return hcl.Diagnostics{{
+				Severity: hcl.DiagError,
+				Summary:  fmt.Sprintf("%s has no %s", path, traverserString(step)),
+				Detail:   detail,
+				Subject:  &rng,
+			}}
+		}
+		val = next
+		path += traverserString(step)
+	}
+
+	if !val.IsKnown() {
+		return hcl.Diagnostics{{
+			Severity: hcl.DiagWarning,
+			Summary:  fmt.Sprintf("%s is unknown", path),
+			Detail:   "The value is not known before the workspace is built, such as an attribute of a resource.",
+			Subject:  &rng,
+		}}
+	}
+	return nil
+}
+
+// lookupVariable returns the root variable from the context or its parents.
+func lookupVariable(evalCtx *tfcontext.Context, name string) (cty.Value, bool) {
+	for c := evalCtx; c != nil; c = c.Parent() {
+		if val, ok := c.Inner().Variables[name]; ok {
+			return val, true
+		}
+	}
+	return cty.NilVal, false
+}
+
+func variableNames(evalCtx *tfcontext.Context) []string {
+	var names []string
+	for c := evalCtx; c != nil; c = c.Parent() {
+		for name := range c.Inner().Variables {
+			if !slices.Contains(names, name) {
+				names = append(names, name)
+			}
+		}
+	}
+	slices.Sort(names)
+	return names
+}
+
+// availableSteps describes what the value can be followed by, such as its
+// attributes or keys.
+func availableSteps(val cty.Value) string {
+	typ := val.Type()
+	switch {
+	case typ.IsObjectType():
+		names := slices.Sorted(maps.Keys(typ.AttributeTypes()))
+		if len(names) == 0 {
+			return "no attributes"
+		}
+		return "the attributes " + strings.Join(names, ", ")
+	case typ.IsMapType() && val.IsKnown():
+		keys := make([]string, 0, val.LengthInt())
+		for it := val.ElementIterator(); it.Next(); {
+			key, _ := it.Element()
+			keys = append(keys, fmt.Sprintf("%q", key.AsString()))
+		}
+		if len(keys) == 0 {
+			return "no keys"
+		}
+		return "the keys " + strings.Join(keys, ", ")
+	case (typ.IsListType() || typ.IsTupleType()) && val.IsKnown():
+		if val.LengthInt() == 0 {
+			return "no elements"
+		}
+		return fmt.Sprintf("the indexes 0 to %d", val.LengthInt()-1)
+	default:
+		return ""
+	}
+}
+
+func traversalString(trav hcl.Traversal) string {
+	var str strings.Builder
+	for _, step := range trav {
+		str.WriteString(traverserString(step))
+	}
+	return str.String()
+}
+
+func traverserString(step hcl.Traverser) string {
+	switch step := step.(type) {
+	case hcl.TraverseRoot:
+		return step.Name
+	case hcl.TraverseAttr:
+		return "." + step.Name
+	case hcl.TraverseIndex:
+		if step.Key.Type() == cty.String && step.Key.IsKnown() {
+			return fmt.Sprintf("[%q]", step.Key.AsString())
+		}
+		if step.Key.Type() == cty.Number && step.Key.IsKnown() {
+			return fmt.Sprintf("[%s]", step.Key.AsBigFloat().Text('f', -1))
+		}
+		return "[?]"
+	case hcl.TraverseSplat:
+		return "[*]"
+	default:
+		return "?"
+	}
+}
@@ -0,0 +1,118 @@
+package preview_test
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+
+	"github.com/coder/preview"
+)
+
+func TestEvaluateExpression(t *testing.T) {
+	t.Parallel()
+
+	dir := fstest.MapFS{
+		"main.tf": &fstest.MapFile{Data: []byte(`
+data "coder_parameter" "region" {
+  name    = "region"
+  default = "us"
+}
+
+locals {
+  word_bank = ["alpha", "bravo"]
+}
+
+module "x" {
+  source = "./modules/x"
+  input  = data.coder_parameter.region.value
+}
+`)},
+		"modules/x/main.tf": &fstest.MapFile{Data: []byte(`
+variable "input" {}
+
+locals {
+  upper = upper(var.input)
+}
+
+output "upper" {
+  value = local.upper
+}
+`)},
+	}
+
+	output, diags := preview.Preview(t.Context(), preview.Input{
+		ParameterValues: map[string]string{"region": "eu"},
+	}, dir)
+	require.False(t, diags.HasErrors(), diags.Error())
+
+	contexts := preview.ModuleContexts(output.Modules)
+	require.Len(t, contexts, 2)
+	require.Equal(t, "", contexts[0].Name)
+	require.Equal(t, "module.x", contexts[1].Name)
+	root, module := contexts[0].Context, contexts[1].Context
+
+	for _, tc := range []struct {
+		name     string
+		ctx      int
+		expr     string
+		expected cty.Value
+		// summary is that of the only diagnostic, if any.
+		summary  string
+		severity hcl.DiagnosticSeverity
+	}{
+		{name: "Parameter", expr: "data.coder_parameter.region.value", expected: cty.StringVal("eu")},
+		{name: "Local", expr: "local.word_bank[1]", expected: cty.StringVal("bravo")},
+		{name: "ModuleOutput", expr: "module.x.upper", expected: cty.StringVal("EU")},
+		{name: "InModule", ctx: 1, expr: `"${local.upper}-${var.input}"`, expected: cty.StringVal("EU-eu")},
+		{
+			name:     "MissingAttribute",
+			expr:     "data.coder_parameter.regoin.value",
+			summary:  "data.coder_parameter has no .regoin",
+			severity: hcl.DiagError,
+		},
+		{
+			name:     "MissingIndex",
+			expr:     "local.word_bank[2]",
+			summary:  "local.word_bank has no [2]",
+			severity: hcl.DiagError,
+		},
+		{
+			name:     "Undefined",
+			expr:     "foo.bar",
+			summary:  `Reference to undefined "foo"`,
+			severity: hcl.DiagError,
+		},
+		{
+			name:     "NotInModule",
+			ctx:      1,
+			expr:     "data.coder_parameter.region.value",
+			summary:  "data has no .coder_parameter",
+			severity: hcl.DiagError,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			evalCtx := root
+			if tc.ctx == 1 {
+				evalCtx = module
+			}
+			val, diags := preview.EvaluateExpression(evalCtx, tc.expr)
+			if tc.summary == "" {
+				require.Empty(t, diags, diags.Error())
+				assert.True(t, tc.expected.RawEquals(val), "got %s", val.GoString())
+				return
+			}
+
+			require.Len(t, diags, 1)
+			assert.Equal(t, tc.summary, diags[0].Summary)
+			assert.Equal(t, tc.severity, diags[0].Severity)
+			require.NotNil(t, diags[0].Subject)
+			assert.Equal(t, preview.ExpressionFilename, diags[0].Subject.Filename)
+		})
+	}
+}
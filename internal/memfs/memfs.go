@@ -0,0 +1,187 @@
+// Package memfs is a read-only file system of files held in memory, for
+// template copies such as cached directories, archives and unsaved edits.
+package memfs
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"maps"
+	"path"
+	"slices"
+	"strings"
+	"time"
+)
+
+// File is a file, or a directory if its mode says so.
+type File struct {
+	Data    []byte
+	Mode    fs.FileMode
+	ModTime time.Time
+}
+
+// FS maps slash-separated paths to files. Directories are implied by the
+// paths of the files in them, and only need an entry of their own if they
+// are empty, or for their mode and modification time. An FS must not be
+// modified while it is read, and is then safe for concurrent use.
+type FS map[string]*File
+
+var (
+	_ fs.ReadDirFS  = FS(nil)
+	_ fs.ReadFileFS = FS(nil)
+	_ fs.StatFS     = FS(nil)
+)
+
+func (m FS) Open(name string) (fs.File, error) {
+	info, err := m.stat("open", name)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return &openFile{Reader: bytes.NewReader(info.file.Data), info: info}, nil
+	}
+	entries, err := m.ReadDir(name)
+	if err != nil {
+		return nil, err
+	}
+	return &openDir{info: info, entries: entries}, nil
+}
+
+func (m FS) Stat(name string) (fs.FileInfo, error) {
+	info, err := m.stat("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+func (m FS) ReadFile(name string) ([]byte, error) {
+	info, err := m.stat("read", name)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: errIsDir}
+	}
+	return bytes.Clone(info.file.Data), nil
+}
+
+// ReadDir returns the entries of the directory, sorted by name.
+func (m FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	info, err := m.stat("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errNotDir}
+	}
+
+	prefix := name + "/"
+	if name == "." {
+		prefix = ""
+	}
+	children := make(map[string]*fileInfo)
+	for key, file := range m {
+		rest, ok := strings.CutPrefix(key, prefix)
+		if !ok || rest == "" || key == "." {
+			continue
+		}
+		child, nested := rest, false
+		if idx := strings.IndexByte(rest, '/'); idx >= 0 {
+			child, nested = rest[:idx], true
+		}
+		if !nested {
+			children[child] = &fileInfo{name: child, file: file}
+		} else if _, ok := children[child]; !ok {
+			// The entry of the directory itself, if any, replaces this.
+			children[child] = &fileInfo{name: child, file: &File{Mode: fs.ModeDir | 0o555}}
+		}
+	}
+
+	entries := make([]fs.DirEntry, 0, len(children))
+	for _, child := range slices.Sorted(maps.Keys(children)) {
+		entries = append(entries, children[child])
+	}
+	return entries, nil
+}
+
+// stat returns the file or directory at the path. Directories without an
+// entry of their own exist if a file is below them.
+func (m FS) stat(op, name string) (*fileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	if file, ok := m[name]; ok {
+		return &fileInfo{name: path.Base(name), file: file}, nil
+	}
+	implied := &fileInfo{name: path.Base(name), file: &File{Mode: fs.ModeDir | 0o555}}
+	if name == "." {
+		return implied, nil
+	}
+	for key := range m {
+		if strings.HasPrefix(key, name+"/") {
+			return implied, nil
+		}
+	}
+	return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+}
+
+var (
+	errIsDir  = errors.New("is a directory")
+	errNotDir = errors.New("not a directory")
+)
+
+// fileInfo describes a file, both as fs.FileInfo and fs.DirEntry.
+type fileInfo struct {
+	name string
+	file *File
+}
+
+func (i *fileInfo) Name() string               { return i.name }
+func (i *fileInfo) Size() int64                { return int64(len(i.file.Data)) }
+func (i *fileInfo) Mode() fs.FileMode          { return i.file.Mode }
+func (i *fileInfo) Type() fs.FileMode          { return i.file.Mode.Type() }
+func (i *fileInfo) ModTime() time.Time         { return i.file.ModTime }
+func (i *fileInfo) IsDir() bool                { return i.file.Mode.IsDir() }
+func (i *fileInfo) Sys() any                   { return nil }
+func (i *fileInfo) Info() (fs.FileInfo, error) { return i, nil }
+func (i *fileInfo) String() string             { return fs.FormatFileInfo(i) }
+
+// openFile is an open file. The reader also provides io.Seeker and
+// io.ReaderAt.
+type openFile struct {
+	*bytes.Reader
+	info *fileInfo
+}
+
+func (f *openFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+func (f *openFile) Close() error               { return nil }
+
+// openDir is an open directory.
+type openDir struct {
+	info    *fileInfo
+	entries []fs.DirEntry
+	offset  int
+}
+
+func (d *openDir) Stat() (fs.FileInfo, error) { return d.info, nil }
+func (d *openDir) Close() error               { return nil }
+
+func (d *openDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.info.name, Err: errIsDir}
+}
+
+func (d *openDir) ReadDir(count int) ([]fs.DirEntry, error) {
+	remaining := d.entries[d.offset:]
+	if count <= 0 {
+		d.offset = len(d.entries)
+		return remaining, nil
+	}
+	if len(remaining) == 0 {
+		return nil, io.EOF
+	}
+	count = min(count, len(remaining))
+	d.offset += count
+	return remaining[:count], nil
+}
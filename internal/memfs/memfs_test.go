@@ -0,0 +1,69 @@
+package memfs_test
+
+import (
+	"io/fs"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/coder/preview/internal/memfs"
+)
+
+func TestFS(t *testing.T) {
+	t.Parallel()
+
+	modTime := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	dir := memfs.FS{
+		"main.tf":               {Data: []byte(`locals {}`), Mode: 0o644, ModTime: modTime},
+		"modules/child/main.tf": {Data: []byte(`locals { a = 1 }`), Mode: 0o600},
+		"modules":               {Mode: fs.ModeDir | 0o700, ModTime: modTime},
+		"empty":                 {Mode: fs.ModeDir | 0o755},
+	}
+	require.NoError(t, fstest.TestFS(dir, "main.tf", "modules/child/main.tf", "empty"))
+
+	data, err := fs.ReadFile(dir, "modules/child/main.tf")
+	require.NoError(t, err)
+	assert.Equal(t, `locals { a = 1 }`, string(data))
+
+	// Directories keep the mode of their entry, and are implied otherwise.
+	info, err := fs.Stat(dir, "modules")
+	require.NoError(t, err)
+	assert.Equal(t, fs.ModeDir|0o700, info.Mode())
+	assert.Equal(t, modTime, info.ModTime())
+	info, err = fs.Stat(dir, "modules/child")
+	require.NoError(t, err)
+	assert.True(t, info.IsDir())
+
+	entries, err := fs.ReadDir(dir, ".")
+	require.NoError(t, err)
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	assert.Equal(t, []string{"empty", "main.tf", "modules"}, names)
+
+	for _, name := range []string{"missing.tf", "modules/missing", "main.tf/x"} {
+		_, err := dir.Open(name)
+		assert.ErrorIs(t, err, fs.ErrNotExist, name)
+	}
+	for _, name := range []string{"/main.tf", "../main.tf", "modules/"} {
+		_, err := dir.Open(name)
+		assert.ErrorIs(t, err, fs.ErrInvalid, name)
+	}
+	_, err = fs.ReadFile(dir, "modules")
+	assert.Error(t, err)
+	_, err = fs.ReadDir(dir, "main.tf")
+	assert.Error(t, err)
+}
+
+func TestFSEmpty(t *testing.T) {
+	t.Parallel()
+
+	require.NoError(t, fstest.TestFS(memfs.FS{}))
+	entries, err := fs.ReadDir(memfs.FS{}, ".")
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
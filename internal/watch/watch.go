@@ -0,0 +1,241 @@
+// Package watch reports changes to the files of templates on disk, for the
+// watch mode of the CLI and the hot reload of the web server.
+package watch
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+const (
+	// debounce groups the burst of events an editor makes when saving.
+	debounce = 100 * time.Millisecond
+	// DefaultPoll is how often files are checked if filesystem
+	// notifications are not available, and no interval is given.
+	DefaultPoll = time.Second
+)
+
+// Options configure a Watcher.
+type Options struct {
+	// Dir is watched recursively.
+	Dir string
+	// Files are watched in addition to Dir, and may be outside of it.
+	Files []string
+	// Key returns the group a change to the absolute path belongs to, and
+	// whether the change is reported at all. Changes are debounced per
+	// group. If nil, every change is reported in one group.
+	Key func(path string) (string, bool)
+	// Changed is called with the group once its burst of changes settles.
+	Changed func(key string)
+	// Poll is how often files are checked if filesystem notifications are
+	// not available.
+	Poll time.Duration
+	// Unavailable is called with the reason filesystem notifications are not
+	// available, before polling starts.
+	Unavailable func(err error)
+}
+
+// Watcher reports changes to the files in a directory, and to individual
+// files. It uses filesystem notifications where available, and otherwise
+// polls.
+type Watcher struct {
+	opts  Options
+	dir   string
+	files []string
+
+	mu     sync.Mutex
+	timers map[string]*time.Timer
+}
+
+func New(opts Options) *Watcher {
+	if opts.Poll <= 0 {
+		opts.Poll = DefaultPoll
+	}
+	if opts.Key == nil {
+		opts.Key = func(string) (string, bool) { return "", true }
+	}
+	files := make([]string, 0, len(opts.Files))
+	for _, path := range opts.Files {
+		files = append(files, absPath(path))
+	}
+	return &Watcher{
+		opts:   opts,
+		dir:    absPath(opts.Dir),
+		files:  files,
+		timers: make(map[string]*time.Timer),
+	}
+}
+
+// Run watches the files until the context is canceled.
+func (w *Watcher) Run(ctx context.Context) {
+	err := w.notify(ctx)
+	if err == nil || ctx.Err() != nil {
+		return
+	}
+	if w.opts.Unavailable != nil {
+		w.opts.Unavailable(err)
+	}
+	w.pollChanges(ctx)
+}
+
+func (w *Watcher) notify(ctx context.Context) error {
+	fw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("create watcher: %w", err)
+	}
+	defer fw.Close()
+
+	// fsnotify does not watch recursively, so every directory is added.
+	err = filepath.WalkDir(w.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if skip(path) {
+			return filepath.SkipDir
+		}
+		return fw.Add(path)
+	})
+	if err != nil {
+		return fmt.Errorf("watch %q: %w", w.dir, err)
+	}
+	// Editors replace files when saving, so the directories of the files
+	// are watched instead of the files.
+	for _, path := range w.files {
+		if err := fw.Add(filepath.Dir(path)); err != nil {
+			return fmt.Errorf("watch %q: %w", path, err)
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err, ok := <-fw.Errors:
+			if !ok {
+				return nil
+			}
+			return err
+		case event, ok := <-fw.Events:
+			if !ok {
+				return nil
+			}
+			if event.Has(fsnotify.Create) {
+				if info, err := os.Stat(event.Name); err == nil && info.IsDir() && !skip(event.Name) {
+					_ = fw.Add(event.Name)
+				}
+			}
+			if event.Has(fsnotify.Chmod) && !event.Has(fsnotify.Write) {
+				continue
+			}
+			w.changed(event.Name)
+		}
+	}
+}
+
+func (w *Watcher) pollChanges(ctx context.Context) {
+	ticker := time.NewTicker(w.opts.Poll)
+	defer ticker.Stop()
+
+	last := w.signatures()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		current := w.signatures()
+		for path, sig := range current {
+			if last[path] != sig {
+				w.changed(path)
+			}
+		}
+		for path := range last {
+			if _, ok := current[path]; !ok {
+				w.changed(path)
+			}
+		}
+		last = current
+	}
+}
+
+// signatures returns the size and modification time of every watched file,
+// by path.
+func (w *Watcher) signatures() map[string]string {
+	sigs := make(map[string]string)
+	write := func(path string, info fs.FileInfo) {
+		sigs[path] = fmt.Sprintf("%d %d", info.Size(), info.ModTime().UnixNano())
+	}
+
+	_ = filepath.WalkDir(w.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			if skip(path) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info, err := d.Info(); err == nil {
+			write(path, info)
+		}
+		return nil
+	})
+	for _, path := range w.files {
+		if info, err := os.Stat(path); err == nil {
+			write(path, info)
+		}
+	}
+	return sigs
+}
+
+// changed calls Changed for the group of the path, once the burst of
+// changes settles.
+func (w *Watcher) changed(path string) {
+	path = absPath(path)
+	// The directories of the files are watched, which may hold other files.
+	if rel, err := filepath.Rel(w.dir, path); (err != nil || !filepath.IsLocal(rel)) && !slices.Contains(w.files, path) {
+		return
+	}
+	key, ok := w.opts.Key(path)
+	if !ok {
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if timer, ok := w.timers[key]; ok {
+		timer.Reset(debounce)
+		return
+	}
+	w.timers[key] = time.AfterFunc(debounce, func() {
+		w.mu.Lock()
+		delete(w.timers, key)
+		w.mu.Unlock()
+		w.opts.Changed(key)
+	})
+}
+
+func absPath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
+
+// skip reports whether the directory is never read by a preview.
+func skip(path string) bool {
+	return filepath.Base(path) == "providers" && filepath.Base(filepath.Dir(path)) == ".terraform"
+}
@@ -0,0 +1,85 @@
+package watch
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatcher(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		name string
+		run  func(w *Watcher, ctx context.Context)
+	}{
+		{name: "Notify", run: (*Watcher).Run},
+		{name: "Poll", run: (*Watcher).pollChanges},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			root := t.TempDir()
+			outside := t.TempDir()
+			require.NoError(t, os.MkdirAll(filepath.Join(root, "a"), 0o755))
+			require.NoError(t, os.MkdirAll(filepath.Join(root, "b"), 0o755))
+			vars := filepath.Join(outside, "vars.yaml")
+			require.NoError(t, os.WriteFile(vars, []byte("a: 1"), 0o600))
+
+			changes := make(chan string, 10)
+			w := New(Options{
+				Dir:   root,
+				Files: []string{vars},
+				Key: func(path string) (string, bool) {
+					if filepath.Ext(path) == ".txt" {
+						return "", false
+					}
+					return filepath.Base(filepath.Dir(path)), true
+				},
+				Changed: func(key string) { changes <- key },
+				Poll:    10 * time.Millisecond,
+			})
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go tc.run(w, ctx)
+			// The watcher must be running before files change.
+			time.Sleep(100 * time.Millisecond)
+
+			expect := func(key string) {
+				t.Helper()
+				select {
+				case got := <-changes:
+					require.Equal(t, key, got)
+				case <-time.After(5 * time.Second):
+					t.Fatalf("no change of %q", key)
+				}
+			}
+
+			// A burst of changes is reported once.
+			for idx := range 3 {
+				require.NoError(t, os.WriteFile(filepath.Join(root, "a", "main.tf"), []byte{byte(idx)}, 0o600))
+			}
+			expect("a")
+
+			// Ignored files, and other files next to the extra files, are not
+			// reported.
+			require.NoError(t, os.WriteFile(filepath.Join(root, "b", "notes.txt"), []byte("x"), 0o600))
+			require.NoError(t, os.WriteFile(filepath.Join(outside, "other.tf"), []byte("x"), 0o600))
+			require.NoError(t, os.WriteFile(vars, []byte("a: 22"), 0o600))
+			expect(filepath.Base(outside))
+
+			require.NoError(t, os.Remove(filepath.Join(root, "a", "main.tf")))
+			expect("a")
+
+			select {
+			case key := <-changes:
+				t.Fatalf("unexpected change of %q", key)
+			case <-time.After(3 * debounce):
+			}
+		})
+	}
+}
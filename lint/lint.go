@@ -0,0 +1,209 @@
+// Package lint checks templates against best practices that a preview does
+// not enforce, such as parameters without a display name, or a mutable
+// parameter that decides the provisioner tags.
+package lint
+
+import (
+	"fmt"
+	"io/fs"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/aquasecurity/trivy/pkg/iac/terraform"
+	"github.com/hashicorp/hcl/v2"
+
+	"github.com/coder/preview"
+	"github.com/coder/preview/types"
+)
+
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+	// SeverityOff disables a rule.
+	SeverityOff Severity = "off"
+)
+
+// ParseSeverity returns the severity with the given name.
+func ParseSeverity(s string) (Severity, error) {
+	switch sev := Severity(s); sev {
+	case SeverityError, SeverityWarning, SeverityOff:
+		return sev, nil
+	default:
+		return "", fmt.Errorf("invalid severity %q, expected one of [error, warning, off]", s)
+	}
+}
+
+// Template is what the rules check: the output of a preview, and the files
+// it was previewed from.
+type Template struct {
+	// Dir is the template directory. Relative icon paths are resolved in
+	// it.
+	Dir fs.FS
+	// Icons is the directory that absolute icon paths, such as
+	// '/icon/go.svg', are resolved in. It is the static directory of a
+	// Coder deployment. Absolute icon paths are not checked if it is nil.
+	Icons fs.FS
+
+	Parameters    []types.Parameter
+	WorkspaceTags types.TagBlocks
+	Modules       terraform.Modules
+	Files         map[string]*hcl.File
+}
+
+// NewTemplate returns the template of a preview of the directory.
+func NewTemplate(dir fs.FS, output *preview.Output) Template {
+	return Template{
+		Dir:           dir,
+		Parameters:    output.Parameters,
+		WorkspaceTags: output.WorkspaceTags,
+		Modules:       output.Modules,
+		Files:         output.Files,
+	}
+}
+
+// sourceFiles returns the files of every module, so that comments can
+// suppress findings in any of them. Only the files of the root module are
+// in Files, so the others are read from Dir.
+func (t Template) sourceFiles() map[string]*hcl.File {
+	files := maps.Clone(t.Files)
+	if files == nil {
+		files = make(map[string]*hcl.File)
+	}
+	if t.Dir == nil {
+		return files
+	}
+	for _, module := range t.Modules {
+		for _, block := range module.GetBlocks() {
+			if block.HCLBlock() == nil {
+				continue
+			}
+			name := block.HCLBlock().DefRange.Filename
+			if _, ok := files[name]; ok {
+				continue
+			}
+			data, err := fs.ReadFile(t.Dir, name)
+			if err != nil {
+				// Modules outside the template directory cannot be read,
+				// and their findings cannot be suppressed.
+				files[name] = nil
+				continue
+			}
+			files[name] = &hcl.File{Bytes: data}
+		}
+	}
+	return files
+}
+
+// Rule is a single check. Its findings are reported with the code and
+// severity of the rule, unless a comment suppresses them.
+type Rule struct {
+	// Code identifies the rule in the severity configuration and in
+	// suppression comments.
+	Code string
+	// Description explains what the rule reports, and why.
+	Description string
+	// Severity is the default severity of the findings.
+	Severity Severity
+	// Check returns the findings of the rule. It only sets the summary,
+	// detail and range of each finding.
+	Check func(t Template) []Finding
+}
+
+// Finding is a single violation of a rule.
+type Finding struct {
+	Code     string   `json:"code"`
+	Severity Severity `json:"severity"`
+	Summary  string   `json:"summary"`
+	Detail   string   `json:"detail"`
+	// Range is the source the finding is about. Suppression comments apply
+	// to the line it starts on.
+	Range *hcl.Range `json:"-"`
+}
+
+// Diagnostic returns the finding as a diagnostic, with the code in the
+// summary.
+func (f Finding) Diagnostic() *hcl.Diagnostic {
+	severity := hcl.DiagWarning
+	if f.Severity == SeverityError {
+		severity = hcl.DiagError
+	}
+	return &hcl.Diagnostic{
+		Severity: severity,
+		Summary:  fmt.Sprintf("%s (%s)", f.Summary, f.Code),
+		Detail:   f.Detail,
+		Subject:  f.Range,
+	}
+}
+
+type Findings []Finding
+
+// Diagnostics returns every finding as a diagnostic.
+func (f Findings) Diagnostics() hcl.Diagnostics {
+	diags := make(hcl.Diagnostics, 0, len(f))
+	for _, finding := range f {
+		diags = append(diags, finding.Diagnostic())
+	}
+	return diags
+}
+
+type Options struct {
+	// Rules are the rules to run. Defaults to DefaultRules.
+	Rules []Rule
+	// Severity overrides the severity of rules by their code. SeverityOff
+	// disables a rule.
+	Severity map[string]Severity
+}
+
+// Lint runs the rules over the template, and returns the findings that are
+// not suppressed, ordered by file and position.
+func Lint(t Template, opts Options) (Findings, error) {
+	rules := opts.Rules
+	if rules == nil {
+		rules = DefaultRules()
+	}
+	for code := range opts.Severity {
+		if !slices.ContainsFunc(rules, func(r Rule) bool { return r.Code == code }) {
+			return nil, fmt.Errorf("unknown rule %q", code)
+		}
+	}
+
+	suppressed := parseSuppressions(t.sourceFiles())
+	findings := make(Findings, 0)
+	for _, rule := range rules {
+		severity := rule.Severity
+		if sev, ok := opts.Severity[rule.Code]; ok {
+			severity = sev
+		}
+		if severity == SeverityOff {
+			continue
+		}
+
+		for _, finding := range rule.Check(t) {
+			finding.Code = rule.Code
+			finding.Severity = severity
+			if suppressed.match(finding) {
+				continue
+			}
+			findings = append(findings, finding)
+		}
+	}
+
+	slices.SortStableFunc(findings, func(a, b Finding) int {
+		switch {
+		case a.Range == nil && b.Range == nil:
+			return 0
+		case a.Range == nil:
+			return 1
+		case b.Range == nil:
+			return -1
+		}
+		if c := strings.Compare(a.Range.Filename, b.Range.Filename); c != 0 {
+			return c
+		}
+		return a.Range.Start.Byte - b.Range.Start.Byte
+	})
+	return findings, nil
+}
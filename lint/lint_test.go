@@ -0,0 +1,306 @@
+package lint_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/coder/preview"
+	"github.com/coder/preview/lint"
+)
+
+func TestLint(t *testing.T) {
+	t.Parallel()
+
+	dir := fstest.MapFS{
+		"icons/ok.svg": &fstest.MapFile{Data: []byte(`<svg/>`)},
+		"main.tf": &fstest.MapFile{Data: []byte(`
+data "coder_workspace_tags" "tags" {
+  tags = {
+    "zone" = data.coder_parameter.zone.value
+  }
+}
+
+data "coder_parameter" "zone" {
+  name         = "zone"
+  display_name = "Zone"
+  mutable      = true
+  default      = "eu"
+  order        = 1
+}
+
+data "coder_parameter" "size" {
+  name         = "size"
+  display_name = "Size"
+  default      = "small"
+  required     = true
+  order        = 1
+
+  option {
+    name  = "Small"
+    value = "small"
+    icon  = "icons/missing.svg"
+  }
+  option {
+    name  = "Large"
+    value = "large"
+    icon  = "icons/ok.svg"
+  }
+}
+
+data "coder_parameter" "nameless" {
+  name    = "nameless"
+  default = "x"
+}
+
+# preview-lint-ignore: missing-display-name, unused-parameter
+data "coder_parameter" "ignored" {
+  name    = "ignored"
+  default = "x"
+}
+
+data "coder_parameter" "trailing" { # preview-lint-ignore: all
+  name    = "trailing"
+  default = "x"
+}
+
+output "used" {
+  value = [data.coder_parameter.size.value, data.coder_parameter.nameless.value]
+}
+`)},
+	}
+
+	output, diags := preview.Preview(context.Background(), preview.Input{}, dir)
+	require.False(t, diags.HasErrors(), diags.Error())
+
+	type finding struct {
+		code     string
+		severity lint.Severity
+		line     int
+	}
+	run := func(t *testing.T, opts lint.Options) []finding {
+		findings, err := lint.Lint(lint.NewTemplate(dir, output), opts)
+		require.NoError(t, err)
+
+		got := make([]finding, 0, len(findings))
+		for _, f := range findings {
+			require.NotNil(t, f.Range, f.Summary)
+			got = append(got, finding{code: f.Code, severity: f.Severity, line: f.Range.Start.Line})
+		}
+		return got
+	}
+
+	t.Run("Default", func(t *testing.T) {
+		t.Parallel()
+
+		assert.ElementsMatch(t, []finding{
+			{code: lint.CodeMutableTagParameter, severity: lint.SeverityWarning, line: 8},
+			{code: lint.CodeOrderCollision, severity: lint.SeverityWarning, line: 13},
+			{code: lint.CodeRequiredWithDefault, severity: lint.SeverityWarning, line: 19},
+			{code: lint.CodeIconNotFound, severity: lint.SeverityWarning, line: 26},
+			{code: lint.CodeMissingDisplayName, severity: lint.SeverityWarning, line: 35},
+		}, run(t, lint.Options{}))
+	})
+
+	t.Run("Severity", func(t *testing.T) {
+		t.Parallel()
+
+		assert.ElementsMatch(t, []finding{
+			{code: lint.CodeMutableTagParameter, severity: lint.SeverityError, line: 8},
+			{code: lint.CodeMissingDisplayName, severity: lint.SeverityError, line: 35},
+		}, run(t, lint.Options{
+			Severity: map[string]lint.Severity{
+				lint.CodeMutableTagParameter: lint.SeverityError,
+				lint.CodeMissingDisplayName:  lint.SeverityError,
+				lint.CodeOrderCollision:      lint.SeverityOff,
+				lint.CodeRequiredWithDefault: lint.SeverityOff,
+				lint.CodeIconNotFound:        lint.SeverityOff,
+			},
+		}))
+	})
+
+	t.Run("UnknownRule", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := lint.Lint(lint.NewTemplate(dir, output), lint.Options{
+			Severity: map[string]lint.Severity{"no-such-rule": lint.SeverityOff},
+		})
+		require.Error(t, err)
+	})
+}
+
+func TestLintUnusedParameter(t *testing.T) {
+	t.Parallel()
+
+	parameter := func(name string) string {
+		return fmt.Sprintf(`
+data "coder_parameter" %q {
+  name         = %q
+  display_name = %q
+  default      = "x"
+}
+`, name, name, name)
+	}
+
+	for _, tc := range []struct {
+		name  string
+		files map[string]string
+		// unused are the parameters reported as unused.
+		unused []string
+	}{
+		{
+			name: "Unused",
+			files: map[string]string{"main.tf": parameter("a") + parameter("b") + `
+output "a" {
+  value = data.coder_parameter.a.value
+}
+`},
+			unused: []string{"b"},
+		},
+		{
+			name: "SelfReference",
+			files: map[string]string{"main.tf": `
+data "coder_parameter" "a" {
+  name         = "a"
+  display_name = "A"
+  default      = "x"
+
+  option {
+    name  = "X"
+    value = "x"
+  }
+  validation {
+    regex = data.coder_parameter.a.default
+    error = "Invalid"
+  }
+}
+`},
+			unused: []string{"a"},
+		},
+		{
+			name: "WholeObject",
+			files: map[string]string{"main.tf": parameter("a") + `
+locals {
+  parameter = data.coder_parameter.a
+}
+`},
+		},
+		{
+			name: "WholeObjectInFunction",
+			files: map[string]string{"main.tf": parameter("a") + `
+output "a" {
+  value = jsonencode(data.coder_parameter.a)
+}
+`},
+		},
+		{
+			name: "Index",
+			files: map[string]string{"main.tf": parameter("a") + `
+locals {
+  a = data.coder_parameter["a"].value
+}
+`},
+		},
+		{
+			name: "EveryParameter",
+			files: map[string]string{"main.tf": parameter("a") + parameter("b") + `
+locals {
+  values = [for p in data.coder_parameter : p.value]
+}
+`},
+		},
+		{
+			name: "NestedBlock",
+			files: map[string]string{"main.tf": parameter("a") + `
+data "coder_parameter" "b" {
+  name         = "b"
+  display_name = "B"
+  default      = "x"
+
+  option {
+    name  = "X"
+    value = data.coder_parameter.a.value
+  }
+}
+
+output "b" {
+  value = data.coder_parameter.b.value
+}
+`},
+		},
+		{
+			name: "JSON",
+			files: map[string]string{
+				"main.tf":        parameter("a"),
+				"output.tf.json": `{"output": {"a": {"value": "${data.coder_parameter.a.value}"}}}`,
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			dir := fstest.MapFS{}
+			for name, content := range tc.files {
+				dir[name] = &fstest.MapFile{Data: []byte(content)}
+			}
+			output, diags := preview.Preview(context.Background(), preview.Input{}, dir)
+			require.False(t, diags.HasErrors(), diags.Error())
+
+			findings, err := lint.Lint(lint.NewTemplate(dir, output), lint.Options{})
+			require.NoError(t, err)
+
+			unused := []string{}
+			for _, f := range findings {
+				if f.Code == lint.CodeUnusedParameter {
+					unused = append(unused, f.Summary)
+				}
+			}
+			expected := []string{}
+			for _, name := range tc.unused {
+				expected = append(expected, fmt.Sprintf("Parameter %q is never used", name))
+			}
+			assert.ElementsMatch(t, expected, unused)
+		})
+	}
+}
+
+func TestLintModuleSuppressions(t *testing.T) {
+	t.Parallel()
+
+	dir := fstest.MapFS{
+		"main.tf": &fstest.MapFile{Data: []byte(`
+module "child" {
+  source = "./modules/child"
+}
+`)},
+		"modules/child/main.tf": &fstest.MapFile{Data: []byte(`
+# preview-lint-ignore: unused-parameter
+data "coder_parameter" "ignored" {
+  name         = "ignored"
+  display_name = "Ignored"
+  default      = "x"
+}
+
+data "coder_parameter" "unused" {
+  name         = "unused"
+  display_name = "Unused"
+  default      = "x"
+}
+`)},
+	}
+
+	output, diags := preview.Preview(context.Background(), preview.Input{}, dir)
+	require.False(t, diags.HasErrors(), diags.Error())
+
+	findings, err := lint.Lint(lint.NewTemplate(dir, output), lint.Options{})
+	require.NoError(t, err)
+	require.Len(t, findings, 1)
+	assert.Equal(t, lint.CodeUnusedParameter, findings[0].Code)
+	assert.Contains(t, findings[0].Summary, `"unused"`)
+	require.NotNil(t, findings[0].Range)
+	assert.Equal(t, "modules/child/main.tf", findings[0].Range.Filename)
+}
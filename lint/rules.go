@@ -0,0 +1,327 @@
+package lint
+
+import (
+	"fmt"
+	"io/fs"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/aquasecurity/trivy/pkg/iac/terraform"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/zclconf/go-cty/cty"
+
+	"github.com/coder/preview/types"
+)
+
+const (
+	CodeMissingDisplayName  = "missing-display-name"
+	CodeMutableTagParameter = "mutable-tag-parameter"
+	CodeRequiredWithDefault = "required-with-default"
+	CodeUnusedParameter     = "unused-parameter"
+	CodeIconNotFound        = "icon-not-found"
+	CodeOrderCollision      = "order-collision"
+)
+
+// DefaultRules returns the rules Lint runs if none are given.
+func DefaultRules() []Rule {
+	return []Rule{
+		{
+			Code:        CodeMissingDisplayName,
+			Description: "A parameter has no display_name, so users see its name instead.",
+			Severity:    SeverityWarning,
+			Check:       missingDisplayName,
+		},
+		{
+			Code: CodeMutableTagParameter,
+			Description: "A mutable parameter decides a workspace tag. Changing it after the workspace " +
+				"is created moves the workspace to other provisioners.",
+			Severity: SeverityWarning,
+			Check:    mutableTagParameter,
+		},
+		{
+			Code:        CodeRequiredWithDefault,
+			Description: "A required parameter has a default value, which is never used.",
+			Severity:    SeverityWarning,
+			Check:       requiredWithDefault,
+		},
+		{
+			Code:        CodeUnusedParameter,
+			Description: "The value of a parameter is not referenced anywhere in its module.",
+			Severity:    SeverityWarning,
+			Check:       unusedParameter,
+		},
+		{
+			Code:        CodeIconNotFound,
+			Description: "The icon of a parameter or option is a path that does not exist.",
+			Severity:    SeverityWarning,
+			Check:       iconNotFound,
+		},
+		{
+			Code:        CodeOrderCollision,
+			Description: "Parameters share the same order, so their order in the form depends on their names.",
+			Severity:    SeverityWarning,
+			Check:       orderCollision,
+		},
+	}
+}
+
+func missingDisplayName(t Template) []Finding {
+	var findings []Finding
+	for _, p := range t.Parameters {
+		if p.DisplayName != "" {
+			continue
+		}
+		findings = append(findings, Finding{
+			Summary: fmt.Sprintf("Parameter %q has no display_name", p.Name),
+			Detail:  "Set display_name to a human readable name for the form.",
+			Range:   blockRange(p.Source),
+		})
+	}
+	return findings
+}
+
+func mutableTagParameter(t Template) []Finding {
+	byName := make(map[string]types.Parameter, len(t.Parameters))
+	for _, p := range t.Parameters {
+		byName[p.Name] = p
+	}
+
+	var findings []Finding
+	reported := make(map[string]bool)
+	for _, block := range t.WorkspaceTags {
+		for _, tag := range block.Tags {
+			for _, input := range tag.Inputs.OfKind(types.TagInputKindParameter) {
+				p, ok := byName[input.Name]
+				if !ok || !p.Mutable || reported[p.Name] {
+					continue
+				}
+				reported[p.Name] = true
+				findings = append(findings, Finding{
+					Summary: fmt.Sprintf("Mutable parameter %q decides the workspace tag %q", p.Name, tag.KeyString()),
+					Detail: "Changing the parameter after the workspace is created changes the provisioner tags " +
+						"of later builds. Set mutable to false, or stop using it in the tag.",
+					Range: blockRange(p.Source),
+				})
+			}
+		}
+	}
+	return findings
+}
+
+func requiredWithDefault(t Template) []Finding {
+	var findings []Finding
+	for _, p := range t.Parameters {
+		if !p.Required || p.Source == nil {
+			continue
+		}
+		def := p.Source.GetAttribute("default")
+		if def.IsNil() {
+			continue
+		}
+		rng := def.HCLAttribute().Range
+		findings = append(findings, Finding{
+			Summary: fmt.Sprintf("Required parameter %q has a default value", p.Name),
+			Detail:  "A required parameter must always be set by the user, so the default is never used. Remove one of the two.",
+			Range:   &rng,
+		})
+	}
+	return findings
+}
+
+// referenceKey is a parameter block, by the module it is declared in and its
+// name label.
+type referenceKey struct {
+	module *terraform.Block
+	label  string
+}
+
+func unusedParameter(t Template) []Finding {
+	used := make(map[referenceKey]bool)
+	for _, block := range t.Modules.GetBlocks() {
+		self := referenceKey{module: block.ModuleBlock()}
+		if block.Type() == "data" && block.TypeLabel() == types.BlockTypeParameter {
+			self.label = block.Reference().NameLabel()
+		}
+		for _, label := range parameterReferences(block) {
+			// A parameter that only refers to itself, such as for its
+			// options, is still unused.
+			if label == self.label {
+				continue
+			}
+			used[referenceKey{module: block.ModuleBlock(), label: label}] = true
+		}
+	}
+
+	var findings []Finding
+	for _, p := range t.Parameters {
+		if p.Source == nil {
+			continue
+		}
+		// The name label of the reference leaves out the count or for_each
+		// key of the block.
+		module := p.Source.ModuleBlock()
+		if used[referenceKey{module: module, label: p.Source.Reference().NameLabel()}] || used[referenceKey{module: module, label: allParameters}] {
+			continue
+		}
+		findings = append(findings, Finding{
+			Summary: fmt.Sprintf("Parameter %q is never used", p.Name),
+			Detail:  fmt.Sprintf("Nothing in the module refers to %s, so its value has no effect.", p.Source.LocalName()),
+			Range:   blockRange(p.Source),
+		})
+	}
+	return findings
+}
+
+// parameterReferences returns the name labels of the parameters that the
+// block refers to, including in its nested blocks. Any traversal that names a
+// parameter counts, such as 'data.coder_parameter.x' for the whole object, or
+// 'data.coder_parameter["x"]'. A traversal of 'data.coder_parameter' itself
+// refers to every parameter, and returns allParameters.
+func parameterReferences(block *terraform.Block) []string {
+	var labels []string
+	// The attributes of trivy blocks cover both the native and the JSON
+	// syntax.
+	for _, attr := range block.GetAttributes() {
+		for _, trav := range attr.HCLAttribute().Expr.Variables() {
+			if len(trav) < 2 || trav.RootName() != "data" {
+				continue
+			}
+			typ, ok := trav[1].(hcl.TraverseAttr)
+			if !ok || typ.Name != types.BlockTypeParameter {
+				continue
+			}
+			if len(trav) == 2 {
+				labels = append(labels, allParameters)
+				continue
+			}
+			switch name := trav[2].(type) {
+			case hcl.TraverseAttr:
+				labels = append(labels, name.Name)
+			case hcl.TraverseIndex:
+				if name.Key.Type() == cty.String && name.Key.IsKnown() && !name.Key.IsNull() {
+					labels = append(labels, name.Key.AsString())
+				} else {
+					labels = append(labels, allParameters)
+				}
+			}
+		}
+	}
+	for _, child := range block.AllBlocks() {
+		labels = append(labels, parameterReferences(child)...)
+	}
+	return labels
+}
+
+// allParameters is the label of a reference to every parameter of the
+// module. It is never the name label of a block.
+const allParameters = "*"
+
+func iconNotFound(t Template) []Finding {
+	var findings []Finding
+	for _, p := range t.Parameters {
+		if missing, ok := t.iconMissing(p.Icon); ok && missing {
+			findings = append(findings, Finding{
+				Summary: fmt.Sprintf("Icon %q of parameter %q does not exist", p.Icon, p.Name),
+				Range:   attributeRange(p.Source, "icon"),
+			})
+		}
+
+		for _, opt := range p.Options {
+			if missing, ok := t.iconMissing(opt.Icon); ok && missing {
+				findings = append(findings, Finding{
+					Summary: fmt.Sprintf("Icon %q of option %q of parameter %q does not exist", opt.Icon, opt.Name, p.Name),
+					Range:   optionIconRange(p.Source, opt.Icon),
+				})
+			}
+		}
+	}
+	return findings
+}
+
+// iconMissing returns true if the icon is a path that does not exist. It
+// returns false for the second value if the icon cannot be checked, such as
+// a URL.
+func (t Template) iconMissing(icon string) (missing bool, ok bool) {
+	if icon == "" {
+		return false, false
+	}
+	if u, err := url.Parse(icon); err != nil || u.Scheme != "" || u.Host != "" {
+		return false, false
+	}
+
+	dir := t.Dir
+	if strings.HasPrefix(icon, "/") {
+		dir = t.Icons
+	}
+	if dir == nil {
+		return false, false
+	}
+
+	name := strings.TrimPrefix(path.Clean(icon), "/")
+	if !fs.ValidPath(name) {
+		return true, true
+	}
+	_, err := fs.Stat(dir, name)
+	return err != nil, true
+}
+
+func orderCollision(t Template) []Finding {
+	// Parameters without an order all have order 0, which is not a
+	// collision worth reporting.
+	first := make(map[int64]types.Parameter)
+	var findings []Finding
+	for _, p := range t.Parameters {
+		if p.Order == 0 {
+			continue
+		}
+		other, ok := first[p.Order]
+		if !ok {
+			first[p.Order] = p
+			continue
+		}
+		findings = append(findings, Finding{
+			Summary: fmt.Sprintf("Parameter %q has the same order %d as %q", p.Name, p.Order, other.Name),
+			Detail:  "Parameters with the same order are sorted by name. Give each parameter its own order.",
+			Range:   attributeRange(p.Source, "order"),
+		})
+	}
+	return findings
+}
+
+func blockRange(block *terraform.Block) *hcl.Range {
+	if block == nil {
+		return nil
+	}
+	return &block.HCLBlock().DefRange
+}
+
+// attributeRange returns the range of the attribute, or of the block if the
+// attribute is not set.
+func attributeRange(block *terraform.Block, name string) *hcl.Range {
+	if block == nil {
+		return nil
+	}
+	attr := block.GetAttribute(name)
+	if attr.IsNil() {
+		return blockRange(block)
+	}
+	rng := attr.HCLAttribute().Range
+	return &rng
+}
+
+// optionIconRange returns the range of the icon attribute of the option with
+// the icon.
+func optionIconRange(block *terraform.Block, icon string) *hcl.Range {
+	if block == nil {
+		return nil
+	}
+	for _, opt := range block.GetBlocks("option") {
+		attr := opt.GetAttribute("icon")
+		if !attr.IsNil() && attr.Equals(icon) {
+			rng := attr.HCLAttribute().Range
+			return &rng
+		}
+	}
+	return blockRange(block)
+}
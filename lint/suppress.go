@@ -0,0 +1,93 @@
+package lint
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+)
+
+// suppressRe matches the comments that suppress findings:
+//
+//	# preview-lint-ignore: unused-parameter, order-collision
+//	// preview-lint-ignore-file: all
+//
+// A comment on its own line applies to the next line, a comment after code
+// to its own line, and a '-file' comment to the whole file.
+var suppressRe = regexp.MustCompile(`^(?:#|//)\s*preview-lint-ignore(-file)?:\s*(.+?)\s*$`)
+
+// allCodes suppresses the findings of every rule.
+const allCodes = "all"
+
+type fileSuppressions struct {
+	// lines are the codes suppressed on each line.
+	lines map[int][]string
+	// file are the codes suppressed in the whole file.
+	file []string
+}
+
+type suppressions map[string]*fileSuppressions
+
+func parseSuppressions(files map[string]*hcl.File) suppressions {
+	s := make(suppressions)
+	for name, f := range files {
+		if f == nil || !strings.HasSuffix(name, ".tf") {
+			continue
+		}
+
+		tokens, _ := hclsyntax.LexConfig(f.Bytes, name, hcl.InitialPos)
+		// codeLine is the last line with a token other than a comment.
+		codeLine := 0
+		for _, tok := range tokens {
+			switch tok.Type {
+			case hclsyntax.TokenNewline, hclsyntax.TokenEOF:
+				continue
+			case hclsyntax.TokenComment:
+			default:
+				codeLine = tok.Range.End.Line
+				continue
+			}
+
+			m := suppressRe.FindStringSubmatch(strings.TrimSpace(string(tok.Bytes)))
+			if m == nil {
+				continue
+			}
+			codes := strings.Split(m[2], ",")
+			for i := range codes {
+				codes[i] = strings.TrimSpace(codes[i])
+			}
+
+			file, ok := s[name]
+			if !ok {
+				file = &fileSuppressions{lines: make(map[int][]string)}
+				s[name] = file
+			}
+			if m[1] != "" {
+				file.file = append(file.file, codes...)
+				continue
+			}
+			line := tok.Range.Start.Line
+			if codeLine != line {
+				line++
+			}
+			file.lines[line] = append(file.lines[line], codes...)
+		}
+	}
+	return s
+}
+
+// match returns true if a comment suppresses the finding.
+func (s suppressions) match(f Finding) bool {
+	if f.Range == nil {
+		return false
+	}
+	file, ok := s[f.Range.Filename]
+	if !ok {
+		return false
+	}
+
+	codes := slices.Concat(file.lines[f.Range.Start.Line], file.file)
+	return slices.Contains(codes, f.Code) || slices.Contains(codes, allCodes)
+}
@@ -0,0 +1,70 @@
+package preview
+
+import (
+	"context"
+	"time"
+
+	"github.com/hashicorp/hcl/v2"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Phase is a step of a preview, in the order they run.
+type Phase string
+
+const (
+	PhaseTFVars     Phase = "tfvars"
+	PhasePlan       Phase = "plan"
+	PhaseParse      Phase = "parse"
+	PhaseEvaluate   Phase = "evaluate"
+	PhaseParameters Phase = "parameters"
+	PhaseTags       Phase = "tags"
+)
+
+// Metrics records how expensive previews are. Previews can run concurrently,
+// so implementations must be safe for concurrent use.
+type Metrics interface {
+	// ObservePhase is called when a phase finishes, even if it failed.
+	ObservePhase(phase Phase, duration time.Duration)
+	// ObservePreview is called once a preview returns, with the diagnostics
+	// it returned and the number of parameters found.
+	ObservePreview(duration time.Duration, diags hcl.Diagnostics, parameters int)
+}
+
+type noopMetrics struct{}
+
+func (noopMetrics) ObservePhase(Phase, time.Duration)                  {}
+func (noopMetrics) ObservePreview(time.Duration, hcl.Diagnostics, int) {}
+
+// phaseTimer reports the duration of each phase to the metrics, and
+// records a span for it.
+type phaseTimer struct {
+	ctx     context.Context
+	metrics Metrics
+	tracer  trace.Tracer
+
+	phase Phase
+	start time.Time
+	span  trace.Span
+}
+
+func newPhaseTimer(ctx context.Context, metrics Metrics, tracer trace.Tracer) *phaseTimer {
+	return &phaseTimer{ctx: ctx, metrics: metrics, tracer: tracer}
+}
+
+// begin starts the phase, and returns the context of its span.
+func (t *phaseTimer) begin(phase Phase) context.Context {
+	ctx, span := t.tracer.Start(t.ctx, "preview."+string(phase), trace.WithAttributes(
+		AttributePhase.String(string(phase)),
+	))
+	t.phase = phase
+	t.span = span
+	t.start = time.Now()
+	return ctx
+}
+
+// end records the phase that began last. It is called even if the phase
+// failed.
+func (t *phaseTimer) end() {
+	t.metrics.ObservePhase(t.phase, time.Since(t.start))
+	t.span.End()
+}
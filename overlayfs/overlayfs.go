@@ -0,0 +1,173 @@
+// Package overlayfs layers in-memory file contents over a template directory,
+// so unsaved edits can be previewed without writing them anywhere.
+package overlayfs
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"path"
+	"slices"
+	"time"
+
+	"github.com/coder/preview/internal/memfs"
+)
+
+// FS is a read-only file system that serves the overlay files in place of
+// the base files. Files not in the overlay are read from the base. It is
+// safe for concurrent use.
+type FS struct {
+	base    fs.FS
+	files   memfs.FS
+	deleted map[string]bool
+}
+
+var (
+	_ fs.ReadDirFS = (*FS)(nil)
+	_ fs.StatFS    = (*FS)(nil)
+)
+
+// New returns the base file system with the given files replaced or added.
+// A nil content deletes the file.
+func New(base fs.FS, files map[string][]byte) (*FS, error) {
+	o := &FS{
+		base:    base,
+		files:   make(memfs.FS),
+		deleted: make(map[string]bool),
+	}
+
+	now := time.Now()
+	for name, content := range files {
+		if !fs.ValidPath(name) || name == "." {
+			return nil, fmt.Errorf("invalid path %q", name)
+		}
+		if content == nil {
+			o.deleted[name] = true
+			continue
+		}
+		o.files[name] = &memfs.File{
+			Data:    content,
+			Mode:    0o644,
+			ModTime: now,
+		}
+	}
+	return o, nil
+}
+
+func (o *FS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	if o.deleted[name] {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	if f, ok := o.files[name]; ok && !f.Mode.IsDir() {
+		return o.files.Open(name)
+	}
+
+	info, err := o.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return o.base.Open(name)
+	}
+
+	entries, err := o.ReadDir(name)
+	if err != nil {
+		return nil, err
+	}
+	return &dir{info: info, entries: entries}, nil
+}
+
+func (o *FS) Stat(name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrInvalid}
+	}
+	if o.deleted[name] {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+	}
+
+	// The overlay takes precedence for files. Directories that only exist
+	// because of overlay files are implied by them.
+	info, err := fs.Stat(o.files, name)
+	if err == nil && !info.IsDir() {
+		return info, nil
+	}
+	baseInfo, baseErr := fs.Stat(o.base, name)
+	if baseErr == nil {
+		return baseInfo, nil
+	}
+	if err == nil {
+		return info, nil
+	}
+	return nil, baseErr
+}
+
+// ReadDir merges the entries of the base and overlay directories.
+func (o *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+
+	entries := make(map[string]fs.DirEntry)
+	baseEntries, baseErr := fs.ReadDir(o.base, name)
+	if baseErr != nil && !errors.Is(baseErr, fs.ErrNotExist) {
+		return nil, baseErr
+	}
+	for _, entry := range baseEntries {
+		if o.deleted[path.Join(name, entry.Name())] {
+			continue
+		}
+		entries[entry.Name()] = entry
+	}
+
+	overlayEntries, overlayErr := fs.ReadDir(o.files, name)
+	for _, entry := range overlayEntries {
+		if _, ok := entries[entry.Name()]; ok && entry.IsDir() {
+			// Keep the real directory info.
+			continue
+		}
+		entries[entry.Name()] = entry
+	}
+
+	if baseErr != nil && overlayErr != nil {
+		return nil, baseErr
+	}
+
+	sorted := make([]fs.DirEntry, 0, len(entries))
+	for _, key := range slices.Sorted(maps.Keys(entries)) {
+		sorted = append(sorted, entries[key])
+	}
+	return sorted, nil
+}
+
+// dir is an open directory with merged entries.
+type dir struct {
+	info    fs.FileInfo
+	entries []fs.DirEntry
+	offset  int
+}
+
+func (d *dir) Stat() (fs.FileInfo, error) { return d.info, nil }
+func (d *dir) Close() error               { return nil }
+
+func (d *dir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.info.Name(), Err: errors.New("is a directory")}
+}
+
+func (d *dir) ReadDir(count int) ([]fs.DirEntry, error) {
+	remaining := d.entries[d.offset:]
+	if count <= 0 {
+		d.offset = len(d.entries)
+		return remaining, nil
+	}
+	if len(remaining) == 0 {
+		return nil, io.EOF
+	}
+	count = min(count, len(remaining))
+	d.offset += count
+	return remaining[:count], nil
+}
@@ -0,0 +1,92 @@
+package overlayfs_test
+
+import (
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/coder/preview/overlayfs"
+)
+
+func TestFS(t *testing.T) {
+	t.Parallel()
+
+	base := fstest.MapFS{
+		"main.tf":           &fstest.MapFile{Data: []byte("base main")},
+		"vars.tf":           &fstest.MapFile{Data: []byte("base vars")},
+		"modules/x/main.tf": &fstest.MapFile{Data: []byte("base module")},
+	}
+
+	o, err := overlayfs.New(base, map[string][]byte{
+		"main.tf":           []byte("patched main"),
+		"vars.tf":           nil,
+		"modules/y/main.tf": []byte("new module"),
+		"extra.tf":          []byte("new file"),
+	})
+	require.NoError(t, err)
+
+	// The file system is consistent across Open, Stat, ReadDir and
+	// ReadFile.
+	require.NoError(t, fstest.TestFS(o, "main.tf", "extra.tf", "modules/x/main.tf", "modules/y/main.tf"))
+
+	for _, tc := range []struct {
+		name     string
+		expected string
+	}{
+		{name: "main.tf", expected: "patched main"},
+		{name: "extra.tf", expected: "new file"},
+		{name: "modules/x/main.tf", expected: "base module"},
+		{name: "modules/y/main.tf", expected: "new module"},
+	} {
+		data, err := fs.ReadFile(o, tc.name)
+		require.NoError(t, err, tc.name)
+		assert.Equal(t, tc.expected, string(data), tc.name)
+	}
+
+	// Deleted files are gone, and the base is left as it was.
+	_, err = fs.ReadFile(o, "vars.tf")
+	require.ErrorIs(t, err, fs.ErrNotExist)
+	_, err = fs.Stat(o, "vars.tf")
+	require.ErrorIs(t, err, fs.ErrNotExist)
+	data, err := fs.ReadFile(base, "vars.tf")
+	require.NoError(t, err)
+	assert.Equal(t, "base vars", string(data))
+
+	// Directories merge the entries of both.
+	entries, err := fs.ReadDir(o, ".")
+	require.NoError(t, err)
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	assert.Equal(t, []string{"extra.tf", "main.tf", "modules"}, names)
+
+	entries, err = fs.ReadDir(o, "modules")
+	require.NoError(t, err)
+	names = names[:0]
+	for _, entry := range entries {
+		assert.True(t, entry.IsDir(), entry.Name())
+		names = append(names, entry.Name())
+	}
+	assert.Equal(t, []string{"x", "y"}, names)
+
+	_, err = fs.ReadDir(o, "missing")
+	require.ErrorIs(t, err, fs.ErrNotExist)
+}
+
+func TestNewInvalidPath(t *testing.T) {
+	t.Parallel()
+
+	for _, name := range []string{"", ".", "../main.tf", "/main.tf", "a/../main.tf"} {
+		_, err := overlayfs.New(fstest.MapFS{}, map[string][]byte{name: []byte("x")})
+		assert.Error(t, err, name)
+	}
+
+	o, err := overlayfs.New(fstest.MapFS{}, nil)
+	require.NoError(t, err)
+	_, err = o.Open("../main.tf")
+	require.ErrorIs(t, err, fs.ErrInvalid)
+}
@@ -1,17 +1,24 @@
 package preview
 
 import (
+	"context"
 	"fmt"
 	"strings"
 
 	"github.com/aquasecurity/trivy/pkg/iac/terraform"
 	"github.com/hashicorp/hcl/v2"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 
 	"github.com/coder/preview/extract"
 	"github.com/coder/preview/types"
 )
 
 func RichParameters(modules terraform.Modules) ([]types.Parameter, hcl.Diagnostics) {
+	return richParameters(context.Background(), tracerOrNoop(nil), modules)
+}
+
+func richParameters(ctx context.Context, tracer trace.Tracer, modules terraform.Modules) ([]types.Parameter, hcl.Diagnostics) {
 	diags := make(hcl.Diagnostics, 0)
 	params := make([]types.Parameter, 0)
 	exists := make(map[string][]types.Parameter)
@@ -19,7 +26,18 @@ func RichParameters(modules terraform.Modules) ([]types.Parameter, hcl.Diagnosti
 	for _, mod := range modules {
 		blocks := mod.GetDatasByType(types.BlockTypeParameter)
 		for _, block := range blocks {
+			_, span := tracer.Start(ctx, "extract.ParameterFromBlock", trace.WithAttributes(
+				AttributeBlock.String(block.FullName()),
+			))
 			param, pDiags := extract.ParameterFromBlock(block)
+			if param != nil {
+				span.SetAttributes(AttributeParameter.String(param.Name))
+			}
+			if pDiags.HasErrors() {
+				span.SetStatus(codes.Error, pDiags.Error())
+			}
+			span.End()
+
 			if len(pDiags) > 0 {
 				diags = diags.Extend(pDiags)
 			}
@@ -0,0 +1,220 @@
+package preview
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/aquasecurity/trivy/pkg/iac/scanners/terraform/parser"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	tfjson "github.com/hashicorp/terraform-json"
+)
+
+// DefaultParseCacheSize is the memory budget of a ParseCache when none is
+// given.
+const DefaultParseCacheSize = 64 << 20 // 64 MiB
+
+// ParseCache shares parsed template files and plan JSON between previews,
+// so that only files that changed are parsed again. Files are keyed by
+// their path and the hash of their content, and plans by the hash of their
+// content, so a cache can be shared by previews of different directories,
+// or of the same directory with different edits.
+//
+// Once the cache holds more source bytes than its budget, the least
+// recently used entries are evicted. It is safe for concurrent use.
+type ParseCache struct {
+	maxBytes int64
+
+	mu      sync.Mutex
+	size    int64
+	clock   int64
+	entries map[parseKey]*parsedEntry
+}
+
+// parseKey identifies a parsed file, or a plan if the path is empty.
+type parseKey struct {
+	path string
+	hash [sha256.Size]byte
+}
+
+// parsedEntry holds either a file or a plan.
+type parsedEntry struct {
+	file *hcl.File
+	plan *tfjson.Plan
+	size int64
+	// lastUsed is the clock of the ParseCache when the entry was last used.
+	lastUsed int64
+}
+
+func NewParseCache(maxBytes int64) *ParseCache {
+	if maxBytes <= 0 {
+		maxBytes = DefaultParseCacheSize
+	}
+	return &ParseCache{
+		maxBytes: maxBytes,
+		entries:  make(map[parseKey]*parsedEntry),
+	}
+}
+
+// Len returns the number of parsed files and plans held by the cache.
+func (c *ParseCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
+
+// plan returns the parsed plan JSON, parsing it if it is not cached yet.
+// The plan is shared, and must not be modified.
+func (c *ParseCache) plan(data []byte) (*tfjson.Plan, error) {
+	key := parseKey{hash: sha256.Sum256(data)}
+
+	c.mu.Lock()
+	c.clock++
+	if cached, ok := c.entries[key]; ok {
+		cached.lastUsed = c.clock
+		c.mu.Unlock()
+		return cached.plan, nil
+	}
+	c.mu.Unlock()
+
+	plan, err := ParsePlanJSON(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.add(key, &parsedEntry{plan: plan, size: int64(len(data))})
+	return plan, nil
+}
+
+// parserOption returns the option that hands the parsed files of the
+// directory to the terraform parser of every module. The parser looks files
+// up by path before parsing them, so cached files are used as they are.
+// Files with errors are never cached, so that the parser reports them.
+func (c *ParseCache) parserOption(dir fs.FS) (parser.Option, error) {
+	files, err := c.parse(dir)
+	if err != nil {
+		return nil, err
+	}
+	return func(p *parser.Parser) {
+		// Files returns the map of the underlying HCL parser itself.
+		parsed := p.Files()
+		for name, file := range files {
+			parsed[name] = file
+		}
+	}, nil
+}
+
+// parse returns the terraform files of the directory, parsing those that
+// are not cached yet.
+func (c *ParseCache) parse(dir fs.FS) (map[string]*hcl.File, error) {
+	type source struct {
+		key  parseKey
+		data []byte
+	}
+	var sources []source
+	err := fs.WalkDir(dir, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			// Provider binaries are never read by a preview.
+			if name == path.Join(".terraform", "providers") {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasSuffix(name, ".tf") && !strings.HasSuffix(name, ".tf.json") {
+			return nil
+		}
+
+		data, err := fs.ReadFile(dir, name)
+		if err != nil {
+			return fmt.Errorf("read %q: %w", name, err)
+		}
+		sources = append(sources, source{
+			key:  parseKey{path: name, hash: sha256.Sum256(data)},
+			data: data,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("read template files: %w", err)
+	}
+
+	files := make(map[string]*hcl.File, len(sources))
+	var missing []source
+
+	c.mu.Lock()
+	c.clock++
+	for _, src := range sources {
+		if cached, ok := c.entries[src.key]; ok {
+			cached.lastUsed = c.clock
+			files[src.key.path] = cached.file
+			continue
+		}
+		missing = append(missing, src)
+	}
+	c.mu.Unlock()
+
+	// Files are parsed outside of the lock, as parsing is the slow part.
+	parsed := make(map[parseKey]*hcl.File, len(missing))
+	for _, src := range missing {
+		hp := hclparse.NewParser()
+		var (
+			file  *hcl.File
+			diags hcl.Diagnostics
+		)
+		if strings.HasSuffix(src.key.path, ".tf.json") {
+			file, diags = hp.ParseJSON(src.data, src.key.path)
+		} else {
+			file, diags = hp.ParseHCL(src.data, src.key.path)
+		}
+		if diags.HasErrors() {
+			continue
+		}
+		parsed[src.key] = file
+		files[src.key.path] = file
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, file := range parsed {
+		c.add(key, &parsedEntry{file: file, size: int64(len(file.Bytes))})
+	}
+	return files, nil
+}
+
+// add caches the entry, unless another preview parsed the same source in
+// the meantime, and evicts the least recently used entries until the cache
+// is within its budget. The caller must hold c.mu.
+func (c *ParseCache) add(key parseKey, entry *parsedEntry) {
+	if _, ok := c.entries[key]; !ok {
+		entry.lastUsed = c.clock
+		c.entries[key] = entry
+		c.size += entry.size
+	}
+
+	for c.size > c.maxBytes {
+		var (
+			oldestKey parseKey
+			oldest    *parsedEntry
+		)
+		for key, entry := range c.entries {
+			if oldest == nil || entry.lastUsed < oldest.lastUsed {
+				oldestKey, oldest = key, entry
+			}
+		}
+		if oldest == nil {
+			return
+		}
+		delete(c.entries, oldestKey)
+		c.size -= oldest.size
+	}
+}
@@ -0,0 +1,137 @@
+package preview_test
+
+import (
+	"maps"
+	"slices"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/coder/preview"
+	"github.com/coder/preview/overlayfs"
+)
+
+func TestParseCache(t *testing.T) {
+	t.Parallel()
+
+	dir := fstest.MapFS{
+		"main.tf": &fstest.MapFile{Data: []byte(`
+data "coder_parameter" "region" {
+  name    = "region"
+  default = "us"
+}
+
+module "x" {
+  source = "./modules/x"
+  input  = data.coder_parameter.region.value
+}
+`)},
+		"tags.tf": &fstest.MapFile{Data: []byte(`
+data "coder_workspace_tags" "tags" {
+  tags = {
+    "region" = module.x.upper
+  }
+}
+`)},
+		"modules/x/main.tf": &fstest.MapFile{Data: []byte(`
+variable "input" {}
+
+output "upper" {
+  value = upper(var.input)
+}
+`)},
+	}
+
+	uncached, diags := preview.Preview(t.Context(), preview.Input{}, dir)
+	require.False(t, diags.HasErrors(), diags.Error())
+
+	cache := preview.NewParseCache(0)
+	first, diags := preview.Preview(t.Context(), preview.Input{ParseCache: cache}, dir)
+	require.False(t, diags.HasErrors(), diags.Error())
+	require.Equal(t, 3, cache.Len())
+
+	// The cache does not change the result, and the files of the output are
+	// still those of the root module only.
+	assert.Equal(t, slices.Sorted(maps.Keys(uncached.Files)), slices.Sorted(maps.Keys(first.Files)))
+	assert.Equal(t, uncached.WorkspaceTags.Tags(), first.WorkspaceTags.Tags())
+	assert.Equal(t, map[string]string{"region": "US"}, first.WorkspaceTags.Tags())
+
+	// Unchanged files are reused as they are.
+	second, diags := preview.Preview(t.Context(), preview.Input{ParseCache: cache}, dir)
+	require.False(t, diags.HasErrors(), diags.Error())
+	require.Equal(t, 3, cache.Len())
+	assert.Same(t, first.Files["main.tf"], second.Files["main.tf"])
+	assert.Same(t, first.Files["tags.tf"], second.Files["tags.tf"])
+
+	// A patched file is parsed again, and only that file.
+	patched, err := overlayfs.New(dir, map[string][]byte{
+		"modules/x/main.tf": []byte(`
+variable "input" {}
+
+output "upper" {
+  value = lower(var.input)
+}
+`),
+	})
+	require.NoError(t, err)
+	third, diags := preview.Preview(t.Context(), preview.Input{ParseCache: cache}, patched)
+	require.False(t, diags.HasErrors(), diags.Error())
+	require.Equal(t, 4, cache.Len())
+	assert.Same(t, first.Files["main.tf"], third.Files["main.tf"])
+	assert.Equal(t, map[string]string{"region": "us"}, third.WorkspaceTags.Tags())
+
+	// A file with errors is not cached, so that the parser reports it.
+	broken, err := overlayfs.New(dir, map[string][]byte{
+		"tags.tf": []byte(`data "coder_workspace_tags" "tags" {`),
+	})
+	require.NoError(t, err)
+	_, _ = preview.Preview(t.Context(), preview.Input{ParseCache: cache}, broken)
+	require.Equal(t, 4, cache.Len())
+}
+
+func TestParseCacheEviction(t *testing.T) {
+	t.Parallel()
+
+	file := func(value string) fstest.MapFS {
+		return fstest.MapFS{
+			"main.tf": &fstest.MapFile{Data: []byte(`
+locals {
+  value = "` + value + `"
+}
+`)},
+		}
+	}
+
+	// The budget holds a single version of the file.
+	cache := preview.NewParseCache(40)
+	for _, value := range []string{"a", "b", "c"} {
+		_, diags := preview.Preview(t.Context(), preview.Input{ParseCache: cache}, file(value))
+		require.False(t, diags.HasErrors(), diags.Error())
+		require.Equal(t, 1, cache.Len())
+	}
+}
+
+func TestParseCachePlan(t *testing.T) {
+	t.Parallel()
+
+	dir := fstest.MapFS{
+		"main.tf": &fstest.MapFile{Data: []byte(`locals {}`)},
+		"plan.json": &fstest.MapFile{Data: []byte(`{
+  "format_version": "1.2",
+  "prior_state": {"format_version": "1.0", "values": {"root_module": {}}}
+}`)},
+	}
+
+	cache := preview.NewParseCache(0)
+	for range 2 {
+		_, diags := preview.Preview(t.Context(), preview.Input{
+			PlanJSONPath: "plan.json",
+			ParseCache:   cache,
+		}, dir)
+		require.False(t, diags.HasErrors(), diags.Error())
+		// The file and the plan.
+		require.Equal(t, 2, cache.Len())
+	}
+}
@@ -21,7 +21,7 @@ import (
 )
 
 func PlanJSONHook(dfs fs.FS, input Input) (func(ctx *tfcontext.Context, blocks terraform.Blocks, inputVars map[string]cty.Value), error) {
-	var contents io.Reader = bytes.NewReader(input.PlanJSON)
+	contents := []byte(input.PlanJSON)
 	// Also accept `{}` as an empty plan. If this is stored in postgres or another json
 	// type, then `{}` is the "empty" value.
 	if len(input.PlanJSON) == 0 || bytes.Compare(input.PlanJSON, []byte("{}")) == 0 {
@@ -30,13 +30,21 @@ func PlanJSONHook(dfs fs.FS, input Input) (func(ctx *tfcontext.Context, blocks t
 		}
 
 		var err error
-		contents, err = dfs.Open(input.PlanJSONPath)
+		contents, err = fs.ReadFile(dfs, input.PlanJSONPath)
 		if err != nil {
 			return nil, fmt.Errorf("unable to open plan JSON file: %w", err)
 		}
 	}
 
-	plan, err := ParsePlanJSON(contents)
+	var (
+		plan *tfjson.Plan
+		err  error
+	)
+	if input.ParseCache != nil {
+		plan, err = input.ParseCache.plan(contents)
+	} else {
+		plan, err = ParsePlanJSON(bytes.NewReader(contents))
+	}
 	if err != nil {
 		return nil, fmt.Errorf("unable to parse plan JSON: %w", err)
 	}
@@ -3,16 +3,23 @@ package preview
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/fs"
 	"log/slog"
 	"os"
+	"path"
 	"path/filepath"
+	"time"
 
 	"github.com/aquasecurity/trivy/pkg/iac/scanners/terraform/parser"
+	"github.com/aquasecurity/trivy/pkg/iac/terraform"
 	"github.com/aquasecurity/trivy/pkg/log"
 	"github.com/hashicorp/hcl/v2"
 	"github.com/zclconf/go-cty/cty"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 
 	"github.com/coder/preview/types"
 )
@@ -25,21 +32,92 @@ type Input struct {
 	PlanJSON        json.RawMessage
 	ParameterValues map[string]string
 	Owner           types.WorkspaceOwner
+	// Workspace is optional. If set, it is used for the 'coder_workspace'
+	// data source.
+	Workspace types.Workspace
+	// Metrics is optional. If set, it records the duration and outcome of
+	// the preview.
+	Metrics Metrics
+	// Tracer is optional. If set, spans are recorded for each phase, eval
+	// hook call and parameter block of the preview.
+	Tracer trace.Tracer
+	// TemplateDir is optional. It names the template directory in spans, and
+	// is not used to read files.
+	TemplateDir string
+	// Budget is optional. It bounds the work of the preview.
+	Budget Budget
+	// Evaluated is optional. If set, it is closed once the evaluation of the
+	// template has stopped, or once Preview returns if the evaluation never
+	// started. An evaluation that runs out of time stops at its next
+	// iteration, which can be after Preview returns.
+	Evaluated chan struct{}
+	// ParseCache is optional. If set, template files that were parsed by an
+	// earlier preview with the same cache are not parsed again.
+	ParseCache *ParseCache
 }
 
 type Output struct {
 	ModuleOutput  cty.Value
 	Parameters    []types.Parameter
 	WorkspaceTags types.TagBlocks
-	Files         map[string]*hcl.File
+	// WorkspaceTagDiagnostics are the diagnostics found while extracting the
+	// workspace tags. They are also included in the diagnostics returned by
+	// Preview.
+	WorkspaceTagDiagnostics hcl.Diagnostics
+	Files                   map[string]*hcl.File
+	// Modules are the evaluated modules, the root module first. They are
+	// what the parameters and tags were extracted from.
+	Modules terraform.Modules
 }
 
 func Preview(ctx context.Context, input Input, dir fs.FS) (*Output, hcl.Diagnostics) {
+	metrics := input.Metrics
+	if metrics == nil {
+		metrics = noopMetrics{}
+	}
+
+	tracer := tracerOrNoop(input.Tracer)
+	ctx, span := tracer.Start(ctx, "preview.Preview", trace.WithAttributes(
+		AttributeTemplateDir.String(input.TemplateDir),
+	))
+	defer span.End()
+
+	start := time.Now()
+	output, diags := preview(ctx, input, dir, tracer, newPhaseTimer(ctx, metrics, tracer))
+
+	var parameters int
+	if output != nil {
+		parameters = len(output.Parameters)
+	}
+	metrics.ObservePreview(time.Since(start), diags, parameters)
+
+	span.SetAttributes(
+		attribute.Int("preview.parameters", parameters),
+		attribute.Int("preview.diagnostics", len(diags)),
+	)
+	if diags.HasErrors() {
+		span.SetStatus(codes.Error, diags.Error())
+	}
+	return output, diags
+}
+
+func preview(ctx context.Context, input Input, dir fs.FS, tracer trace.Tracer, phases *phaseTimer) (*Output, hcl.Diagnostics) {
 	// TODO: FIX LOGGING
 	slog.SetLogLoggerLevel(slog.LevelDebug)
 	slog.SetDefault(slog.New(log.NewHandler(os.Stderr, nil)))
 
+	// The evaluation closes evaluated once it has started, and otherwise it
+	// is closed on return.
+	evaluated := input.Evaluated
+	defer func() {
+		if evaluated != nil {
+			close(evaluated)
+		}
+	}()
+
+	phases.begin(PhaseTFVars)
 	varFiles, err := tfVarFiles("", dir)
+	phases.end()
 	if err != nil {
 		return nil, hcl.Diagnostics{
 			{
@@ -50,7 +128,13 @@ func Preview(ctx context.Context, input Input, dir fs.FS) (*Output, hcl.Diagnost
 		}
 	}
 
+	if diags := canceled(ctx, "reading files"); diags != nil {
+		return nil, diags
+	}
+
+	phases.begin(PhasePlan)
 	planHook, err := PlanJSONHook(dir, input)
+	phases.end()
 	if err != nil {
 		return nil, hcl.Diagnostics{
 			{
@@ -73,54 +157,147 @@ func Preview(ctx context.Context, input Input, dir fs.FS) (*Output, hcl.Diagnost
 	}
 	var _ = ownerHook
 
-	// moduleSource is "" for a local module
-	p := parser.New(dir, "",
-		parser.OptionStopOnHCLError(false),
-		parser.OptionWithDownloads(false),
-		parser.OptionWithSkipCachedModules(true),
-		parser.OptionWithTFVarsPaths(varFiles...),
-		parser.OptionWithEvalHook(planHook),
-		parser.OptionWithEvalHook(ownerHook),
-		parser.OptionWithEvalHook(ParameterContextsEvalHook(input)),
-	)
-
-	err = p.ParseFS(ctx, ".")
+	workspaceHook, err := WorkspaceHook(dir, input)
 	if err != nil {
 		return nil, hcl.Diagnostics{
 			{
 				Severity: hcl.DiagError,
-				Summary:  "Parse terraform files",
+				Summary:  "Workspace hook",
 				Detail:   err.Error(),
 			},
 		}
 	}
 
-	modules, outputs, err := p.EvaluateAll(ctx)
+	// The hooks run during evaluation, and their spans are children of the
+	// span of the phase that calls them.
+	hookCtx := ctx
+
+	opts := []parser.Option{
+		parser.OptionStopOnHCLError(false),
+		parser.OptionWithDownloads(false),
+		parser.OptionWithSkipCachedModules(true),
+		parser.OptionWithTFVarsPaths(varFiles...),
+		parser.OptionWithEvalHook(budgetEvalHook(ctx, input.Budget)),
+		parser.OptionWithEvalHook(traceHook(&hookCtx, tracer, "plan", planHook)),
+		parser.OptionWithEvalHook(traceHook(&hookCtx, tracer, "owner", ownerHook)),
+		parser.OptionWithEvalHook(traceHook(&hookCtx, tracer, "workspace", workspaceHook)),
+		parser.OptionWithEvalHook(traceHook(&hookCtx, tracer, "parameters", ParameterContextsEvalHook(input))),
+	}
+
+	hookCtx = phases.begin(PhaseParse)
+	if input.ParseCache != nil {
+		cached, err := input.ParseCache.parserOption(dir)
+		if err != nil {
+			phases.end()
+			return nil, hcl.Diagnostics{
+				{
+					Severity: hcl.DiagError,
+					Summary:  "Parse terraform files",
+					Detail:   err.Error(),
+				},
+			}
+		}
+		opts = append(opts, cached)
+	}
+
+	// moduleSource is "" for a local module
+	p := parser.New(dir, "", opts...)
+	err = p.ParseFS(hookCtx, ".")
+	phases.end()
 	if err != nil {
 		return nil, hcl.Diagnostics{
 			{
 				Severity: hcl.DiagError,
-				Summary:  "Evaluate terraform files",
+				Summary:  "Parse terraform files",
 				Detail:   err.Error(),
 			},
 		}
 	}
 
+	if diags := canceled(ctx, "parsing"); diags != nil {
+		return nil, diags
+	}
+
+	hookCtx = phases.begin(PhaseEvaluate)
+	modules, outputs, evalDiags := evaluate(hookCtx, p, evaluated)
+	evaluated = nil
+	phases.end()
+	if evalDiags.HasErrors() {
+		return nil, evalDiags
+	}
+
+	if diags := canceled(ctx, "evaluation"); diags != nil {
+		return nil, diags
+	}
+
 	diags := make(hcl.Diagnostics, 0)
-	rp, rpDiags := RichParameters(modules)
-	tags, tagDiags := WorkspaceTags(modules, p.Files())
+	paramCtx := phases.begin(PhaseParameters)
+	rp, rpDiags := richParameters(paramCtx, tracer, modules)
+	phases.end()
+	phases.begin(PhaseTags)
+	files := rootFiles(p.Files(), input.ParseCache != nil)
+	tags, tagDiags := WorkspaceTags(modules, files)
+	phases.end()
 
 	// Add warnings
 	diags = diags.Extend(warnings(modules))
 
+	if budgetDiags := outputBudget(outputs, input.Budget); budgetDiags != nil {
+		diags = diags.Extend(budgetDiags)
+		outputs = cty.EmptyObjectVal
+	}
+
 	return &Output{
-		ModuleOutput:  outputs,
-		Parameters:    rp,
-		WorkspaceTags: tags,
-		Files:         p.Files(),
+		ModuleOutput:            outputs,
+		Parameters:              rp,
+		WorkspaceTags:           tags,
+		WorkspaceTagDiagnostics: tagDiags,
+		Files:                   files,
+		Modules:                 modules,
 	}, diags.Extend(rpDiags).Extend(tagDiags)
 }
 
+// rootFiles returns the files of the root module. The parser of the root
+// module only parses those, but a ParseCache hands it the files of every
+// module.
+func rootFiles(files map[string]*hcl.File, cached bool) map[string]*hcl.File {
+	if !cached {
+		return files
+	}
+	root := make(map[string]*hcl.File, len(files))
+	for name, file := range files {
+		if path.Dir(name) == "." {
+			root[name] = file
+		}
+	}
+	return root
+}
+
+// canceled returns an error diagnostic if the context is done. Preview checks
+// it between phases and evaluation iterations, as the evaluation of a single
+// iteration cannot be interrupted.
+func canceled(ctx context.Context, phase string) hcl.Diagnostics {
+	if err := ctx.Err(); err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return hcl.Diagnostics{
+				{
+					Severity: hcl.DiagError,
+					Summary:  "Preview timed out",
+					Detail:   fmt.Sprintf("The preview ran out of time after %s.", phase),
+				},
+			}
+		}
+		return hcl.Diagnostics{
+			{
+				Severity: hcl.DiagError,
+				Summary:  "Preview canceled",
+				Detail:   fmt.Sprintf("Canceled after %s: %s", phase, err.Error()),
+			},
+		}
+	}
+	return nil
+}
+
 func (i Input) RichParameterValue(key string) (string, bool) {
 	p, ok := i.ParameterValues[key]
 	return p, ok
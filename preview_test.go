@@ -5,10 +5,16 @@ import (
 	"encoding/json"
 	"os"
 	"path/filepath"
+	"sync"
 	"testing"
+	"testing/fstest"
+	"time"
 
+	"github.com/hashicorp/hcl/v2"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
 
 	"github.com/coder/preview"
 	"github.com/coder/preview/types"
@@ -447,6 +453,177 @@ func Test_Extract(t *testing.T) {
 	}
 }
 
+func TestPreviewCanceled(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	output, diags := preview.Preview(ctx, preview.Input{}, os.DirFS(filepath.Join("testdata", "static")))
+	require.Nil(t, output)
+	require.True(t, diags.HasErrors())
+	require.Equal(t, "Preview canceled", diags[0].Summary)
+}
+
+func TestPreviewBudget(t *testing.T) {
+	t.Parallel()
+
+	dir := fstest.MapFS{
+		"main.tf": &fstest.MapFile{Data: []byte(`
+resource "null_resource" "many" {
+  count = 50
+}
+
+output "big" {
+  value = join("", [for i in range(100) : "0123456789"])
+}
+`)},
+	}
+
+	for _, tc := range []struct {
+		name    string
+		budget  preview.Budget
+		summary string
+	}{
+		{
+			name:    "Iterations",
+			budget:  preview.Budget{MaxIterations: 1},
+			summary: "Evaluation iteration budget exceeded",
+		},
+		{
+			name:    "Blocks",
+			budget:  preview.Budget{MaxBlocks: 10},
+			summary: "Block budget exceeded",
+		},
+		{
+			name:    "Output",
+			budget:  preview.Budget{MaxOutputBytes: 100},
+			summary: "Output budget exceeded",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, diags := preview.Preview(context.Background(), preview.Input{Budget: tc.budget}, dir)
+			require.True(t, diags.HasErrors())
+			require.Equal(t, tc.summary, diags[len(diags)-1].Summary)
+		})
+	}
+
+	// A generous budget is not hit.
+	_, diags := preview.Preview(context.Background(), preview.Input{
+		Budget: preview.Budget{MaxIterations: 100, MaxBlocks: 100, MaxOutputBytes: 10_000},
+	}, dir)
+	require.False(t, diags.HasErrors(), diags.Error())
+}
+
+func TestPreviewEvaluationPanic(t *testing.T) {
+	t.Parallel()
+
+	dir := fstest.MapFS{
+		"main.tf": &fstest.MapFile{Data: []byte(`
+data "null_data_source" "values" {}
+`)},
+	}
+	// The attribute values of the plan are a list of mixed types, which
+	// panics when the plan is loaded into the evaluation.
+	plan := []byte(`{
+  "format_version": "1.2",
+  "prior_state": {
+    "format_version": "1.0",
+    "values": {
+      "root_module": {
+        "resources": [
+          {
+            "address": "data.null_data_source.values",
+            "mode": "data",
+            "type": "null_data_source",
+            "name": "values",
+            "values": {"mixed": [1, "a"]}
+          }
+        ]
+      }
+    }
+  }
+}`)
+
+	evaluated := make(chan struct{})
+	output, diags := preview.Preview(context.Background(), preview.Input{
+		PlanJSON:  plan,
+		Evaluated: evaluated,
+	}, dir)
+	require.Nil(t, output)
+	require.True(t, diags.HasErrors())
+	require.Equal(t, "Evaluation panicked", diags[0].Summary)
+	<-evaluated
+}
+
+func TestPreviewMetrics(t *testing.T) {
+	t.Parallel()
+
+	metrics := &recordMetrics{}
+	output, diags := preview.Preview(context.Background(), preview.Input{
+		Metrics: metrics,
+	}, os.DirFS(filepath.Join("testdata", "static")))
+	require.False(t, diags.HasErrors(), diags.Error())
+
+	require.Equal(t, []preview.Phase{
+		preview.PhaseTFVars,
+		preview.PhasePlan,
+		preview.PhaseParse,
+		preview.PhaseEvaluate,
+		preview.PhaseParameters,
+		preview.PhaseTags,
+	}, metrics.phases)
+	require.Equal(t, 1, metrics.previews)
+	require.Equal(t, len(output.Parameters), metrics.parameters)
+}
+
+func TestPreviewTracing(t *testing.T) {
+	t.Parallel()
+
+	tracer := &recordTracer{}
+	_, diags := preview.Preview(context.Background(), preview.Input{
+		Tracer:      tracer,
+		TemplateDir: "static",
+	}, os.DirFS(filepath.Join("testdata", "static")))
+	require.False(t, diags.HasErrors(), diags.Error())
+
+	require.Equal(t, "preview.Preview", tracer.spans[0])
+	require.Contains(t, tracer.spans, "preview.evaluate")
+	require.Contains(t, tracer.spans, "preview.EvalHook")
+	require.Contains(t, tracer.spans, "extract.ParameterFromBlock")
+}
+
+// recordTracer records the names of the spans started.
+type recordTracer struct {
+	noop.Tracer
+	mu    sync.Mutex
+	spans []string
+}
+
+func (r *recordTracer) Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.spans = append(r.spans, name)
+	return r.Tracer.Start(ctx, name, opts...)
+}
+
+type recordMetrics struct {
+	phases     []preview.Phase
+	previews   int
+	parameters int
+}
+
+func (m *recordMetrics) ObservePhase(phase preview.Phase, _ time.Duration) {
+	m.phases = append(m.phases, phase)
+}
+
+func (m *recordMetrics) ObservePreview(_ time.Duration, _ hcl.Diagnostics, parameters int) {
+	m.previews++
+	m.parameters = parameters
+}
+
 type assertParam func(t *testing.T, parameter types.Parameter)
 
 func ap() assertParam {
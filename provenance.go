@@ -0,0 +1,296 @@
+package preview
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/aquasecurity/trivy/pkg/iac/terraform"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/zclconf/go-cty/cty"
+
+	"github.com/coder/preview/types"
+)
+
+// inputResolver follows references through locals, variables, module
+// outputs and data source attributes until it reaches the template inputs
+// that an expression ultimately depends on.
+type inputResolver struct {
+	// children maps a module call block to the module it instantiated. The
+	// root module is keyed by nil.
+	children map[*terraform.Block]*terraform.Module
+}
+
+func newInputResolver(modules terraform.Modules) *inputResolver {
+	r := &inputResolver{
+		children: make(map[*terraform.Block]*terraform.Module),
+	}
+	for _, mod := range modules {
+		blocks := mod.GetBlocks()
+		if len(blocks) == 0 {
+			continue
+		}
+		r.children[blocks[0].ModuleBlock()] = mod
+	}
+	return r
+}
+
+// moduleOf returns the module that contains the block.
+func (r *inputResolver) moduleOf(block *terraform.Block) *terraform.Module {
+	return r.children[block.ModuleBlock()]
+}
+
+type resolveKey struct {
+	mod *terraform.Module
+	ref string
+}
+
+// Inputs returns the sorted, de-duplicated set of inputs that the expressions
+// depend on. The owner is the block the expressions belong to, and is used
+// to resolve 'count' and 'each' references.
+func (r *inputResolver) Inputs(owner *terraform.Block, exprs ...hcl.Expression) types.TagInputs {
+	found := make(map[types.TagInput]struct{})
+	visited := make(map[resolveKey]bool)
+	for _, expr := range exprs {
+		r.walk(r.moduleOf(owner), owner, expr, found, visited)
+	}
+
+	inputs := make(types.TagInputs, 0, len(found))
+	for in := range found {
+		inputs = append(inputs, in)
+	}
+	slices.SortFunc(inputs, func(a, b types.TagInput) int {
+		if c := strings.Compare(string(a.Kind), string(b.Kind)); c != 0 {
+			return c
+		}
+		if c := strings.Compare(a.Name, b.Name); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Reference, b.Reference)
+	})
+	return inputs
+}
+
+func (r *inputResolver) walk(mod *terraform.Module, owner *terraform.Block, expr hcl.Expression, found map[types.TagInput]struct{}, visited map[resolveKey]bool) {
+	if mod == nil || expr == nil {
+		return
+	}
+
+	for _, trav := range expr.Variables() {
+		names := traversalNames(trav)
+		if len(names) == 0 {
+			continue
+		}
+
+		key := resolveKey{mod: mod, ref: strings.Join(names, ".")}
+		switch names[0] {
+		case "count", "each":
+			// Meta arguments are scoped to the owning block, so the key is
+			// as well.
+			key.ref = fmt.Sprintf("%s:%s", owner.FullName(), names[0])
+		}
+		if visited[key] {
+			continue
+		}
+		visited[key] = true
+
+		switch names[0] {
+		case "data":
+			r.walkData(mod, names, found, visited)
+		case "local":
+			if len(names) < 2 {
+				continue
+			}
+			for _, block := range blocksOfType(mod, "locals") {
+				attr := block.GetAttribute(names[1])
+				if attr.IsNil() {
+					continue
+				}
+				r.walk(mod, block, attr.HCLAttribute().Expr, found, visited)
+			}
+		case "var":
+			if len(names) < 2 {
+				continue
+			}
+			r.walkVariable(mod, names[1], found, visited)
+		case "module":
+			if len(names) < 2 {
+				continue
+			}
+			r.walkModuleOutput(mod, names, found, visited)
+		case "count", "each":
+			if owner == nil {
+				continue
+			}
+			meta := "count"
+			if names[0] == "each" {
+				meta = "for_each"
+			}
+			attr := owner.GetAttribute(meta)
+			if attr.IsNil() {
+				continue
+			}
+			r.walk(mod, owner, attr.HCLAttribute().Expr, found, visited)
+		case "path", "terraform", "self":
+			// These are never template inputs.
+		default:
+			// Managed resources are not inputs themselves, but their
+			// attributes can reference inputs.
+			if len(names) < 2 {
+				continue
+			}
+			for _, block := range blocksOfType(mod, "resource") {
+				ref := block.Reference()
+				if ref.TypeLabel() != names[0] || ref.NameLabel() != names[1] {
+					continue
+				}
+				r.walkAttributes(mod, block, found, visited)
+			}
+		}
+	}
+}
+
+func (r *inputResolver) walkData(mod *terraform.Module, names []string, found map[types.TagInput]struct{}, visited map[resolveKey]bool) {
+	if len(names) < 3 {
+		return
+	}
+
+	for _, block := range blocksOfType(mod, "data") {
+		ref := block.Reference()
+		if ref.TypeLabel() != names[1] || ref.NameLabel() != names[2] {
+			continue
+		}
+
+		switch ref.TypeLabel() {
+		case types.BlockTypeParameter:
+			name := ref.NameLabel()
+			if nameVal := block.GetAttribute("name").Value(); nameVal.Type().Equals(cty.String) {
+				name = nameVal.AsString()
+			}
+			found[types.TagInput{
+				Kind:      types.TagInputKindParameter,
+				Name:      name,
+				Reference: block.FullName(),
+			}] = struct{}{}
+		case "coder_workspace_owner":
+			attr := ""
+			if len(names) > 3 {
+				attr = names[3]
+			}
+			found[types.TagInput{
+				Kind:      types.TagInputKindWorkspaceOwner,
+				Name:      attr,
+				Reference: block.FullName(),
+			}] = struct{}{}
+		default:
+			found[types.TagInput{
+				Kind:      types.TagInputKindDataSource,
+				Name:      block.LocalName(),
+				Reference: block.FullName(),
+			}] = struct{}{}
+			// The arguments of a data source can depend on other inputs.
+			r.walkAttributes(mod, block, found, visited)
+		}
+	}
+}
+
+// walkVariable resolves 'var.<name>'. Inside a submodule, the variable is
+// set by the module call in the parent module. In the root module, the
+// variable is an input itself.
+func (r *inputResolver) walkVariable(mod *terraform.Module, name string, found map[types.TagInput]struct{}, visited map[resolveKey]bool) {
+	var call *terraform.Block
+	for callBlock, child := range r.children {
+		if child == mod {
+			call = callBlock
+			break
+		}
+	}
+
+	if call != nil {
+		attr := call.GetAttribute(name)
+		if !attr.IsNil() {
+			r.walk(r.moduleOf(call), call, attr.HCLAttribute().Expr, found, visited)
+			return
+		}
+	}
+
+	for _, block := range blocksOfType(mod, "variable") {
+		if block.Reference().NameLabel() != name {
+			continue
+		}
+
+		if call == nil {
+			found[types.TagInput{
+				Kind:      types.TagInputKindVariable,
+				Name:      name,
+				Reference: block.FullName(),
+			}] = struct{}{}
+		}
+
+		def := block.GetAttribute("default")
+		if !def.IsNil() {
+			r.walk(mod, block, def.HCLAttribute().Expr, found, visited)
+		}
+	}
+}
+
+func (r *inputResolver) walkModuleOutput(mod *terraform.Module, names []string, found map[types.TagInput]struct{}, visited map[resolveKey]bool) {
+	for _, call := range blocksOfType(mod, "module") {
+		if call.Reference().NameLabel() != names[1] {
+			continue
+		}
+
+		child, ok := r.children[call]
+		if !ok {
+			continue
+		}
+
+		for _, output := range blocksOfType(child, "output") {
+			// Referencing the module as a whole depends on every output.
+			if len(names) > 2 && output.Reference().NameLabel() != names[2] {
+				continue
+			}
+			attr := output.GetAttribute("value")
+			if attr.IsNil() {
+				continue
+			}
+			r.walk(child, output, attr.HCLAttribute().Expr, found, visited)
+		}
+	}
+}
+
+func (r *inputResolver) walkAttributes(mod *terraform.Module, block *terraform.Block, found map[types.TagInput]struct{}, visited map[resolveKey]bool) {
+	for _, attr := range block.GetAttributes() {
+		r.walk(mod, block, attr.HCLAttribute().Expr, found, visited)
+	}
+	for _, child := range block.AllBlocks() {
+		r.walkAttributes(mod, child, found, visited)
+	}
+}
+
+func blocksOfType(mod *terraform.Module, blockType string) terraform.Blocks {
+	blocks := make(terraform.Blocks, 0)
+	for _, block := range mod.GetBlocks() {
+		if block.Type() == blockType {
+			blocks = append(blocks, block)
+		}
+	}
+	return blocks
+}
+
+// traversalNames returns the leading names of a traversal, stopping at the
+// first index.
+func traversalNames(trav hcl.Traversal) []string {
+	names := make([]string, 0, len(trav))
+	for _, p := range trav {
+		switch part := p.(type) {
+		case hcl.TraverseRoot:
+			names = append(names, part.Name)
+		case hcl.TraverseAttr:
+			names = append(names, part.Name)
+		default:
+			return names
+		}
+	}
+	return names
+}
@@ -0,0 +1,75 @@
+package preview_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/coder/preview"
+	"github.com/coder/preview/types"
+)
+
+func TestTagProvenance(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		name  string
+		dir   string
+		input preview.Input
+		// expInputs maps tag keys to the "kind: name" of each input.
+		expInputs map[string][]string
+	}{
+		{
+			name: "static",
+			dir:  "static",
+			expInputs: map[string][]string{
+				"zone": {},
+			},
+		},
+		{
+			name: "parameter",
+			dir:  "paramtags",
+			expInputs: map[string][]string{
+				"zone": {"parameter: Region"},
+			},
+		},
+		{
+			name: "through locals and modules",
+			dir:  "demo",
+			input: preview.Input{
+				PlanJSONPath: "plan.json",
+				Owner: types.WorkspaceOwner{
+					Groups: []string{"admin"},
+				},
+			},
+			expInputs: map[string][]string{
+				"hash":    {"data_source: data.docker_registry_image.coder"},
+				"cluster": {"parameter: security_level", "workspace_owner: groups"},
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			dirFS := os.DirFS(filepath.Join("testdata", tc.dir))
+			output, diags := preview.Preview(t.Context(), tc.input, dirFS)
+			require.False(t, diags.HasErrors(), diags.Error())
+
+			prov := output.WorkspaceTags.Provenance()
+			require.Len(t, prov, len(tc.expInputs))
+			for _, p := range prov {
+				exp, ok := tc.expInputs[p.Key]
+				require.True(t, ok, "unexpected tag %q", p.Key)
+
+				got := make([]string, 0, len(p.Inputs))
+				for _, in := range p.Inputs {
+					got = append(got, in.String())
+				}
+				assert.ElementsMatch(t, exp, got, "inputs of tag %q", p.Key)
+			}
+		})
+	}
+}
@@ -14,6 +14,7 @@ import { Input } from "./components/Input/Input";
 import { Switch } from "./components/Switch/Switch";
 import { useUsers } from './hooks/useUsers';
 import { useDirectories } from './hooks/useDirectories';
+import { wsUrl as serverWsUrl } from './server';
 import { CollapsibleSummary } from "./components/CollapsibleSummary/CollapsibleSummary";
 import { Slider } from "./components/ui/slider";
 import ReactJson from 'react-json-view';
@@ -25,7 +26,6 @@ import { Badge } from "./components/Badge/Badge";
 import { Button } from "./components/Button/Button";
 
 export function DynamicForm() {
-  const serverAddress = "localhost:8100";
   const [user, setUser] = useState<string>("");
   const [plan, setPlan] = useState<string>("");
   const [urlTestdata, setUrlTestdata] = useState<string>("");
@@ -53,7 +53,7 @@ export function DynamicForm() {
     directories, 
     isLoading, 
     fetchError 
-  } = useDirectories(serverAddress, urlTestdata);
+  } = useDirectories(urlTestdata);
   
   const parameterValue = (value: NullHCLString) => {
     return value.valid ? value.value : "";
@@ -63,13 +63,14 @@ export function DynamicForm() {
     reset({});
     setPrevValues({});
     setResponse(null);
-    setCurrentId(0);
     
     const params = new URLSearchParams(window.location.search);
 
     if (type === 'testdata') {
       params.set('testdata', value);
       setUrlTestdata(value);
+      // A new connection starts counting request IDs from the beginning.
+      setCurrentId(0);
       // Clear user and plan when testdata changes
       setPlan("");
       setUser("");
@@ -101,11 +102,14 @@ export function DynamicForm() {
     users, 
     isLoading: usersLoading, 
     fetchError: usersFetchError 
-  } = useUsers(serverAddress, urlTestdata);
+  } = useUsers(urlTestdata);
 
-  const wsUrl = `ws://${serverAddress}/ws/${encodeURIComponent(urlTestdata)}?${plan ? `plan=${encodeURIComponent(plan)}&` : ''}${user ? `user=${encodeURIComponent(user)}` : ''}`;
+  const wsQuery = new URLSearchParams();
+  if (plan) wsQuery.set('plan', plan);
+  if (user) wsQuery.set('user', user);
+  const wsUrl = serverWsUrl(`/ws/${encodeURIComponent(urlTestdata)}`, wsQuery);
 
-  const { message: serverResponse, sendMessage, connectionStatus } = useWebSocket<Response>(wsUrl, urlTestdata, user, plan);
+  const { message: serverResponse, sendMessage, connectionStatus } = useWebSocket<Response>(wsUrl, urlTestdata);
 
   const [response, setResponse] = useState<Response | null>(null);
   const [currentId, setCurrentId] = useState<number>(0);
@@ -179,6 +183,26 @@ export function DynamicForm() {
     }
   }, [watchedValues, response, sendMessage, prevValues, debouncedTimer]);
 
+  // Switch the user and plan on the open connection.
+  useEffect(() => {
+    if (connectionStatus !== 'connected') return;
+
+    setCurrentId(prevId => {
+      const newId = prevId + 1;
+      const request: Request = {
+        id: newId,
+        inputs: methods.getValues(),
+        session: {
+          user_name: user,
+          plan_path: plan,
+        },
+      };
+      sendMessage(request);
+      return newId;
+    });
+    // eslint-disable-next-line react-hooks/exhaustive-deps
+  }, [user, plan]);
+
   // Clean up the timer when component unmounts
   useEffect(() => {
     return () => {
@@ -535,6 +559,21 @@ export function DynamicForm() {
         </form>
       </FormProvider>
 
+      {testcontrols && response.workspace_tags &&
+        <CollapsibleSummary className="mt-12" label="Workspace Tags">
+          <div className="text-left">
+            {Object.entries(response.workspace_tags.tags ?? {}).map(([key, value]) => (
+              <div key={key}><strong>{key}</strong>: {value}</div>
+            ))}
+            {(response.workspace_tags.unusable ?? []).map((tag, i) => (
+              <div key={`unusable-${i}`} style={{ color: "orange" }}>
+                <strong>{tag.key}</strong>: {tag.value} (unusable)
+              </div>
+            ))}
+          </div>
+        </CollapsibleSummary>
+      }
+
       {testcontrols &&
         <CollapsibleSummary className="mt-12" label="Server Response JSON">
           <div className="rounded-lg bg-gray-50 p-4 dark:bg-gray-900 text-left">
@@ -1,6 +1,7 @@
 import { useState, useEffect } from 'react';
+import { authHeaders, httpUrl } from '../server';
 
-export function useDirectories(serverAddress: string, initialTestdata: string) {
+export function useDirectories(initialTestdata: string) {
   const [directories, setDirectories] = useState<string[]>([]);
   const [testdata, setTestdata] = useState<string>(initialTestdata);
   const [isLoading, setIsLoading] = useState<boolean>(true);
@@ -11,10 +12,11 @@ export function useDirectories(serverAddress: string, initialTestdata: string) {
     setFetchError(null);
     
     // Use mode: 'cors' explicitly and add credentials if needed
-    fetch(`http://${serverAddress}/directories`, {
+    fetch(httpUrl('/directories'), {
       mode: 'cors',
       headers: {
-        'Accept': 'application/json'
+        'Accept': 'application/json',
+        ...authHeaders()
       }
     })
       .then(response => {
@@ -38,7 +40,7 @@ export function useDirectories(serverAddress: string, initialTestdata: string) {
         setDirectories(["conditional"]);
         setIsLoading(false);
       });
-  }, [serverAddress, testdata]);
+  }, [testdata]);
 
   return { directories, testdata, setTestdata, isLoading, fetchError };
 } 
\ No newline at end of file
@@ -1,10 +1,11 @@
 import { useState, useEffect } from 'react';
+import { authHeaders, httpUrl } from '../server';
 
 interface User {
   groups: string[];
 }
 
-export function useUsers(serverAddress: string, testdata: string) {
+export function useUsers(testdata: string) {
   const [users, setUsers] = useState<Record<string, User>>({});
   const [isLoading, setIsLoading] = useState<boolean>(true);
   const [fetchError, setFetchError] = useState<string | null>(null);
@@ -14,10 +15,11 @@ export function useUsers(serverAddress: string, testdata: string) {
     setFetchError(null);
     
     if (testdata !== "") {
-      fetch(`http://${serverAddress}/users/${testdata}`, {
+      fetch(httpUrl(`/users/${testdata}`), {
         mode: 'cors',
         headers: {
-          'Accept': 'application/json'
+          'Accept': 'application/json',
+          ...authHeaders()
         }
       })
         .then(response => {
@@ -36,7 +38,7 @@ export function useUsers(serverAddress: string, testdata: string) {
           setIsLoading(false);
         });
     }
-  }, [serverAddress, testdata]);
+  }, [testdata]);
 
   return { users, isLoading, fetchError };
 } 
\ No newline at end of file
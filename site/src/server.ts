@@ -0,0 +1,32 @@
+// The preview server the frontend talks to. It is configured with URL
+// parameters, so that a link can point at a server started with
+// '--tls-cert-file' or '--token':
+//
+//   ?server=localhost:8100&tls=true&token=...
+const params = new URLSearchParams(window.location.search);
+
+export const serverAddress = params.get("server") ?? "localhost:8100";
+
+const secure = params.get("tls") === "true" || window.location.protocol === "https:";
+const token = params.get("token") ?? "";
+
+// httpUrl returns the URL of an HTTP endpoint of the server.
+export function httpUrl(path: string): string {
+  return `${secure ? "https" : "http"}://${serverAddress}${path}`;
+}
+
+// wsUrl returns the URL of a websocket endpoint of the server. Browsers
+// cannot set headers on websocket connections, so the token is sent as a
+// query parameter.
+export function wsUrl(path: string, query: URLSearchParams): string {
+  const q = new URLSearchParams(query);
+  if (token !== "") {
+    q.set("token", token);
+  }
+  return `${secure ? "wss" : "ws"}://${serverAddress}${path}?${q.toString()}`;
+}
+
+// authHeaders returns the headers that authenticate a request to the server.
+export function authHeaders(): Record<string, string> {
+  return token !== "" ? { Authorization: `Bearer ${token}` } : {};
+}
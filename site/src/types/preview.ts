@@ -8,6 +8,14 @@ export const DiagnosticSeverityStrings: DiagnosticSeverityString[] = ["error", "
 // From types/diagnostics.go
 export type Diagnostics = readonly (FriendlyDiagnostic)[];
 
+// From web/patches.go
+export interface FilePatch {
+    readonly path: string;
+    readonly content: string;
+    readonly delete?: boolean;
+    readonly revert?: boolean;
+}
+
 // From types/diagnostics.go
 export interface FriendlyDiagnostic {
     readonly severity: DiagnosticSeverityString;
@@ -27,6 +35,13 @@ export interface Parameter extends ParameterData {
     readonly diagnostics: Diagnostics;
 }
 
+// From web/delta.go
+export interface ParameterChange {
+    readonly name: string;
+    // empty interface{} type, falling back to unknown
+    readonly fields: Record<string, unknown>;
+}
+
 // From types/parameter.go
 export interface ParameterData {
     readonly name: string;
@@ -67,35 +82,151 @@ export interface ParameterValidation {
     readonly validation_min: number | null;
     readonly validation_max: number | null;
     readonly validation_monotonic: string | null;
+    readonly validation_invalid: boolean | null;
+}
+
+// From web/preview.go
+export interface PreviewRequest {
+    readonly inputs: Record<string, string>;
+    readonly owner: WorkspaceOwner;
+    // empty interface{} type, falling back to unknown
+    readonly plan_json?: Record<string, unknown>;
+    readonly workspace: Workspace;
+}
+
+// From web/preview.go
+export interface PreviewResponse extends Result {
+    // empty interface{} type, falling back to unknown
+    readonly module_outputs: Record<string, unknown>;
 }
 
 // From web/session.go
 export interface Request {
     readonly id: number;
     readonly inputs: Record<string, string>;
+    readonly session?: SessionInputsUpdate;
+    readonly files?: readonly FilePatch[];
+    readonly snapshot?: boolean;
 }
 
 // From web/session.go
-export interface Response {
+export interface Response extends Result {
     readonly id: number;
+    readonly session: SessionInputs;
+    readonly reloaded?: boolean;
+    readonly seq?: number;
+    readonly delta?: ResponseDelta;
+}
+
+// From web/delta.go
+export interface ResponseDelta {
+    readonly base_seq: number;
+    readonly added: readonly Parameter[];
+    readonly removed: readonly string[];
+    readonly changed: readonly ParameterChange[];
+    readonly order?: readonly string[];
+    readonly diagnostics_changed: boolean;
+    readonly diagnostics: Diagnostics;
+    readonly workspace_tags?: WorkspaceTags;
+}
+
+// From web/session.go
+export interface Result {
     readonly diagnostics: Diagnostics;
     readonly parameters: readonly Parameter[];
+    readonly workspace_tags: WorkspaceTags;
 }
 
 // From web/session.go
 export interface SessionInputs {
-    readonly PlanPath: string;
-    readonly User: WorkspaceOwner;
+    readonly plan_path: string;
+    readonly user_name: string;
+    readonly user: WorkspaceOwner;
+    readonly previous_values: Record<string, string>;
+}
+
+// From web/session.go
+export interface SessionInputsUpdate {
+    readonly plan_path?: string;
+    readonly user_name?: string;
+    readonly user?: WorkspaceOwner;
+    readonly previous_values?: Record<string, string>;
+}
+
+// From types/tags.go
+export interface TagInput {
+    readonly kind: TagInputKind;
+    readonly name: string;
+    readonly reference: string;
+}
+
+// From types/tags.go
+export type TagInputKind = "data_source" | "parameter" | "variable" | "workspace_owner";
+
+export const TagInputKinds: TagInputKind[] = ["data_source", "parameter", "variable", "workspace_owner"];
+
+// From types/tags.go
+export type TagInputs = readonly TagInput[];
+
+// From types/tags.go
+export interface TagProvenance {
+    readonly key: string;
+    readonly value: string;
+    readonly known: boolean;
+    readonly inputs: TagInputs;
+}
+
+// From web/uploads.go
+export interface UploadResponse {
+    readonly id: string;
 }
 
+// From web/users.go
+export const UsersFile = "users.json";
+
 // From types/parameter.go
 export const ValidationMonotonicDecreasing = "decreasing";
 
 // From types/parameter.go
 export const ValidationMonotonicIncreasing = "increasing";
 
+// From types/workspace.go
+export interface Workspace {
+    readonly id: string;
+    readonly name: string;
+    readonly access_url: string;
+    readonly access_port: number;
+    readonly start_count: number;
+    readonly transition: string;
+    readonly is_prebuild: boolean;
+    readonly prebuild_count: number;
+    readonly template_id: string;
+    readonly template_name: string;
+    readonly template_version: string;
+}
+
 // From types/owner.go
 export interface WorkspaceOwner {
+    readonly id: string;
+    readonly name: string;
+    readonly full_name: string;
+    readonly email: string;
+    readonly ssh_public_key: string;
     readonly groups: readonly string[];
+    readonly login_type: string;
+    readonly rbac_roles: readonly WorkspaceOwnerRBACRole[];
+}
+
+// From types/owner.go
+export interface WorkspaceOwnerRBACRole {
+    readonly name: string;
+    readonly org_id: string;
+}
+
+// From web/session.go
+export interface WorkspaceTags {
+    readonly tags: Record<string, string>;
+    readonly unusable: readonly TagProvenance[];
+    readonly diagnostics: Diagnostics;
 }
 
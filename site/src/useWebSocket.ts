@@ -1,6 +1,6 @@
 import { useEffect, useRef, useState, useCallback } from "react";
 
-export function useWebSocket<T>(url: string, testdata: string, user: string, plan: string) {
+export function useWebSocket<T>(url: string, testdata: string) {
   const [message, setMessage] = useState<T | null>(null);
   const [connectionStatus, setConnectionStatus] = useState<'connecting' | 'connected' | 'disconnected'>('connecting');
   const wsRef = useRef<WebSocket | null>(null);
@@ -70,7 +70,9 @@ export function useWebSocket<T>(url: string, testdata: string, user: string, pla
         wsRef.current = null;
       }
     };
-  }, [testdata, user, plan, connectWebSocket]); // Remove url from dependencies
+  // The user and plan are changed with session updates, so they do not
+  // require a new connection.
+  }, [testdata, connectWebSocket]); // Remove url from dependencies
 
   const sendMessage = (data: unknown) => {
     if (wsRef.current && wsRef.current.readyState === WebSocket.OPEN) {
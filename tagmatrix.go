@@ -0,0 +1,291 @@
+package preview
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"maps"
+	"math"
+	"math/rand"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/hcl/v2"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/coder/preview/types"
+)
+
+const (
+	// DefaultTagMatrixMaxCombinations is the number of parameter combinations
+	// previewed when no limit is given.
+	DefaultTagMatrixMaxCombinations = 256
+)
+
+type TagMatrixOptions struct {
+	// MaxCombinations caps the number of previews. If the number of
+	// combinations exceeds the cap, a random sample is previewed instead.
+	MaxCombinations int
+	// Seed makes the sample deterministic.
+	Seed int64
+	// Concurrency is the number of previews run in parallel. It defaults to
+	// GOMAXPROCS.
+	Concurrency int
+}
+
+// TagMatrixDimension is a parameter that influences the workspace tags, and
+// the values it can take.
+type TagMatrixDimension struct {
+	Parameter string   `json:"parameter"`
+	Values    []string `json:"values"`
+}
+
+// TagMatrixSet is a distinct set of workspace tags, and an example of the
+// parameter values that produce it.
+type TagMatrixSet struct {
+	Tags map[string]string `json:"tags"`
+	// UnusableTags are the keys of tags that could not be resolved.
+	UnusableTags []string          `json:"unusable_tags"`
+	Example      map[string]string `json:"example"`
+	// Count is the number of previewed combinations that produced this set.
+	Count int `json:"count"`
+}
+
+type TagMatrix struct {
+	Dimensions []TagMatrixDimension `json:"dimensions"`
+	// Combinations is the total number of parameter combinations.
+	Combinations int `json:"combinations"`
+	// Previewed is the number of combinations that were previewed. This is
+	// less than Combinations if the space was sampled.
+	Previewed int  `json:"previewed"`
+	Sampled   bool `json:"sampled"`
+	// Invalid is the number of previewed combinations that returned errors,
+	// for example a value that fails validation. These combinations cannot be
+	// used to create a workspace, so their tags are not included.
+	Invalid int            `json:"invalid"`
+	Sets    []TagMatrixSet `json:"sets"`
+
+	// Files are the parsed files of the preview with the given input, that
+	// the returned diagnostics refer to.
+	Files map[string]*hcl.File `json:"-"`
+}
+
+// WorkspaceTagMatrix previews the template for every combination of the
+// option-backed parameters that influence the workspace tags, and reports the
+// distinct tag sets that can be produced.
+//
+// Only parameters that exist with the given input are enumerated. The
+// remaining parameter values are taken from the input.
+func WorkspaceTagMatrix(ctx context.Context, input Input, dir fs.FS, opts TagMatrixOptions) (*TagMatrix, hcl.Diagnostics) {
+	if opts.MaxCombinations <= 0 {
+		opts.MaxCombinations = DefaultTagMatrixMaxCombinations
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = runtime.GOMAXPROCS(0)
+	}
+
+	base, diags := Preview(ctx, input, dir)
+	if base == nil {
+		return nil, diags
+	}
+
+	dims := tagMatrixDimensions(base)
+	combos, total := tagMatrixCombinations(dims, opts)
+
+	matrix := &TagMatrix{
+		Dimensions:   dims,
+		Combinations: total,
+		Previewed:    len(combos),
+		Sampled:      len(combos) < total,
+		Sets:         make([]TagMatrixSet, 0),
+		Files:        base.Files,
+	}
+
+	var (
+		mu   sync.Mutex
+		sets = make(map[string]*TagMatrixSet)
+	)
+	eg, egCtx := errgroup.WithContext(ctx)
+	eg.SetLimit(opts.Concurrency)
+	for _, combo := range combos {
+		eg.Go(func() error {
+			values := maps.Clone(input.ParameterValues)
+			if values == nil {
+				values = make(map[string]string)
+			}
+			maps.Copy(values, combo)
+
+			comboInput := input
+			comboInput.ParameterValues = values
+			output, comboDiags := Preview(egCtx, comboInput, dir)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if output == nil || comboDiags.HasErrors() {
+				matrix.Invalid++
+				return nil
+			}
+
+			tags := output.WorkspaceTags.Tags()
+			unusable := output.WorkspaceTags.UnusableTags().SafeNames()
+			slices.Sort(unusable)
+			key := tagSetKey(tags, unusable)
+			set, ok := sets[key]
+			if !ok {
+				set = &TagMatrixSet{
+					Tags:         tags,
+					UnusableTags: unusable,
+					Example:      combo,
+				}
+				sets[key] = set
+			}
+			set.Count++
+			return nil
+		})
+	}
+	_ = eg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return nil, diags.Append(&hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Tag matrix canceled",
+			Detail:   err.Error(),
+		})
+	}
+
+	for _, key := range slices.Sorted(maps.Keys(sets)) {
+		matrix.Sets = append(matrix.Sets, *sets[key])
+	}
+	return matrix, diags
+}
+
+// tagMatrixDimensions returns the option-backed parameters that at least one
+// workspace tag depends on.
+func tagMatrixDimensions(output *Output) []TagMatrixDimension {
+	influences := make(map[string]bool)
+	for _, prov := range output.WorkspaceTags.Provenance() {
+		for _, name := range prov.Inputs.OfKind(types.TagInputKindParameter).Names() {
+			influences[name] = true
+		}
+	}
+
+	dims := make([]TagMatrixDimension, 0)
+	for _, param := range output.Parameters {
+		if !influences[param.Name] {
+			continue
+		}
+
+		values := make([]string, 0, len(param.Options))
+		switch {
+		case len(param.Options) > 0:
+			for _, opt := range param.Options {
+				if !opt.Value.IsKnown() {
+					continue
+				}
+				v := opt.Value.AsString()
+				if param.Type == types.ParameterTypeListString {
+					// Multi-select parameters are enumerated one option
+					// at a time.
+					data, _ := json.Marshal([]string{v})
+					v = string(data)
+				}
+				values = append(values, v)
+			}
+		case param.Type == types.ParameterTypeBoolean:
+			values = append(values, "true", "false")
+		}
+
+		if len(values) == 0 {
+			continue
+		}
+		dims = append(dims, TagMatrixDimension{
+			Parameter: param.Name,
+			Values:    values,
+		})
+	}
+	return dims
+}
+
+// tagMatrixCombinations returns the combinations to preview, and the total
+// number of combinations. If the total exceeds the maximum, a random sample
+// of distinct combinations is returned.
+func tagMatrixCombinations(dims []TagMatrixDimension, opts TagMatrixOptions) ([]map[string]string, int) {
+	total := totalCombinations(dims)
+
+	combo := func(indexes []int) map[string]string {
+		values := make(map[string]string, len(dims))
+		for i, dim := range dims {
+			values[dim.Parameter] = dim.Values[indexes[i]]
+		}
+		return values
+	}
+
+	if total <= opts.MaxCombinations {
+		combos := make([]map[string]string, 0, total)
+		indexes := make([]int, len(dims))
+		for {
+			combos = append(combos, combo(indexes))
+
+			// Increment the indexes like an odometer.
+			i := len(dims) - 1
+			for ; i >= 0; i-- {
+				indexes[i]++
+				if indexes[i] < len(dims[i].Values) {
+					break
+				}
+				indexes[i] = 0
+			}
+			if i < 0 {
+				return combos, total
+			}
+		}
+	}
+
+	rnd := rand.New(rand.NewSource(opts.Seed))
+	seen := make(map[string]bool)
+	combos := make([]map[string]string, 0, opts.MaxCombinations)
+	// Sampling with rejection. The space is larger than the cap, so
+	// collisions are rare.
+	for attempts := 0; len(combos) < opts.MaxCombinations && attempts < opts.MaxCombinations*10; attempts++ {
+		indexes := make([]int, len(dims))
+		parts := make([]string, len(dims))
+		for i, dim := range dims {
+			indexes[i] = rnd.Intn(len(dim.Values))
+			parts[i] = fmt.Sprint(indexes[i])
+		}
+		key := strings.Join(parts, ",")
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		combos = append(combos, combo(indexes))
+	}
+	return combos, total
+}
+
+// totalCombinations returns the size of the combination space. Very large
+// spaces saturate rather than overflow.
+func totalCombinations(dims []TagMatrixDimension) int {
+	total := 1
+	for _, dim := range dims {
+		if total > math.MaxInt32/len(dim.Values) {
+			return math.MaxInt32
+		}
+		total *= len(dim.Values)
+	}
+	return total
+}
+
+func tagSetKey(tags map[string]string, unusable []string) string {
+	var key strings.Builder
+	for _, k := range slices.Sorted(maps.Keys(tags)) {
+		_, _ = fmt.Fprintf(&key, "%q=%q,", k, tags[k])
+	}
+	for _, k := range unusable {
+		_, _ = fmt.Fprintf(&key, "%q=?,", k)
+	}
+	return key.String()
+}
@@ -0,0 +1,60 @@
+package preview_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/coder/preview"
+	"github.com/coder/preview/types"
+)
+
+func TestWorkspaceTagMatrix(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Enumerate", func(t *testing.T) {
+		t.Parallel()
+
+		matrix, diags := preview.WorkspaceTagMatrix(t.Context(), preview.Input{
+			PlanJSONPath: "plan.json",
+			Owner: types.WorkspaceOwner{
+				Groups: []string{"admin"},
+			},
+		}, os.DirFS("testdata/demo"), preview.TagMatrixOptions{})
+		require.False(t, diags.HasErrors(), diags.Error())
+
+		// The diagnostics refer to the files of the preview with the input.
+		assert.Contains(t, matrix.Files, "main.tf")
+
+		require.Len(t, matrix.Dimensions, 1)
+		assert.Equal(t, "security_level", matrix.Dimensions[0].Parameter)
+		assert.Equal(t, 3, matrix.Combinations)
+		assert.False(t, matrix.Sampled)
+
+		clusters := make(map[string]string)
+		for _, set := range matrix.Sets {
+			clusters[set.Example["security_level"]] = set.Tags["cluster"]
+		}
+		assert.Equal(t, map[string]string{
+			"high":   "confidential",
+			"medium": "production",
+			"low":    "public",
+		}, clusters)
+	})
+
+	t.Run("Sampled", func(t *testing.T) {
+		t.Parallel()
+
+		matrix, diags := preview.WorkspaceTagMatrix(t.Context(), preview.Input{}, os.DirFS("testdata/paramtags"), preview.TagMatrixOptions{
+			MaxCombinations: 1,
+		})
+		require.False(t, diags.HasErrors(), diags.Error())
+
+		assert.Equal(t, 2, matrix.Combinations)
+		assert.Equal(t, 1, matrix.Previewed)
+		assert.True(t, matrix.Sampled)
+		require.Len(t, matrix.Sets, 1)
+	})
+}
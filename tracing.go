@@ -0,0 +1,49 @@
+package preview
+
+import (
+	"context"
+
+	"github.com/aquasecurity/trivy/pkg/iac/terraform"
+	tfcontext "github.com/aquasecurity/trivy/pkg/iac/terraform/context"
+	"github.com/zclconf/go-cty/cty"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// Span attribute keys.
+const (
+	AttributeTemplateDir = attribute.Key("preview.template_dir")
+	AttributePhase       = attribute.Key("preview.phase")
+	AttributeHook        = attribute.Key("preview.hook")
+	AttributeIteration   = attribute.Key("preview.iteration")
+	AttributeParameter   = attribute.Key("preview.parameter")
+	AttributeBlock       = attribute.Key("preview.block")
+)
+
+func tracerOrNoop(tracer trace.Tracer) trace.Tracer {
+	if tracer == nil {
+		return noop.NewTracerProvider().Tracer("github.com/coder/preview")
+	}
+	return tracer
+}
+
+// traceHook records a span for every call of the eval hook. The evaluator
+// calls each hook once per iteration, so the calls are counted to tell the
+// iterations apart.
+//
+// Hooks are not given a context, so the parent is read from the pointer
+// when the hook is called.
+func traceHook(parent *context.Context, tracer trace.Tracer, name string, hook func(ctx *tfcontext.Context, blocks terraform.Blocks, inputVars map[string]cty.Value)) func(ctx *tfcontext.Context, blocks terraform.Blocks, inputVars map[string]cty.Value) {
+	var iteration int
+	return func(ctx *tfcontext.Context, blocks terraform.Blocks, inputVars map[string]cty.Value) {
+		iteration++
+		_, span := tracer.Start(*parent, "preview.EvalHook", trace.WithAttributes(
+			AttributeHook.String(name),
+			AttributeIteration.Int(iteration),
+		))
+		defer span.End()
+
+		hook(ctx, blocks, inputVars)
+	}
+}
@@ -27,6 +27,30 @@ func (d Diagnostics) MarshalJSON() ([]byte, error) {
 	return json.Marshal(cpy)
 }
 
+// UnmarshalJSON restores the severity, summary and detail of each
+// diagnostic. Everything else was lost when it was marshaled.
+func (d *Diagnostics) UnmarshalJSON(data []byte) error {
+	var friendly []FriendlyDiagnostic
+	if err := json.Unmarshal(data, &friendly); err != nil {
+		return err
+	}
+
+	diags := make(Diagnostics, 0, len(friendly))
+	for _, f := range friendly {
+		severity := hcl.DiagError
+		if f.Severity == DiagnosticSeverityWarning {
+			severity = hcl.DiagWarning
+		}
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: severity,
+			Summary:  f.Summary,
+			Detail:   f.Detail,
+		})
+	}
+	*d = diags
+	return nil
+}
+
 type DiagnosticSeverityString string
 
 const (
@@ -1,6 +1,8 @@
 package types
 
 import (
+	"fmt"
+
 	"github.com/aquasecurity/trivy/pkg/iac/terraform"
 
 	"github.com/coder/preview/hclext"
@@ -9,6 +11,16 @@ import (
 // @typescript-ignore TagBlocks
 type TagBlocks []TagBlock
 
+// Provenance returns every tag alongside the template inputs its key and
+// value depend on.
+func (b TagBlocks) Provenance() []TagProvenance {
+	prov := make([]TagProvenance, 0)
+	for _, block := range b {
+		prov = append(prov, block.Tags.Provenance()...)
+	}
+	return prov
+}
+
 func (b TagBlocks) Tags() map[string]string {
 	tags := make(map[string]string)
 	for _, block := range b {
@@ -61,6 +73,14 @@ func (b TagBlock) ValidTags() map[string]string {
 // @typescript-ignore Tags
 type Tags []Tag
 
+func (t Tags) Provenance() []TagProvenance {
+	prov := make([]TagProvenance, 0, len(t))
+	for _, tag := range t {
+		prov = append(prov, tag.Provenance())
+	}
+	return prov
+}
+
 func (t Tags) SafeNames() []string {
 	names := make([]string, 0)
 	for _, tag := range t {
@@ -73,6 +93,9 @@ func (t Tags) SafeNames() []string {
 type Tag struct {
 	Key   HCLString
 	Value HCLString
+	// Inputs are the parameters, owner attributes, data sources and
+	// variables the tag transitively depends on.
+	Inputs TagInputs
 }
 
 func (t Tag) Valid() bool {
@@ -91,6 +114,73 @@ func (t Tag) AsStrings() (string, string) {
 	return t.KeyString(), t.Value.AsString()
 }
 
+func (t Tag) Provenance() TagProvenance {
+	k, v := t.AsStrings()
+	inputs := t.Inputs
+	if inputs == nil {
+		inputs = TagInputs{}
+	}
+	return TagProvenance{
+		Key:    k,
+		Value:  v,
+		Known:  t.Valid() && t.IsKnown(),
+		Inputs: inputs,
+	}
+}
+
 func (t Tag) References() []string {
 	return append(hclext.ReferenceNames(t.Key.ValueExpr), hclext.ReferenceNames(t.Value.ValueExpr)...)
 }
+
+// TagProvenance is a JSON friendly form of a Tag and its inputs.
+type TagProvenance struct {
+	Key    string    `json:"key"`
+	Value  string    `json:"value"`
+	Known  bool      `json:"known"`
+	Inputs TagInputs `json:"inputs"`
+}
+
+type TagInputKind string
+
+const (
+	TagInputKindParameter      TagInputKind = "parameter"
+	TagInputKindWorkspaceOwner TagInputKind = "workspace_owner"
+	TagInputKindDataSource     TagInputKind = "data_source"
+	TagInputKindVariable       TagInputKind = "variable"
+)
+
+// TagInput is a single template input that a tag depends on.
+type TagInput struct {
+	Kind TagInputKind `json:"kind"`
+	// Name depends on the kind. It is the parameter name, the owner
+	// attribute, the data source address, or the variable name.
+	Name string `json:"name"`
+	// Reference is the full address of the block that provides the input.
+	Reference string `json:"reference"`
+}
+
+func (i TagInput) String() string {
+	return fmt.Sprintf("%s: %s", i.Kind, i.Name)
+}
+
+type TagInputs []TagInput
+
+// OfKind returns the inputs of the given kind.
+func (in TagInputs) OfKind(kind TagInputKind) TagInputs {
+	filtered := make(TagInputs, 0)
+	for _, i := range in {
+		if i.Kind == kind {
+			filtered = append(filtered, i)
+		}
+	}
+	return filtered
+}
+
+// Names returns the names of all inputs.
+func (in TagInputs) Names() []string {
+	names := make([]string, 0, len(in))
+	for _, i := range in {
+		names = append(names, i.Name)
+	}
+	return names
+}
@@ -0,0 +1,20 @@
+package types
+
+import (
+	"github.com/google/uuid"
+)
+
+// Based on https://github.com/coder/terraform-provider-coder/blob/main/provider/workspace.go
+type Workspace struct {
+	ID              uuid.UUID `json:"id"`
+	Name            string    `json:"name"`
+	AccessURL       string    `json:"access_url"`
+	AccessPort      int       `json:"access_port"`
+	StartCount      int       `json:"start_count"`
+	Transition      string    `json:"transition"`
+	IsPrebuild      bool      `json:"is_prebuild"`
+	PrebuildCount   int       `json:"prebuild_count"`
+	TemplateID      uuid.UUID `json:"template_id"`
+	TemplateName    string    `json:"template_name"`
+	TemplateVersion string    `json:"template_version"`
+}
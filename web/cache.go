@@ -0,0 +1,301 @@
+package web
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"path"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/coder/preview"
+	"github.com/coder/preview/internal/memfs"
+)
+
+// DefaultTemplateCacheSize is the memory budget of a TemplateCache when none
+// is given.
+//
+// @typescript-ignore DefaultTemplateCacheSize
+const DefaultTemplateCacheSize = 256 << 20 // 256 MiB
+
+// TemplateCache shares in-memory copies of template directories between
+// sessions. Entries are keyed by the content of the directory, so sessions
+// for identical files share a single copy, including any plan JSON stored
+// alongside the template. A named directory is only read again once the
+// paths, sizes or modification times of its files change.
+//
+// The parsed template files and plan JSON are shared as well, through the
+// ParseCache of the cache.
+//
+// Entries are reference counted. Once the cache exceeds its memory budget,
+// unreferenced entries are evicted, least recently used first. Entries in
+// use are never evicted, so the budget can be exceeded while they are held.
+//
+// @typescript-ignore TemplateCache
+type TemplateCache struct {
+	maxBytes int64
+	parse    *preview.ParseCache
+
+	mu      sync.Mutex
+	size    int64
+	entries map[string]*templateEntry
+	// named are the entries of named directories, keyed by the name and a
+	// hash of the file metadata.
+	named map[string]*templateEntry
+}
+
+func NewTemplateCache(maxBytes int64) *TemplateCache {
+	if maxBytes <= 0 {
+		maxBytes = DefaultTemplateCacheSize
+	}
+	return &TemplateCache{
+		maxBytes: maxBytes,
+		parse:    preview.NewParseCache(0),
+		entries:  make(map[string]*templateEntry),
+		named:    make(map[string]*templateEntry),
+	}
+}
+
+// ParseCache returns the cache of parsed template files and plan JSON, to be
+// used by the previews of the cached templates.
+func (c *TemplateCache) ParseCache() *preview.ParseCache {
+	return c.parse
+}
+
+// @typescript-ignore templateEntry
+type templateEntry struct {
+	key   string
+	files memfs.FS
+	size  int64
+	// statKeys are the keys of the entry in TemplateCache.named.
+	statKeys []string
+
+	// Guarded by TemplateCache.mu
+	refs     int
+	lastUsed time.Time
+}
+
+// CachedTemplate is a reference to a cached template directory. It must be
+// released when the caller is done with it.
+//
+// @typescript-ignore CachedTemplate
+type CachedTemplate struct {
+	cache *TemplateCache
+	entry *templateEntry
+
+	// Guarded by cache.mu
+	released bool
+}
+
+// Acquire returns the cached copy of the contents of the directory. If an
+// identical directory is already cached, the existing copy is shared.
+//
+// The name identifies the directory, such as its path. A named directory is
+// only read if the metadata of its files changed since it was last read. An
+// empty name always reads the directory.
+func (c *TemplateCache) Acquire(name string, dir fs.FS) (*CachedTemplate, error) {
+	var statKey string
+	if name != "" {
+		var err error
+		statKey, err = metadataKey(name, dir)
+		if err != nil {
+			return nil, err
+		}
+
+		c.mu.Lock()
+		entry, ok := c.named[statKey]
+		if ok {
+			tmpl := c.acquire(entry)
+			c.mu.Unlock()
+			return tmpl, nil
+		}
+		c.mu.Unlock()
+	}
+
+	files, size, key, err := snapshot(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok {
+		entry = &templateEntry{
+			key:   key,
+			files: files,
+			size:  size,
+		}
+		c.entries[key] = entry
+		c.size += size
+	}
+	if statKey != "" && !slices.Contains(entry.statKeys, statKey) {
+		entry.statKeys = append(entry.statKeys, statKey)
+		c.named[statKey] = entry
+	}
+	tmpl := c.acquire(entry)
+	c.evict()
+	return tmpl, nil
+}
+
+// acquire returns a new reference to the entry. The caller must hold c.mu.
+func (c *TemplateCache) acquire(entry *templateEntry) *CachedTemplate {
+	entry.refs++
+	entry.lastUsed = time.Now()
+
+	// Each caller gets its own handle, so that a double release cannot drop
+	// a reference held by someone else.
+	return &CachedTemplate{
+		cache: c,
+		entry: entry,
+	}
+}
+
+// Size returns the number of bytes held by the cache.
+func (c *TemplateCache) Size() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.size
+}
+
+// evict removes unreferenced entries until the cache is within its budget.
+// The caller must hold c.mu.
+func (c *TemplateCache) evict() {
+	for c.size > c.maxBytes {
+		var oldest *templateEntry
+		for _, entry := range c.entries {
+			if entry.refs > 0 {
+				continue
+			}
+			if oldest == nil || entry.lastUsed.Before(oldest.lastUsed) {
+				oldest = entry
+			}
+		}
+		if oldest == nil {
+			return
+		}
+		delete(c.entries, oldest.key)
+		for _, key := range oldest.statKeys {
+			delete(c.named, key)
+		}
+		c.size -= oldest.size
+	}
+}
+
+// FS returns the cached directory. It must not be used after Release.
+func (t *CachedTemplate) FS() fs.FS {
+	return t.entry.files
+}
+
+// Acquire returns another reference to the cached directory. It must not be
+// called after Release.
+func (t *CachedTemplate) Acquire() *CachedTemplate {
+	c := t.cache
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.acquire(t.entry)
+}
+
+// Release drops the reference to the cached directory. Calling it more than
+// once is a no-op.
+func (t *CachedTemplate) Release() {
+	c := t.cache
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if t.released {
+		return
+	}
+	t.released = true
+
+	t.entry.refs--
+	t.entry.lastUsed = time.Now()
+	c.evict()
+}
+
+// metadataKey returns a hash of the name of the directory, and of the
+// paths, sizes, modes and modification times of its files. Unlike snapshot,
+// it does not read the files.
+func metadataKey(name string, dir fs.FS) (string, error) {
+	hash := sha256.New()
+	_, _ = fmt.Fprintf(hash, "%q\n", name)
+
+	// fs.WalkDir visits entries in lexical order, so the hash is stable.
+	err := fs.WalkDir(dir, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if name == path.Join(".terraform", "providers") {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return fmt.Errorf("stat %q: %w", name, err)
+		}
+		_, _ = fmt.Fprintf(hash, "%q %d %s %d\n", name, info.Size(), info.Mode(), info.ModTime().UnixNano())
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("read template directory: %w", err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// snapshot reads every file in the directory into memory, and returns the
+// files, their total size, and a hash of their paths and contents.
+func snapshot(dir fs.FS) (memfs.FS, int64, string, error) {
+	files := make(memfs.FS)
+	hash := sha256.New()
+	var size int64
+
+	// fs.WalkDir visits entries in lexical order, so the hash is stable.
+	err := fs.WalkDir(dir, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			// Provider binaries are never read by a preview, and are large.
+			if name == path.Join(".terraform", "providers") {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		data, err := fs.ReadFile(dir, name)
+		if err != nil {
+			return fmt.Errorf("read %q: %w", name, err)
+		}
+		info, err := d.Info()
+		if err != nil {
+			return fmt.Errorf("stat %q: %w", name, err)
+		}
+
+		files[name] = &memfs.File{
+			Data:    data,
+			Mode:    info.Mode(),
+			ModTime: info.ModTime(),
+		}
+		size += int64(len(data))
+		_, _ = fmt.Fprintf(hash, "%q %d\n", name, len(data))
+		_, _ = hash.Write(data)
+		return nil
+	})
+	if err != nil {
+		return nil, 0, "", fmt.Errorf("read template directory: %w", err)
+	}
+
+	return files, size, hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,142 @@
+package web_test
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/coder/preview/web"
+)
+
+// readCounter counts the files opened for reading.
+type readCounter struct {
+	fs.FS
+	reads atomic.Int64
+}
+
+func (c *readCounter) Open(name string) (fs.File, error) {
+	if info, err := fs.Stat(c.FS, name); err == nil && !info.IsDir() {
+		c.reads.Add(1)
+	}
+	return c.FS.Open(name)
+}
+
+func TestTemplateCache(t *testing.T) {
+	t.Parallel()
+
+	modTime := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	files := fstest.MapFS{
+		"main.tf":   &fstest.MapFile{Data: []byte(`locals { a = 1 }`), ModTime: modTime},
+		"plan.json": &fstest.MapFile{Data: []byte(`{}`), ModTime: modTime},
+	}
+	dir := &readCounter{FS: files}
+	cache := web.NewTemplateCache(0)
+	require.NotNil(t, cache.ParseCache())
+
+	// A miss reads every file.
+	first, err := cache.Acquire("a", dir)
+	require.NoError(t, err)
+	defer first.Release()
+	require.EqualValues(t, 2, dir.reads.Load())
+	size := cache.Size()
+	require.EqualValues(t, len(`locals { a = 1 }`)+len(`{}`), size)
+
+	// A hit reads no file.
+	dir.reads.Store(0)
+	second, err := cache.Acquire("a", dir)
+	require.NoError(t, err)
+	defer second.Release()
+	require.Zero(t, dir.reads.Load())
+	assertContent(t, second.FS(), "main.tf", `locals { a = 1 }`)
+
+	// Another name with the same contents reads the files, and shares the
+	// copy.
+	dir.reads.Store(0)
+	other, err := cache.Acquire("b", dir)
+	require.NoError(t, err)
+	defer other.Release()
+	require.EqualValues(t, 2, dir.reads.Load())
+	require.Equal(t, size, cache.Size())
+
+	// Unnamed directories are always read.
+	dir.reads.Store(0)
+	unnamed, err := cache.Acquire("", dir)
+	require.NoError(t, err)
+	defer unnamed.Release()
+	require.EqualValues(t, 2, dir.reads.Load())
+
+	// A changed file invalidates the entry of the name.
+	files["main.tf"] = &fstest.MapFile{Data: []byte(`locals { a = 2 }`), ModTime: modTime.Add(time.Second)}
+	dir.reads.Store(0)
+	changed, err := cache.Acquire("a", dir)
+	require.NoError(t, err)
+	defer changed.Release()
+	require.EqualValues(t, 2, dir.reads.Load())
+	assertContent(t, changed.FS(), "main.tf", `locals { a = 2 }`)
+	// The copy held by earlier references is unchanged.
+	assertContent(t, first.FS(), "main.tf", `locals { a = 1 }`)
+}
+
+func TestTemplateCacheDisk(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	path := filepath.Join(root, "main.tf")
+	require.NoError(t, os.WriteFile(path, []byte(`locals { a = 1 }`), 0o644))
+	cache := web.NewTemplateCache(0)
+
+	first, err := cache.Acquire(root, os.DirFS(root))
+	require.NoError(t, err)
+	first.Release()
+
+	// The modification time is moved explicitly, as writes in quick
+	// succession can share one.
+	require.NoError(t, os.WriteFile(path, []byte(`locals { a = 22 }`), 0o644))
+	later := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(path, later, later))
+
+	second, err := cache.Acquire(root, os.DirFS(root))
+	require.NoError(t, err)
+	defer second.Release()
+	assertContent(t, second.FS(), "main.tf", `locals { a = 22 }`)
+}
+
+func TestTemplateCacheEviction(t *testing.T) {
+	t.Parallel()
+
+	cache := web.NewTemplateCache(10)
+	a, err := cache.Acquire("a", fstest.MapFS{"main.tf": &fstest.MapFile{Data: []byte("aaaaaaaa")}})
+	require.NoError(t, err)
+	b, err := cache.Acquire("b", fstest.MapFS{"main.tf": &fstest.MapFile{Data: []byte("bbbbbbbb")}})
+	require.NoError(t, err)
+	// Both are in use, so the budget is exceeded.
+	require.EqualValues(t, 16, cache.Size())
+
+	a.Release()
+	// Releasing twice does not drop the reference of b.
+	a.Release()
+	require.EqualValues(t, 8, cache.Size())
+	assertContent(t, b.FS(), "main.tf", "bbbbbbbb")
+
+	// The evicted entry is read again.
+	dir := &readCounter{FS: fstest.MapFS{"main.tf": &fstest.MapFile{Data: []byte("aaaaaaaa")}}}
+	again, err := cache.Acquire("a", dir)
+	require.NoError(t, err)
+	defer again.Release()
+	require.EqualValues(t, 1, dir.reads.Load())
+	b.Release()
+}
+
+func assertContent(t *testing.T, dir fs.FS, name, expected string) {
+	t.Helper()
+	data, err := fs.ReadFile(dir, name)
+	require.NoError(t, err)
+	assert.Equal(t, expected, string(data))
+}
@@ -0,0 +1,449 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+)
+
+var (
+	// ErrSuperseded is returned for a request whose response will never be
+	// sent, because the server has answered a newer request instead.
+	ErrSuperseded = errors.New("request superseded by a newer request")
+	// ErrClientClosed is returned once the client is closed.
+	ErrClientClosed = errors.New("client closed")
+	// ErrDeltaDesync is returned for a delta response that does not apply to
+	// the last response received. The next request asks for a snapshot.
+	ErrDeltaDesync = errors.New("delta response does not apply to the last response")
+)
+
+const (
+	// @typescript-ignore defaultReconnectAttempts
+	defaultReconnectAttempts = 5
+	// @typescript-ignore defaultReconnectDelay
+	defaultReconnectDelay = 250 * time.Millisecond
+	// @typescript-ignore maxReconnectDelay
+	maxReconnectDelay = 5 * time.Second
+)
+
+// ClientOptions configure a Client. The zero value is ready to use.
+//
+// @typescript-ignore ClientOptions
+type ClientOptions struct {
+	// HTTPClient is used to dial, for example the client of an
+	// httptest.Server.
+	HTTPClient *http.Client
+	// HTTPHeader is sent with every dial, for example an Authorization
+	// header.
+	HTTPHeader http.Header
+
+	// DisableReconnect closes the client when the connection is lost,
+	// instead of dialing again.
+	DisableReconnect bool
+	// ReconnectAttempts is the number of consecutive failed dials before
+	// the client gives up. Defaults to 5.
+	ReconnectAttempts int
+	// ReconnectDelay is the delay before the first dial after the
+	// connection is lost. It doubles after every failed dial. Defaults to
+	// 250ms.
+	ReconnectDelay time.Duration
+}
+
+// Client is a client for a websocket preview session, as served on
+// '/ws/{dir}'. It assigns request IDs, and matches responses to the
+// requests. It is safe for concurrent use.
+//
+// The server only answers the newest request, so the futures of older
+// requests fail with ErrSuperseded once a newer response arrives.
+//
+// If the session sends delta responses, requested with the 'delta' query
+// parameter, the client applies them, and returns full responses.
+//
+// If the connection is lost, the client dials again. The new session starts
+// with the session updates and file patches of the old one, and the newest
+// unanswered request is sent again.
+//
+// @typescript-ignore Client
+type Client struct {
+	url  string
+	opts ClientOptions
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	// writeMu is held from assigning the ID of a request until it is
+	// written, so that requests are sent in ID order. It is taken before
+	// mu.
+	writeMu sync.Mutex
+
+	mu      sync.Mutex
+	conn    *websocket.Conn
+	nextID  int
+	pending map[int]*Future
+	state   clientState
+	err     error
+	reloads chan *Response
+	// seq and base are the sequence number and result of the last
+	// response, that delta responses apply to.
+	seq  int
+	base *Result
+}
+
+// clientState is the session state the client restores after a reconnect.
+//
+// @typescript-ignore clientState
+type clientState struct {
+	session *SessionInputsUpdate
+	files   map[string]FilePatch
+	// restore is set after a reconnect, until the state has been sent.
+	restore bool
+	// snapshot is set after a delta response could not be applied, until a
+	// request has been sent.
+	snapshot bool
+}
+
+// Future is the response to a request that was sent.
+//
+// @typescript-ignore Future
+type Future struct {
+	id int
+	// req is sent again if the client reconnects before the response.
+	req  Request
+	done chan struct{}
+	resp *Response
+	err  error
+}
+
+// DialClient connects to the websocket session at the URL. Both 'ws' and
+// 'http' URLs are accepted.
+func DialClient(ctx context.Context, url string, opts ClientOptions) (*Client, error) {
+	if opts.ReconnectAttempts <= 0 {
+		opts.ReconnectAttempts = defaultReconnectAttempts
+	}
+	if opts.ReconnectDelay <= 0 {
+		opts.ReconnectDelay = defaultReconnectDelay
+	}
+
+	c := &Client{
+		url:     url,
+		opts:    opts,
+		done:    make(chan struct{}),
+		pending: make(map[int]*Future),
+		reloads: make(chan *Response, 1),
+		nextID:  1,
+	}
+
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c.conn = conn
+	// The client outlives the dial context.
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+	go c.run(conn)
+	return c, nil
+}
+
+func (c *Client) dial(ctx context.Context) (*websocket.Conn, error) {
+	conn, _, err := websocket.Dial(ctx, c.url, &websocket.DialOptions{
+		HTTPClient: c.opts.HTTPClient,
+		HTTPHeader: c.opts.HTTPHeader,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("dial %q: %w", c.url, err)
+	}
+	// Responses include every parameter, so they can be larger than the
+	// default limit.
+	conn.SetReadLimit(-1)
+	return conn, nil
+}
+
+// Send sends the request with the next ID, and returns a future for the
+// response. The ID of the request is ignored.
+func (c *Client) Send(ctx context.Context, req Request) (*Future, error) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return nil, c.err
+	}
+	req.ID = c.nextID
+	c.nextID++
+	f := &Future{id: req.ID, req: req, done: make(chan struct{})}
+	c.pending[req.ID] = f
+	c.state.record(req)
+	req = c.state.apply(req)
+	conn := c.conn
+	c.mu.Unlock()
+
+	// A failed write is not returned, as the newest request is sent again
+	// once the client reconnects.
+	_ = wsjson.Write(ctx, conn, req)
+	return f, nil
+}
+
+// Preview sends the request and waits for its response.
+func (c *Client) Preview(ctx context.Context, req Request) (*Response, error) {
+	f, err := c.Send(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return f.Wait(ctx)
+}
+
+// Reloads receives the responses the server sends when the template files
+// change. If they are not received, only the newest is kept.
+func (c *Client) Reloads() <-chan *Response {
+	return c.reloads
+}
+
+// Close closes the connection. Futures that are not resolved fail with
+// ErrClientClosed.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	if c.err == nil {
+		c.err = ErrClientClosed
+	}
+	conn := c.conn
+	c.mu.Unlock()
+
+	c.cancel()
+	err := conn.Close(websocket.StatusNormalClosure, "client closed")
+	<-c.done
+	return err
+}
+
+// run reads the responses, and reconnects when the connection is lost.
+func (c *Client) run(conn *websocket.Conn) {
+	defer close(c.done)
+
+	for {
+		err := c.readLoop(conn)
+		if c.ctx.Err() != nil {
+			c.fail(ErrClientClosed)
+			return
+		}
+		if c.opts.DisableReconnect {
+			c.fail(fmt.Errorf("connection lost: %w", err))
+			return
+		}
+
+		conn, err = c.reconnect()
+		if err != nil {
+			c.fail(err)
+			return
+		}
+	}
+}
+
+func (c *Client) readLoop(conn *websocket.Conn) error {
+	for {
+		var resp Response
+		if err := wsjson.Read(c.ctx, conn, &resp); err != nil {
+			return err
+		}
+		c.resolve(&resp)
+	}
+}
+
+// resolve completes the future of the response, and fails the futures of
+// older requests.
+func (c *Client) resolve(resp *Response) {
+	c.mu.Lock()
+	err := c.applyDelta(resp)
+	for id, f := range c.pending {
+		switch {
+		case id == resp.ID && err != nil:
+			f.complete(nil, err)
+			delete(c.pending, id)
+		case id == resp.ID:
+			f.complete(resp, nil)
+			delete(c.pending, id)
+		case id < resp.ID:
+			f.complete(nil, ErrSuperseded)
+			delete(c.pending, id)
+		}
+	}
+	c.mu.Unlock()
+
+	if resp.Reloaded && err == nil {
+		select {
+		case <-c.reloads:
+		default:
+		}
+		c.reloads <- resp
+	}
+}
+
+// applyDelta replaces a delta in the response with the full result. The
+// caller must hold c.mu.
+func (c *Client) applyDelta(resp *Response) error {
+	if resp.Seq == 0 {
+		return nil
+	}
+	if resp.Delta == nil {
+		c.seq, c.base = resp.Seq, &resp.Result
+		return nil
+	}
+
+	if c.base == nil || resp.Delta.BaseSeq != c.seq {
+		c.state.snapshot = true
+		return ErrDeltaDesync
+	}
+	result, err := ApplyDelta(*c.base, *resp.Delta)
+	if err != nil {
+		c.state.snapshot = true
+		return fmt.Errorf("%w: %w", ErrDeltaDesync, err)
+	}
+	resp.Result = result
+	resp.Delta = nil
+	c.seq, c.base = resp.Seq, &result
+	return nil
+}
+
+// reconnect dials again, and sends the newest unanswered request with the
+// session state.
+func (c *Client) reconnect() (*websocket.Conn, error) {
+	delay := c.opts.ReconnectDelay
+	var err error
+	for range c.opts.ReconnectAttempts {
+		select {
+		case <-c.ctx.Done():
+			return nil, ErrClientClosed
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, maxReconnectDelay)
+
+		var conn *websocket.Conn
+		conn, err = c.dial(c.ctx)
+		if err != nil {
+			continue
+		}
+
+		// The state is restored by the first request on the connection, so
+		// no other request can be written before it.
+		c.writeMu.Lock()
+		c.mu.Lock()
+		c.conn = conn
+		c.state.restore = true
+		var resend *Request
+		if len(c.pending) > 0 {
+			newest := slices.Max(slices.Collect(maps.Keys(c.pending)))
+			req := c.state.apply(c.pending[newest].req)
+			resend = &req
+		}
+		c.mu.Unlock()
+
+		if resend != nil {
+			_ = wsjson.Write(c.ctx, conn, *resend)
+		}
+		c.writeMu.Unlock()
+		return conn, nil
+	}
+	return nil, fmt.Errorf("reconnect after %d attempts: %w", c.opts.ReconnectAttempts, err)
+}
+
+// fail fails every unresolved future, and every later Send.
+func (c *Client) fail(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err == nil {
+		c.err = err
+	}
+	for id, f := range c.pending {
+		f.complete(nil, c.err)
+		delete(c.pending, id)
+	}
+}
+
+// record adds the session update and file patches of the request to the
+// state.
+func (s *clientState) record(req Request) {
+	if req.Session != nil {
+		if s.session == nil {
+			s.session = &SessionInputsUpdate{}
+		}
+		u := req.Session
+		if u.PlanPath != nil {
+			s.session.PlanPath = u.PlanPath
+		}
+		// The user name takes precedence over the user, so the older of the
+		// two must be dropped.
+		if u.User != nil {
+			s.session.User = u.User
+			s.session.UserName = nil
+		}
+		if u.UserName != nil {
+			s.session.UserName = u.UserName
+			s.session.User = nil
+		}
+		if u.PreviousValues != nil {
+			s.session.PreviousValues = u.PreviousValues
+		}
+	}
+
+	for _, patch := range req.Files {
+		if s.files == nil {
+			s.files = make(map[string]FilePatch)
+		}
+		// A later patch of a path replaces the earlier one.
+		s.files[patch.Path] = patch
+	}
+}
+
+// apply returns the request with the whole state, if it has to be restored,
+// and asks for a snapshot if one is due. The request inputs are kept.
+func (s *clientState) apply(req Request) Request {
+	if s.snapshot {
+		s.snapshot = false
+		req.Snapshot = true
+	}
+	if !s.restore {
+		return req
+	}
+	s.restore = false
+
+	req.Session = s.session
+	req.Files = nil
+	for _, path := range slices.Sorted(maps.Keys(s.files)) {
+		req.Files = append(req.Files, s.files[path])
+	}
+	return req
+}
+
+// ID is the ID the request was sent with.
+func (f *Future) ID() int {
+	return f.id
+}
+
+// Done is closed once the response arrived, or the request failed.
+func (f *Future) Done() <-chan struct{} {
+	return f.done
+}
+
+// Wait returns the response to the request.
+func (f *Future) Wait(ctx context.Context) (*Response, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-f.done:
+		return f.resp, f.err
+	}
+}
+
+func (f *Future) complete(resp *Response, err error) {
+	f.resp = resp
+	f.err = err
+	close(f.done)
+}
@@ -0,0 +1,197 @@
+package web_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"cdr.dev/slog/sloggers/slogtest"
+	"github.com/coder/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/coder/preview/types"
+	"github.com/coder/preview/web"
+)
+
+const clientTemplate = `
+terraform {
+  required_providers {
+    coder = {
+      source = "coder/coder"
+    }
+  }
+}
+
+data "coder_parameter" "region" {
+  name    = "region"
+  type    = "string"
+  default = "eu"
+
+  option {
+    name  = "Europe"
+    value = "eu"
+  }
+  option {
+    name  = "United States"
+    value = "us"
+  }
+}
+
+data "coder_parameter" "size" {
+  name    = "size"
+  type    = "number"
+  default = data.coder_parameter.region.value == "us" ? 20 : 10
+}
+`
+
+func TestClient(t *testing.T) {
+	t.Parallel()
+
+	for _, delta := range []bool{false, true} {
+		name := "Full"
+		if delta {
+			name = "Delta"
+		}
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			logger := slogtest.Make(t, nil)
+			dir := fstest.MapFS{"main.tf": &fstest.MapFile{Data: []byte(clientTemplate)}}
+			srv := httptest.NewServer(web.SessionHandler(logger, dir, web.Options{}))
+			t.Cleanup(srv.Close)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+
+			url := srv.URL
+			if delta {
+				url += "?delta=true"
+			}
+			client, err := web.DialClient(ctx, url, web.ClientOptions{
+				HTTPClient:       srv.Client(),
+				DisableReconnect: true,
+			})
+			require.NoError(t, err)
+			defer client.Close()
+
+			// The defaults apply without inputs.
+			resp, err := client.Preview(ctx, web.Request{})
+			require.NoError(t, err)
+			require.Equal(t, 1, resp.ID)
+			assert.Empty(t, resp.Diagnostics)
+			assertValues(t, resp, map[string]string{"region": "eu", "size": "10"})
+
+			// A parameter update changes the parameters that depend on it.
+			resp, err = client.Preview(ctx, web.Request{Inputs: map[string]string{"region": "us"}})
+			require.NoError(t, err)
+			require.Equal(t, 2, resp.ID)
+			require.Nil(t, resp.Delta)
+			assertValues(t, resp, map[string]string{"region": "us", "size": "20"})
+
+			// A file patch applies to the request and to later ones.
+			resp, err = client.Preview(ctx, web.Request{
+				Inputs: map[string]string{"region": "us"},
+				Files: []web.FilePatch{{
+					Path: "extra.tf",
+					Content: `data "coder_parameter" "extra" {
+  name    = "extra"
+  type    = "string"
+  default = "x"
+}`,
+				}},
+			})
+			require.NoError(t, err)
+			assertValues(t, resp, map[string]string{"region": "us", "size": "20", "extra": "x"})
+
+			resp, err = client.Preview(ctx, web.Request{Inputs: map[string]string{"region": "eu", "size": "5"}})
+			require.NoError(t, err)
+			require.Equal(t, 4, resp.ID)
+			assertValues(t, resp, map[string]string{"region": "eu", "size": "5", "extra": "x"})
+		})
+	}
+}
+
+func TestClientReconnect(t *testing.T) {
+	t.Parallel()
+
+	logger := slogtest.Make(t, nil)
+	dir := fstest.MapFS{"main.tf": &fstest.MapFile{Data: []byte(clientTemplate)}}
+	session := web.SessionHandler(logger, dir, web.Options{})
+	var dialed atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if dialed.Add(1) > 1 {
+			session.ServeHTTP(rw, r)
+			return
+		}
+		// The first connection is lost after the first request, before it
+		// is answered.
+		conn, err := websocket.Accept(rw, r, nil)
+		if err != nil {
+			return
+		}
+		_, _, _ = conn.Read(r.Context())
+		_ = conn.CloseNow()
+	}))
+	t.Cleanup(srv.Close)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	client, err := web.DialClient(ctx, srv.URL, web.ClientOptions{
+		HTTPClient:     srv.Client(),
+		ReconnectDelay: 10 * time.Millisecond,
+	})
+	require.NoError(t, err)
+	defer client.Close()
+
+	previous := map[string]string{"size": "7"}
+	f, err := client.Send(ctx, web.Request{
+		Session: &web.SessionInputsUpdate{PreviousValues: previous},
+		Files: []web.FilePatch{{
+			Path: "extra.tf",
+			Content: `data "coder_parameter" "extra" {
+  name    = "extra"
+  type    = "string"
+  default = "x"
+}`,
+		}},
+	})
+	require.NoError(t, err)
+
+	// The pending request is sent again on the new connection, with the
+	// session state.
+	resp, err := f.Wait(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 1, resp.ID)
+	assert.Equal(t, int32(2), dialed.Load())
+	assert.Equal(t, previous, resp.Session.PreviousValues)
+	assertValues(t, resp, map[string]string{"region": "eu", "size": "7", "extra": "x"})
+
+	// The new session keeps the state for later requests.
+	resp, err = client.Preview(ctx, web.Request{Inputs: map[string]string{"region": "us"}})
+	require.NoError(t, err)
+	require.Equal(t, 2, resp.ID)
+	assertValues(t, resp, map[string]string{"region": "us", "size": "7", "extra": "x"})
+}
+
+func assertValues(t *testing.T, resp *web.Response, expected map[string]string) {
+	t.Helper()
+	values := make(map[string]string, len(resp.Parameters))
+	for _, p := range resp.Parameters {
+		require.Empty(t, p.Diagnostics, p.Name)
+		values[p.Name] = valueString(p.Value)
+	}
+	assert.Equal(t, expected, values)
+}
+
+func valueString(v types.HCLString) string {
+	if !v.Valid() || !v.IsKnown() {
+		return "??"
+	}
+	return v.AsString()
+}
@@ -0,0 +1,226 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+
+	"github.com/coder/preview/types"
+)
+
+// ResponseDelta is the difference between a response and the previous
+// response sent on the session. It is only sent to sessions that opted in
+// to delta responses.
+type ResponseDelta struct {
+	// BaseSeq is the sequence number of the response the delta applies to.
+	// If the client has not seen it, it must request a snapshot.
+	BaseSeq int `json:"base_seq"`
+	// Added are the parameters that are new.
+	Added []types.Parameter `json:"added"`
+	// Removed are the names of the parameters that no longer exist.
+	Removed []string `json:"removed"`
+	// Changed are the parameters with at least one changed field.
+	Changed []ParameterChange `json:"changed"`
+	// Order is the name of every parameter, in order. It is only set if
+	// the order changed.
+	Order []string `json:"order,omitempty"`
+	// Diagnostics replace the previous diagnostics if DiagnosticsChanged is
+	// set.
+	DiagnosticsChanged bool              `json:"diagnostics_changed"`
+	Diagnostics        types.Diagnostics `json:"diagnostics"`
+	// WorkspaceTags replace the previous workspace tags, if set.
+	WorkspaceTags *WorkspaceTags `json:"workspace_tags,omitempty"`
+}
+
+// ParameterChange is the changed fields of a single parameter.
+type ParameterChange struct {
+	Name string `json:"name"`
+	// Fields are the new values of the changed fields, by their JSON name.
+	// Fields that no longer exist are null.
+	Fields map[string]any `json:"fields"`
+}
+
+// diffResults returns the delta from prev to next. It returns false if a
+// delta cannot describe the change, because parameter names are not unique.
+func diffResults(prev, next Result) (*ResponseDelta, bool, error) {
+	prevParams, ok, err := parametersByName(prev.Parameters)
+	if err != nil || !ok {
+		return nil, false, err
+	}
+	nextParams, ok, err := parametersByName(next.Parameters)
+	if err != nil || !ok {
+		return nil, false, err
+	}
+
+	delta := &ResponseDelta{
+		Added:   []types.Parameter{},
+		Removed: []string{},
+		Changed: []ParameterChange{},
+	}
+	for _, p := range next.Parameters {
+		before, ok := prevParams[p.Name]
+		if !ok {
+			delta.Added = append(delta.Added, p)
+			continue
+		}
+
+		after := nextParams[p.Name]
+		change := ParameterChange{Name: p.Name, Fields: make(map[string]any)}
+		for _, field := range slices.Sorted(maps.Keys(after)) {
+			if !reflect.DeepEqual(before[field], after[field]) {
+				change.Fields[field] = after[field]
+			}
+		}
+		for field := range before {
+			if _, ok := after[field]; !ok {
+				change.Fields[field] = nil
+			}
+		}
+		if len(change.Fields) > 0 {
+			delta.Changed = append(delta.Changed, change)
+		}
+	}
+	for _, p := range prev.Parameters {
+		if _, ok := nextParams[p.Name]; !ok {
+			delta.Removed = append(delta.Removed, p.Name)
+		}
+	}
+
+	prevOrder, nextOrder := parameterNames(prev.Parameters), parameterNames(next.Parameters)
+	if !slices.Equal(prevOrder, nextOrder) {
+		delta.Order = nextOrder
+	}
+
+	changed, err := jsonChanged(prev.Diagnostics, next.Diagnostics)
+	if err != nil {
+		return nil, false, err
+	}
+	if changed {
+		delta.DiagnosticsChanged = true
+		delta.Diagnostics = next.Diagnostics
+	}
+
+	changed, err = jsonChanged(prev.WorkspaceTags, next.WorkspaceTags)
+	if err != nil {
+		return nil, false, err
+	}
+	if changed {
+		tags := next.WorkspaceTags
+		delta.WorkspaceTags = &tags
+	}
+
+	return delta, true, nil
+}
+
+// ApplyDelta returns the result the delta was computed for, given the
+// result it is based on.
+func ApplyDelta(base Result, delta ResponseDelta) (Result, error) {
+	params, ok, err := parametersByName(base.Parameters)
+	if err != nil {
+		return Result{}, err
+	}
+	if !ok {
+		return Result{}, fmt.Errorf("base has duplicate parameter names")
+	}
+
+	for _, name := range delta.Removed {
+		delete(params, name)
+	}
+	for _, change := range delta.Changed {
+		fields, ok := params[change.Name]
+		if !ok {
+			return Result{}, fmt.Errorf("changed parameter %q is not in the base", change.Name)
+		}
+		for field, value := range change.Fields {
+			if value == nil {
+				delete(fields, field)
+				continue
+			}
+			fields[field] = value
+		}
+	}
+
+	byName := make(map[string]types.Parameter, len(params)+len(delta.Added))
+	for name, fields := range params {
+		var p types.Parameter
+		if err := remarshal(fields, &p); err != nil {
+			return Result{}, fmt.Errorf("decode parameter %q: %w", name, err)
+		}
+		byName[name] = p
+	}
+	for _, p := range delta.Added {
+		byName[p.Name] = p
+	}
+
+	// The order is only left out if no parameter was added or removed.
+	order := delta.Order
+	if order == nil {
+		order = parameterNames(base.Parameters)
+	}
+
+	next := base
+	next.Parameters = make([]types.Parameter, 0, len(order))
+	for _, name := range order {
+		p, ok := byName[name]
+		if !ok {
+			return Result{}, fmt.Errorf("ordered parameter %q is unknown", name)
+		}
+		next.Parameters = append(next.Parameters, p)
+	}
+	if delta.DiagnosticsChanged {
+		next.Diagnostics = delta.Diagnostics
+	}
+	if delta.WorkspaceTags != nil {
+		next.WorkspaceTags = *delta.WorkspaceTags
+	}
+	return next, nil
+}
+
+// parametersByName returns the JSON fields of each parameter, by name. It
+// returns false if a name is not unique.
+func parametersByName(params []types.Parameter) (map[string]map[string]any, bool, error) {
+	byName := make(map[string]map[string]any, len(params))
+	for _, p := range params {
+		if _, ok := byName[p.Name]; ok {
+			return nil, false, nil
+		}
+		var fields map[string]any
+		if err := remarshal(p, &fields); err != nil {
+			return nil, false, fmt.Errorf("encode parameter %q: %w", p.Name, err)
+		}
+		byName[p.Name] = fields
+	}
+	return byName, true, nil
+}
+
+func parameterNames(params []types.Parameter) []string {
+	names := make([]string, 0, len(params))
+	for _, p := range params {
+		names = append(names, p.Name)
+	}
+	return names
+}
+
+// jsonChanged compares the values by their JSON form, which is all the
+// client sees of them.
+func jsonChanged(a, b any) (bool, error) {
+	aj, err := json.Marshal(a)
+	if err != nil {
+		return false, err
+	}
+	bj, err := json.Marshal(b)
+	if err != nil {
+		return false, err
+	}
+	return string(aj) != string(bj), nil
+}
+
+func remarshal(from, to any) error {
+	data, err := json.Marshal(from)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, to)
+}
@@ -0,0 +1,152 @@
+package web
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/coder/preview/types"
+)
+
+func TestApplyDelta(t *testing.T) {
+	t.Parallel()
+
+	param := func(name, value string, edit ...func(p *types.Parameter)) types.Parameter {
+		p := types.Parameter{
+			ParameterData: types.ParameterData{
+				Name:         name,
+				Type:         types.ParameterTypeString,
+				DefaultValue: types.StringLiteral(""),
+			},
+			Value:       types.StringLiteral(value),
+			Diagnostics: types.Diagnostics{},
+		}
+		for _, e := range edit {
+			e(&p)
+		}
+		return p
+	}
+	result := func(params ...types.Parameter) Result {
+		return Result{Parameters: params, Diagnostics: types.Diagnostics{}}
+	}
+
+	for _, tc := range []struct {
+		name   string
+		before Result
+		after  Result
+	}{
+		{
+			name:   "Unchanged",
+			before: result(param("a", "1"), param("b", "2")),
+			after:  result(param("a", "1"), param("b", "2")),
+		},
+		{
+			name:   "Added",
+			before: result(param("a", "1")),
+			after:  result(param("z", "0"), param("a", "1"), param("b", "2")),
+		},
+		{
+			name:   "Removed",
+			before: result(param("a", "1"), param("b", "2"), param("c", "3")),
+			after:  result(param("b", "2")),
+		},
+		{
+			name:   "Reordered",
+			before: result(param("a", "1"), param("b", "2"), param("c", "3")),
+			after:  result(param("c", "3"), param("a", "1"), param("b", "2")),
+		},
+		{
+			name:   "Changed",
+			before: result(param("a", "1"), param("b", "2")),
+			after: result(param("a", "10"), param("b", "2", func(p *types.Parameter) {
+				p.Mutable = true
+				p.Options = []*types.ParameterOption{{Name: "Two", Value: types.StringLiteral("2")}}
+			})),
+		},
+		{
+			name: "StylingKeyRemoved",
+			before: result(param("a", "1", func(p *types.Parameter) {
+				p.Styling = map[string]any{"placeholder": "x", "disabled": true}
+			})),
+			after: result(param("a", "1", func(p *types.Parameter) {
+				p.Styling = map[string]any{"disabled": true}
+			})),
+		},
+		{
+			name:   "StylingRemoved",
+			before: result(param("a", "1", func(p *types.Parameter) { p.Styling = map[string]any{"disabled": true} })),
+			after:  result(param("a", "1")),
+		},
+		{
+			name:   "Everything",
+			before: result(param("a", "1"), param("b", "2"), param("c", "3")),
+			after: Result{
+				Parameters: []types.Parameter{param("d", "4"), param("c", "30"), param("a", "1")},
+				Diagnostics: types.Diagnostics{{
+					Severity: 1,
+					Summary:  "Something",
+				}},
+				WorkspaceTags: WorkspaceTags{Tags: map[string]string{"region": "eu"}},
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			delta, ok, err := diffResults(tc.before, tc.after)
+			require.NoError(t, err)
+			require.True(t, ok)
+
+			// The delta is sent as JSON.
+			var sent ResponseDelta
+			require.NoError(t, remarshal(delta, &sent))
+
+			applied, err := ApplyDelta(tc.before, sent)
+			require.NoError(t, err)
+			assertJSONEqual(t, tc.after, applied)
+		})
+	}
+}
+
+func TestApplyDeltaRemovedField(t *testing.T) {
+	t.Parallel()
+
+	base := Result{Parameters: []types.Parameter{{
+		ParameterData: types.ParameterData{
+			Name:    "a",
+			Styling: map[string]any{"disabled": true},
+		},
+	}}}
+	applied, err := ApplyDelta(base, ResponseDelta{
+		Changed: []ParameterChange{{Name: "a", Fields: map[string]any{"styling": nil, "icon": "/icon.svg"}}},
+	})
+	require.NoError(t, err)
+	require.Len(t, applied.Parameters, 1)
+	assert.Nil(t, applied.Parameters[0].Styling)
+	assert.Equal(t, "/icon.svg", applied.Parameters[0].Icon)
+}
+
+func TestDiffResultsDuplicateNames(t *testing.T) {
+	t.Parallel()
+
+	dup := []types.Parameter{
+		{ParameterData: types.ParameterData{Name: "a"}},
+		{ParameterData: types.ParameterData{Name: "a"}},
+	}
+	_, ok, err := diffResults(Result{}, Result{Parameters: dup})
+	require.NoError(t, err)
+	require.False(t, ok)
+}
+
+// assertJSONEqual compares the results by their JSON form, which is all the
+// client sees of them.
+func assertJSONEqual(t *testing.T, expected, actual Result) {
+	t.Helper()
+	e, err := json.Marshal(expected)
+	require.NoError(t, err)
+	a, err := json.Marshal(actual)
+	require.NoError(t, err)
+	assert.JSONEq(t, string(e), string(a))
+}
@@ -0,0 +1,45 @@
+package web
+
+import (
+	"fmt"
+	"io/fs"
+	"net/http"
+
+	"cdr.dev/slog"
+	"github.com/coder/websocket"
+)
+
+// SessionHandler serves a websocket session for the template in dir on every
+// request. The 'plan' and 'user' query parameters set the session inputs, and
+// 'delta' enables delta responses, like on '/ws/{dir}'. It is a minimal
+// server for a Client, such as in tests with httptest.
+func SessionHandler(logger slog.Logger, dir fs.FS, opts Options) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		inputs := SessionInputs{
+			PlanPath: r.URL.Query().Get("plan"),
+			UserName: r.URL.Query().Get("user"),
+		}
+		if inputs.UserName != "" {
+			users, err := AvailableUsers(dir)
+			if err != nil {
+				http.Error(rw, err.Error(), http.StatusBadRequest)
+				return
+			}
+			var ok bool
+			inputs.User, ok = users[inputs.UserName]
+			if !ok {
+				http.Error(rw, fmt.Sprintf("unknown user %q", inputs.UserName), http.StatusBadRequest)
+				return
+			}
+		}
+
+		conn, err := websocket.Accept(rw, r, nil)
+		if err != nil {
+			return
+		}
+
+		sessionOpts := opts
+		sessionOpts.DeltaResponses = r.URL.Query().Get("delta") == "true"
+		NewSession(logger, dir, inputs, sessionOpts).Listen(r.Context(), conn)
+	})
+}
@@ -0,0 +1,233 @@
+package web
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/hcl/v2"
+
+	"github.com/coder/preview"
+	"github.com/coder/preview/types"
+)
+
+var (
+	// durationBuckets are the Prometheus default buckets, in seconds.
+	durationBuckets  = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+	parameterBuckets = []float64{0, 1, 2, 5, 10, 25, 50, 100}
+)
+
+// maxDiagnosticCodes bounds the number of distinct diagnostic codes that are
+// tracked. Any further codes are counted as "other".
+//
+// @typescript-ignore maxDiagnosticCodes
+const maxDiagnosticCodes = 500
+
+// PrometheusMetrics collects preview metrics and serves them in the
+// Prometheus text format.
+//
+// @typescript-ignore PrometheusMetrics
+type PrometheusMetrics struct {
+	mu          sync.Mutex
+	phases      map[preview.Phase]*histogram
+	previews    map[string]*histogram
+	parameters  *histogram
+	diagnostics map[diagnosticKey]uint64
+	codes       map[string]struct{}
+}
+
+var _ preview.Metrics = (*PrometheusMetrics)(nil)
+
+// @typescript-ignore diagnosticKey
+type diagnosticKey struct {
+	severity types.DiagnosticSeverityString
+	code     string
+}
+
+func NewPrometheusMetrics() *PrometheusMetrics {
+	return &PrometheusMetrics{
+		phases:      make(map[preview.Phase]*histogram),
+		previews:    make(map[string]*histogram),
+		parameters:  newHistogram(parameterBuckets),
+		diagnostics: make(map[diagnosticKey]uint64),
+		codes:       make(map[string]struct{}),
+	}
+}
+
+func (m *PrometheusMetrics) ObservePhase(phase preview.Phase, duration time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	h, ok := m.phases[phase]
+	if !ok {
+		h = newHistogram(durationBuckets)
+		m.phases[phase] = h
+	}
+	h.observe(duration.Seconds())
+}
+
+func (m *PrometheusMetrics) ObservePreview(duration time.Duration, diags hcl.Diagnostics, parameters int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	result := "success"
+	if diags.HasErrors() {
+		result = "error"
+	}
+	h, ok := m.previews[result]
+	if !ok {
+		h = newHistogram(durationBuckets)
+		m.previews[result] = h
+	}
+	h.observe(duration.Seconds())
+	m.parameters.observe(float64(parameters))
+
+	for _, diag := range diags {
+		severity := types.DiagnosticSeverityError
+		if diag.Severity == hcl.DiagWarning {
+			severity = types.DiagnosticSeverityWarning
+		}
+		m.diagnostics[diagnosticKey{severity: severity, code: m.code(diag)}]++
+	}
+}
+
+// code returns the label for the diagnostic. The caller must hold m.mu.
+func (m *PrometheusMetrics) code(diag *hcl.Diagnostic) string {
+	code := diagnosticCode(diag.Summary)
+	if _, ok := m.codes[code]; ok {
+		return code
+	}
+	if len(m.codes) >= maxDiagnosticCodes {
+		return "other"
+	}
+	m.codes[code] = struct{}{}
+	return code
+}
+
+var (
+	quotedPattern = regexp.MustCompile(`"(?:[^"\\]|\\.)*"`)
+	numberPattern = regexp.MustCompile(`\b\d+\b`)
+)
+
+// diagnosticCode identifies the kind of a diagnostic. Diagnostics do not
+// carry a code, so the summary is used with any quoted values and numbers
+// removed, as those would make every diagnostic unique.
+func diagnosticCode(summary string) string {
+	code := quotedPattern.ReplaceAllString(summary, `"_"`)
+	code = numberPattern.ReplaceAllString(code, "N")
+	return code
+}
+
+// ServeHTTP writes the metrics in the Prometheus text format.
+func (m *PrometheusMetrics) ServeHTTP(rw http.ResponseWriter, _ *http.Request) {
+	rw.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_ = m.Write(rw)
+}
+
+// Write writes the metrics in the Prometheus text format.
+func (m *PrometheusMetrics) Write(w io.Writer) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var b strings.Builder
+
+	writeHeader(&b, "preview_duration_seconds", "histogram", "Duration of previews, by whether they returned errors.")
+	for _, result := range slices.Sorted(maps.Keys(m.previews)) {
+		m.previews[result].write(&b, "preview_duration_seconds", label("result", result))
+	}
+
+	writeHeader(&b, "preview_phase_duration_seconds", "histogram", "Duration of each phase of a preview.")
+	for _, phase := range slices.Sorted(maps.Keys(m.phases)) {
+		m.phases[phase].write(&b, "preview_phase_duration_seconds", label("phase", string(phase)))
+	}
+
+	writeHeader(&b, "preview_parameters", "histogram", "Number of parameters returned by a preview.")
+	m.parameters.write(&b, "preview_parameters", "")
+
+	writeHeader(&b, "preview_diagnostics_total", "counter", "Diagnostics returned by previews, by severity and code.")
+	keys := make([]diagnosticKey, 0, len(m.diagnostics))
+	for key := range m.diagnostics {
+		keys = append(keys, key)
+	}
+	slices.SortFunc(keys, func(a, b diagnosticKey) int {
+		if c := strings.Compare(string(a.severity), string(b.severity)); c != 0 {
+			return c
+		}
+		return strings.Compare(a.code, b.code)
+	})
+	for _, key := range keys {
+		_, _ = fmt.Fprintf(&b, "preview_diagnostics_total{%s,%s} %d\n",
+			label("severity", string(key.severity)), label("code", key.code), m.diagnostics[key])
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// @typescript-ignore histogram
+type histogram struct {
+	bounds []float64
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+func newHistogram(bounds []float64) *histogram {
+	return &histogram{
+		bounds: bounds,
+		counts: make([]uint64, len(bounds)),
+	}
+}
+
+func (h *histogram) observe(v float64) {
+	for i, bound := range h.bounds {
+		if v <= bound {
+			h.counts[i]++
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+// write writes the histogram series. labels are added to every series, and
+// may be empty.
+func (h *histogram) write(b *strings.Builder, name string, labels string) {
+	sep := ""
+	if labels != "" {
+		sep = ","
+	}
+	for i, bound := range h.bounds {
+		_, _ = fmt.Fprintf(b, "%s_bucket{%s%sle=%q} %d\n", name, labels, sep, formatFloat(bound), h.counts[i])
+	}
+	_, _ = fmt.Fprintf(b, "%s_bucket{%s%sle=\"+Inf\"} %d\n", name, labels, sep, h.count)
+	if labels != "" {
+		labels = "{" + labels + "}"
+	}
+	_, _ = fmt.Fprintf(b, "%s_sum%s %s\n", name, labels, formatFloat(h.sum))
+	_, _ = fmt.Fprintf(b, "%s_count%s %d\n", name, labels, h.count)
+}
+
+func writeHeader(b *strings.Builder, name, kind, help string) {
+	_, _ = fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func label(name, value string) string {
+	return name + `="` + labelEscaper.Replace(value) + `"`
+}
+
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,134 @@
+package web_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/hcl/v2"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/coder/preview"
+	"github.com/coder/preview/web"
+)
+
+func TestPrometheusMetrics(t *testing.T) {
+	t.Parallel()
+
+	m := web.NewPrometheusMetrics()
+	m.ObservePhase(preview.PhaseParse, 30*time.Millisecond)
+	m.ObservePhase(preview.PhaseParse, 3*time.Second)
+	m.ObservePhase(preview.PhaseEvaluate, 5*time.Millisecond)
+	// The code of the diagnostic needs escaping in the label.
+	failure := &hcl.Diagnostic{Severity: hcl.DiagError, Summary: "Bad path \"x\" in C:\\templates\nat line 3"}
+	warning := &hcl.Diagnostic{Severity: hcl.DiagWarning, Summary: "Deprecated"}
+	m.ObservePreview(20*time.Millisecond, hcl.Diagnostics{failure, warning, warning}, 3)
+	m.ObservePreview(2*time.Second, nil, 0)
+
+	srv := httptest.NewServer(m)
+	t.Cleanup(srv.Close)
+	resp, err := srv.Client().Get(srv.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/plain; version=0.0.4; charset=utf-8", resp.Header.Get("Content-Type"))
+
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(resp.Body)
+	require.NoError(t, err)
+	require.Len(t, families, 4)
+
+	for name, help := range map[string]string{
+		"preview_duration_seconds":       "Duration of previews, by whether they returned errors.",
+		"preview_phase_duration_seconds": "Duration of each phase of a preview.",
+		"preview_parameters":             "Number of parameters returned by a preview.",
+	} {
+		require.Contains(t, families, name)
+		assert.Equal(t, help, families[name].GetHelp(), name)
+		assert.Equal(t, dto.MetricType_HISTOGRAM, families[name].GetType(), name)
+	}
+
+	// Buckets are cumulative, and count observations up to their bound.
+	durations := histograms(families["preview_duration_seconds"], "result")
+	require.Len(t, durations, 2)
+	assertBuckets(t, durations["error"], 1, 0.02, map[float64]uint64{0.01: 0, 0.025: 1, 10: 1})
+	assertBuckets(t, durations["success"], 1, 2, map[float64]uint64{1: 0, 2.5: 1})
+
+	phases := histograms(families["preview_phase_duration_seconds"], "phase")
+	require.Len(t, phases, 2)
+	assertBuckets(t, phases["parse"], 2, 3.03, map[float64]uint64{0.025: 0, 0.05: 1, 2.5: 1, 5: 2})
+	assertBuckets(t, phases["evaluate"], 1, 0.005, map[float64]uint64{0.005: 1})
+
+	parameters := histograms(families["preview_parameters"], "")
+	assertBuckets(t, parameters[""], 2, 3, map[float64]uint64{0: 1, 1: 1, 2: 1, 5: 2})
+
+	diagnostics := families["preview_diagnostics_total"]
+	require.NotNil(t, diagnostics)
+	assert.Equal(t, dto.MetricType_COUNTER, diagnostics.GetType())
+	counts := make(map[string]float64)
+	for _, metric := range diagnostics.GetMetric() {
+		labels := labels(metric)
+		counts[labels["severity"]+" "+labels["code"]] = metric.GetCounter().GetValue()
+	}
+	assert.Equal(t, map[string]float64{
+		"error Bad path \"_\" in C:\\templates\nat line N": 1,
+		"warning Deprecated": 2,
+	}, counts)
+}
+
+func TestPrometheusMetricsEmpty(t *testing.T) {
+	t.Parallel()
+
+	var b strings.Builder
+	require.NoError(t, web.NewPrometheusMetrics().Write(&b))
+
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(strings.NewReader(b.String()))
+	require.NoError(t, err)
+	// Only the parameters histogram has a series without observations.
+	require.Contains(t, families, "preview_parameters")
+	assertBuckets(t, histograms(families["preview_parameters"], "")[""], 0, 0, map[float64]uint64{0: 0, 100: 0})
+	assert.Contains(t, b.String(), "# TYPE preview_diagnostics_total counter\n")
+}
+
+// histograms returns the histograms of the family by the value of the label.
+func histograms(family *dto.MetricFamily, label string) map[string]*dto.Histogram {
+	h := make(map[string]*dto.Histogram)
+	for _, metric := range family.GetMetric() {
+		h[labels(metric)[label]] = metric.GetHistogram()
+	}
+	return h
+}
+
+func labels(metric *dto.Metric) map[string]string {
+	l := make(map[string]string)
+	for _, pair := range metric.GetLabel() {
+		l[pair.GetName()] = pair.GetValue()
+	}
+	return l
+}
+
+// assertBuckets checks the count and sum of the histogram, and the
+// cumulative count of the buckets with the given upper bounds.
+func assertBuckets(t *testing.T, h *dto.Histogram, count uint64, sum float64, buckets map[float64]uint64) {
+	t.Helper()
+	require.NotNil(t, h)
+	assert.Equal(t, count, h.GetSampleCount())
+	assert.InDelta(t, sum, h.GetSampleSum(), 1e-9)
+
+	got := make(map[float64]uint64)
+	var previous uint64
+	for _, bucket := range h.GetBucket() {
+		assert.GreaterOrEqual(t, bucket.GetCumulativeCount(), previous, "buckets are cumulative")
+		previous = bucket.GetCumulativeCount()
+		got[bucket.GetUpperBound()] = bucket.GetCumulativeCount()
+	}
+	for bound, expected := range buckets {
+		assert.Equal(t, expected, got[bound], "le=%v", bound)
+	}
+}
@@ -0,0 +1,84 @@
+package web
+
+import (
+	"context"
+	"io/fs"
+	"time"
+
+	"github.com/hashicorp/hcl/v2"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sync/semaphore"
+
+	"github.com/coder/preview"
+)
+
+// Options configure how previews are run. The zero value is ready to use.
+//
+// @typescript-ignore Options
+type Options struct {
+	// Metrics records every preview, if set.
+	Metrics preview.Metrics
+	// Tracer records spans for every preview, if set.
+	Tracer trace.Tracer
+	// Recorder records the requests and responses of a session, if set.
+	// It is ignored by stateless previews.
+	Recorder *SessionRecorder
+	// DeltaResponses makes a session send the difference from the previous
+	// response, instead of the full result. It is ignored by stateless
+	// previews.
+	DeltaResponses bool
+
+	// Concurrency is shared by every session and stateless preview, and
+	// bounds the number of previews that run at once. Each preview acquires
+	// a weight of 1. If nil, previews are not limited.
+	Concurrency *semaphore.Weighted
+	// Timeout bounds the duration of a preview, not counting the time spent
+	// waiting for Concurrency. Zero is unlimited. An evaluation that runs out
+	// of time stops at its next iteration, after the preview has returned,
+	// and holds its Concurrency slot until then.
+	Timeout time.Duration
+	// Budget bounds the work of a preview.
+	Budget preview.Budget
+	// ParseCache shares parsed template files between previews. If nil,
+	// each session parses with a cache of its own, and stateless previews
+	// parse every file.
+	ParseCache *preview.ParseCache
+}
+
+// preview runs the preview with the options applied.
+func (o Options) preview(ctx context.Context, input preview.Input, dir fs.FS) (*preview.Output, hcl.Diagnostics) {
+	if o.Concurrency != nil {
+		if err := o.Concurrency.Acquire(ctx, 1); err != nil {
+			return nil, hcl.Diagnostics{
+				{
+					Severity: hcl.DiagError,
+					Summary:  "Preview canceled",
+					Detail:   "Canceled while waiting for other previews to finish: " + err.Error(),
+				},
+			}
+		}
+		// The slot is released once the evaluation has stopped, rather than
+		// when the preview returns, so that evaluations that ran out of time
+		// still count.
+		evaluated := make(chan struct{})
+		input.Evaluated = evaluated
+		defer func() {
+			go func() {
+				<-evaluated
+				o.Concurrency.Release(1)
+			}()
+		}()
+	}
+
+	if o.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, o.Timeout)
+		defer cancel()
+	}
+
+	input.Metrics = o.Metrics
+	input.Tracer = o.Tracer
+	input.Budget = o.Budget
+	input.ParseCache = o.ParseCache
+	return preview.Preview(ctx, input, dir)
+}
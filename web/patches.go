@@ -0,0 +1,54 @@
+package web
+
+import (
+	"fmt"
+	"io/fs"
+	"maps"
+
+	"github.com/coder/preview/overlayfs"
+)
+
+// FilePatch replaces, deletes or restores a single template file for the
+// rest of the session. Patches are never written to disk.
+type FilePatch struct {
+	// Path is relative to the template directory.
+	Path    string `json:"path"`
+	Content string `json:"content"`
+	// Delete hides the file instead of replacing it.
+	Delete bool `json:"delete,omitempty"`
+	// Revert drops any earlier patch, restoring the original file.
+	Revert bool `json:"revert,omitempty"`
+}
+
+// applyPatches returns the session patches with the new patches applied. A
+// nil content marks a deleted file.
+func applyPatches(current map[string][]byte, patches []FilePatch) (map[string][]byte, error) {
+	next := maps.Clone(current)
+	if next == nil {
+		next = make(map[string][]byte)
+	}
+
+	for _, patch := range patches {
+		if !fs.ValidPath(patch.Path) || patch.Path == "." {
+			return current, fmt.Errorf("invalid file path %q", patch.Path)
+		}
+
+		switch {
+		case patch.Revert:
+			delete(next, patch.Path)
+		case patch.Delete:
+			next[patch.Path] = nil
+		default:
+			next[patch.Path] = []byte(patch.Content)
+		}
+	}
+	return next, nil
+}
+
+// patchedFS returns the template directory with the patches layered on top.
+func patchedFS(dir fs.FS, patches map[string][]byte) (fs.FS, error) {
+	if len(patches) == 0 {
+		return dir, nil
+	}
+	return overlayfs.New(dir, patches)
+}
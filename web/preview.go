@@ -0,0 +1,108 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/zclconf/go-cty/cty"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+
+	"github.com/coder/preview"
+	"github.com/coder/preview/types"
+)
+
+// PreviewRequest is the body of a stateless preview. Unlike a websocket
+// session, every input is sent with the request.
+type PreviewRequest struct {
+	Inputs map[string]string    `json:"inputs"`
+	Owner  types.WorkspaceOwner `json:"owner"`
+	// PlanJSON is the optional output of 'terraform show -json'.
+	PlanJSON  map[string]any  `json:"plan_json,omitempty"`
+	Workspace types.Workspace `json:"workspace"`
+}
+
+type PreviewResponse struct {
+	Result
+	// ModuleOutputs are the values of the root module outputs. Values that
+	// are not known during the preview are null.
+	ModuleOutputs map[string]any `json:"module_outputs"`
+}
+
+// Preview runs a single preview of the template in dir.
+func Preview(ctx context.Context, dir fs.FS, req PreviewRequest, opts Options) PreviewResponse {
+	var plan json.RawMessage
+	if req.PlanJSON != nil {
+		var err error
+		plan, err = json.Marshal(req.PlanJSON)
+		if err != nil {
+			return PreviewResponse{
+				Result: newResult(nil, hcl.Diagnostics{
+					{
+						Severity: hcl.DiagError,
+						Summary:  "Invalid plan JSON",
+						Detail:   err.Error(),
+					},
+				}),
+				ModuleOutputs: map[string]any{},
+			}
+		}
+	}
+
+	output, diags := opts.preview(ctx, preview.Input{
+		PlanJSON:        plan,
+		ParameterValues: req.Inputs,
+		Owner:           req.Owner,
+		Workspace:       req.Workspace,
+	}, dir)
+
+	resp := PreviewResponse{
+		ModuleOutputs: map[string]any{},
+	}
+	if output != nil {
+		outputs, err := moduleOutputsJSON(output.ModuleOutput)
+		if err != nil {
+			diags = diags.Append(&hcl.Diagnostic{
+				Severity: hcl.DiagWarning,
+				Summary:  "Module outputs omitted",
+				Detail:   err.Error(),
+			})
+		} else {
+			resp.ModuleOutputs = outputs
+		}
+	}
+	resp.Result = newResult(output, diags)
+	return resp
+}
+
+// moduleOutputsJSON encodes the module outputs. Unknown values cannot be
+// encoded, so they are replaced with null.
+func moduleOutputsJSON(val cty.Value) (map[string]any, error) {
+	if val == cty.NilVal || val.IsNull() {
+		return map[string]any{}, nil
+	}
+
+	val, _ = val.UnmarkDeep()
+	val, err := cty.Transform(val, func(_ cty.Path, v cty.Value) (cty.Value, error) {
+		if !v.IsKnown() {
+			return cty.NullVal(v.Type()), nil
+		}
+		return v, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("replace unknown values: %w", err)
+	}
+
+	data, err := ctyjson.Marshal(val, val.Type())
+	if err != nil {
+		return nil, fmt.Errorf("encode module outputs: %w", err)
+	}
+
+	outputs := make(map[string]any)
+	if err := json.Unmarshal(data, &outputs); err != nil {
+		return nil, fmt.Errorf("decode module outputs: %w", err)
+	}
+	return outputs, nil
+}
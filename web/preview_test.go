@@ -0,0 +1,140 @@
+package web
+
+import (
+	"context"
+	"testing"
+	"testing/fstest"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+
+	"github.com/coder/preview/types"
+)
+
+func TestPreview(t *testing.T) {
+	t.Parallel()
+
+	dir := fstest.MapFS{"main.tf": &fstest.MapFile{Data: []byte(`
+data "coder_workspace" "me" {}
+data "coder_workspace_owner" "me" {}
+
+data "coder_parameter" "region" {
+  name    = "region"
+  type    = "string"
+  default = "eu"
+}
+
+data "coder_workspace_tags" "tags" {
+  tags = {
+    "region" = data.coder_parameter.region.value
+  }
+}
+
+output "workspace" {
+  value = {
+    name  = data.coder_workspace.me.name
+    count = data.coder_workspace.me.start_count
+  }
+}
+
+output "groups" {
+  value = data.coder_workspace_owner.me.groups
+}
+
+output "region" {
+  value = data.coder_parameter.region.value
+}
+`)}}
+
+	t.Run("Inputs", func(t *testing.T) {
+		t.Parallel()
+
+		resp := Preview(context.Background(), dir, PreviewRequest{
+			Inputs: map[string]string{"region": "us"},
+			Owner:  types.WorkspaceOwner{Groups: []string{"admins"}},
+			Workspace: types.Workspace{
+				ID:         uuid.New(),
+				Name:       "dev",
+				StartCount: 1,
+			},
+		}, Options{})
+		assert.Empty(t, resp.Diagnostics)
+		require.Len(t, resp.Parameters, 1)
+		assert.Equal(t, "us", resp.Parameters[0].Value.AsString())
+		assert.Equal(t, map[string]string{"region": "us"}, resp.WorkspaceTags.Tags)
+		assert.Equal(t, map[string]any{
+			"workspace": map[string]any{"name": "dev", "count": 1.0},
+			"groups":    []any{"admins"},
+			"region":    "us",
+		}, resp.ModuleOutputs)
+	})
+
+	t.Run("NoWorkspace", func(t *testing.T) {
+		t.Parallel()
+
+		// Without a workspace, its values are unknown, and so null.
+		resp := Preview(context.Background(), dir, PreviewRequest{}, Options{})
+		assert.Empty(t, resp.Diagnostics)
+		assert.Equal(t, map[string]any{
+			"workspace": map[string]any{"name": nil, "count": nil},
+			"groups":    []any{},
+			"region":    "eu",
+		}, resp.ModuleOutputs)
+	})
+
+	t.Run("NoOutputs", func(t *testing.T) {
+		t.Parallel()
+
+		resp := Preview(context.Background(), fstest.MapFS{"main.tf": &fstest.MapFile{Data: []byte(`locals {}`)}}, PreviewRequest{}, Options{})
+		assert.Empty(t, resp.Diagnostics)
+		assert.NotNil(t, resp.ModuleOutputs)
+		assert.Empty(t, resp.ModuleOutputs)
+	})
+}
+
+func TestModuleOutputsJSON(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		name     string
+		value    cty.Value
+		expected map[string]any
+	}{
+		{name: "Nil", value: cty.NilVal, expected: map[string]any{}},
+		{name: "Null", value: cty.NullVal(cty.DynamicPseudoType), expected: map[string]any{}},
+		{
+			name: "Known",
+			value: cty.ObjectVal(map[string]cty.Value{
+				"name":  cty.StringVal("dev"),
+				"sizes": cty.ListVal([]cty.Value{cty.NumberIntVal(1), cty.NumberIntVal(2)}),
+			}),
+			expected: map[string]any{"name": "dev", "sizes": []any{1.0, 2.0}},
+		},
+		{
+			name: "Unknown",
+			value: cty.ObjectVal(map[string]cty.Value{
+				"name":   cty.UnknownVal(cty.String),
+				"nested": cty.ObjectVal(map[string]cty.Value{"id": cty.UnknownVal(cty.Number)}),
+				"list":   cty.UnknownVal(cty.List(cty.String)),
+			}),
+			expected: map[string]any{"name": nil, "nested": map[string]any{"id": nil}, "list": nil},
+		},
+		{
+			name: "Marked",
+			value: cty.ObjectVal(map[string]cty.Value{
+				"secret": cty.StringVal("x").Mark("sensitive"),
+			}),
+			expected: map[string]any{"secret": "x"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			outputs, err := moduleOutputsJSON(tc.value)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, outputs)
+		})
+	}
+}
@@ -0,0 +1,203 @@
+package web
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"sync"
+	"time"
+
+	"cdr.dev/slog"
+	"github.com/google/uuid"
+	"github.com/hashicorp/hcl/v2"
+
+	"github.com/coder/preview/types"
+)
+
+// Recording is a single request and its response, written as one line of a
+// session recording. It holds the session state the request was previewed
+// with, so that every line can be replayed on its own.
+//
+// @typescript-ignore Recording
+type Recording struct {
+	Time time.Time `json:"time"`
+	// Session identifies the websocket session of the request.
+	Session string `json:"session"`
+	// Template is the name of the template directory, or 'uploads/<id>' for
+	// an uploaded template. TemplateHash is the hash of its contents at the
+	// time of the preview. The contents of uploaded templates are not
+	// recorded, so they cannot be replayed.
+	Template     string `json:"template"`
+	TemplateHash string `json:"template_hash"`
+
+	Inputs SessionInputs `json:"inputs"`
+	// Patches are the file patches in effect. A null content is a deleted
+	// file.
+	Patches map[string][]byte `json:"patches,omitempty"`
+	Request Request           `json:"request"`
+	// UpdateDiagnostics are the errors from applying the session update or
+	// file patches of the request.
+	UpdateDiagnostics []types.FriendlyDiagnostic `json:"update_diagnostics,omitempty"`
+	// Reload is set if the response was sent because the template changed.
+	Reload   bool            `json:"reload,omitempty"`
+	Response json.RawMessage `json:"response"`
+}
+
+// Recorder appends recordings to a JSONL file. It is safe for concurrent
+// use.
+//
+// @typescript-ignore Recorder
+type Recorder struct {
+	logger slog.Logger
+
+	mu   sync.Mutex
+	file *os.File
+	w    *bufio.Writer
+}
+
+// NewRecorder appends recordings to the file at path, creating it if
+// needed.
+func NewRecorder(logger slog.Logger, path string) (*Recorder, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("open recording: %w", err)
+	}
+	return &Recorder{
+		logger: logger,
+		file:   f,
+		w:      bufio.NewWriter(f),
+	}, nil
+}
+
+// Session returns a recorder for a new session of the named template.
+func (r *Recorder) Session(template string) *SessionRecorder {
+	return &SessionRecorder{
+		recorder: r,
+		id:       uuid.NewString(),
+		template: template,
+	}
+}
+
+func (r *Recorder) write(ctx context.Context, rec Recording) {
+	line, err := json.Marshal(rec)
+	if err != nil {
+		r.logger.Error(ctx, "failed to encode recording", slog.Error(err))
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, _ = r.w.Write(append(line, '\n'))
+	// Flushed on every line, so that a recording is complete even if the
+	// server is killed.
+	if err := r.w.Flush(); err != nil {
+		r.logger.Error(ctx, "failed to write recording", slog.Error(err))
+	}
+}
+
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.w.Flush(); err != nil {
+		_ = r.file.Close()
+		return err
+	}
+	return r.file.Close()
+}
+
+// SessionRecorder records the requests of a single session.
+//
+// @typescript-ignore SessionRecorder
+type SessionRecorder struct {
+	recorder *Recorder
+	id       string
+	template string
+}
+
+// record writes the request and its response. The hash is that of the
+// template, as returned by TemplateHash.
+func (r *SessionRecorder) record(ctx context.Context, req *Request, hash string, inputs SessionInputs, patches map[string][]byte, resp *Response) {
+	body, err := json.Marshal(resp)
+	if err != nil {
+		r.recorder.logger.Error(ctx, "failed to encode response for recording", slog.Error(err))
+		return
+	}
+
+	r.recorder.write(ctx, Recording{
+		Time:              time.Now(),
+		Session:           r.id,
+		Template:          r.template,
+		TemplateHash:      hash,
+		Inputs:            inputs,
+		Patches:           patches,
+		Request:           *req,
+		UpdateDiagnostics: friendlyDiagnostics(req.updateDiags),
+		Reload:            req.reload,
+		Response:          body,
+	})
+}
+
+// ReadRecordings reads every recording from a JSONL stream.
+func ReadRecordings(r io.Reader) ([]Recording, error) {
+	var recordings []Recording
+	dec := json.NewDecoder(r)
+	for {
+		var rec Recording
+		err := dec.Decode(&rec)
+		if err == io.EOF {
+			return recordings, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read recording %d: %w", len(recordings)+1, err)
+		}
+		recordings = append(recordings, rec)
+	}
+}
+
+// TemplateHash returns the hash of the template contents, as recorded in
+// Recording.TemplateHash.
+func TemplateHash(dir fs.FS) (string, error) {
+	_, _, hash, err := snapshot(dir)
+	return hash, err
+}
+
+// Replay previews the recorded request again against the template in dir,
+// with the recorded session state.
+func Replay(ctx context.Context, dir fs.FS, rec Recording, opts Options) Response {
+	req := rec.Request
+	req.updateDiags = hclDiagnostics(rec.UpdateDiagnostics)
+	req.reload = rec.Reload
+
+	return evaluate(ctx, opts, &req, dir, rec.Inputs, rec.Patches)
+}
+
+func friendlyDiagnostics(diags hcl.Diagnostics) []types.FriendlyDiagnostic {
+	if len(diags) == 0 {
+		return nil
+	}
+	// types.Diagnostics defines the conversion, through its JSON form.
+	var friendly []types.FriendlyDiagnostic
+	data, _ := json.Marshal(types.Diagnostics(diags))
+	_ = json.Unmarshal(data, &friendly)
+	return friendly
+}
+
+func hclDiagnostics(friendly []types.FriendlyDiagnostic) hcl.Diagnostics {
+	var diags hcl.Diagnostics
+	for _, d := range friendly {
+		severity := hcl.DiagError
+		if d.Severity == types.DiagnosticSeverityWarning {
+			severity = hcl.DiagWarning
+		}
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: severity,
+			Summary:  d.Summary,
+			Detail:   d.Detail,
+		})
+	}
+	return diags
+}
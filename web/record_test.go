@@ -0,0 +1,103 @@
+package web_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"cdr.dev/slog/sloggers/slogtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/coder/preview/web"
+)
+
+func TestRecordReplay(t *testing.T) {
+	t.Parallel()
+
+	logger := slogtest.Make(t, nil)
+	dir := fstest.MapFS{"main.tf": &fstest.MapFile{Data: []byte(clientTemplate)}}
+	path := filepath.Join(t.TempDir(), "session.jsonl")
+	recorder, err := web.NewRecorder(logger, path)
+	require.NoError(t, err)
+
+	srv := httptest.NewServer(web.SessionHandler(logger, dir, web.Options{
+		Recorder: recorder.Session("demo"),
+	}))
+	t.Cleanup(srv.Close)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	client, err := web.DialClient(ctx, srv.URL, web.ClientOptions{
+		HTTPClient:       srv.Client(),
+		DisableReconnect: true,
+	})
+	require.NoError(t, err)
+	first, err := client.Preview(ctx, web.Request{Inputs: map[string]string{"region": "us"}})
+	require.NoError(t, err)
+	second, err := client.Preview(ctx, web.Request{
+		Inputs: map[string]string{"region": "eu"},
+		Files: []web.FilePatch{{
+			Path: "extra.tf",
+			Content: `data "coder_parameter" "extra" {
+  name    = "extra"
+  default = "x"
+}`,
+		}},
+	})
+	require.NoError(t, err)
+	require.NoError(t, client.Close())
+	require.NoError(t, recorder.Close())
+
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+	recordings, err := web.ReadRecordings(f)
+	require.NoError(t, err)
+	require.Len(t, recordings, 2)
+
+	hash, err := web.TemplateHash(dir)
+	require.NoError(t, err)
+	for idx, sent := range []*web.Response{first, second} {
+		rec := recordings[idx]
+		assert.Equal(t, "demo", rec.Template)
+		assert.Equal(t, hash, rec.TemplateHash)
+		assert.Equal(t, recordings[0].Session, rec.Session)
+		assert.Equal(t, sent.ID, rec.Request.ID)
+		assert.JSONEq(t, responseJSON(t, sent), string(rec.Response))
+
+		// The recording holds everything needed to preview it again.
+		replayed := web.Replay(ctx, dir, rec, web.Options{})
+		assert.JSONEq(t, string(rec.Response), responseJSON(t, &replayed))
+	}
+	assert.Contains(t, recordings[1].Patches, "extra.tf")
+}
+
+func TestTemplateHash(t *testing.T) {
+	t.Parallel()
+
+	dir := fstest.MapFS{"main.tf": &fstest.MapFile{Data: []byte(clientTemplate)}}
+	hash, err := web.TemplateHash(dir)
+	require.NoError(t, err)
+
+	same, err := web.TemplateHash(fstest.MapFS{"main.tf": &fstest.MapFile{Data: []byte(clientTemplate)}})
+	require.NoError(t, err)
+	assert.Equal(t, hash, same)
+
+	changed, err := web.TemplateHash(fstest.MapFS{"main.tf": &fstest.MapFile{Data: []byte(clientTemplate + "\n")}})
+	require.NoError(t, err)
+	assert.NotEqual(t, hash, changed)
+}
+
+func responseJSON(t *testing.T, resp *web.Response) string {
+	t.Helper()
+	data, err := json.Marshal(resp)
+	require.NoError(t, err)
+	return string(data)
+}
@@ -2,9 +2,15 @@ package web
 
 import (
 	"context"
+	"fmt"
 	"io/fs"
+	"maps"
+	"math"
+	"sync"
 
 	"cdr.dev/slog"
+	"github.com/hashicorp/hcl/v2"
+
 	"github.com/coder/preview"
 	"github.com/coder/preview/types"
 )
@@ -14,37 +20,136 @@ type Request struct {
 	// ID so that the client can match it to the request.
 	ID     int               `json:"id"`
 	Inputs map[string]string `json:"inputs"`
+	// Session, if set, changes the session inputs before the preview. The
+	// change applies to every later request as well.
+	Session *SessionInputsUpdate `json:"session,omitempty"`
+	// Files patches the template files before the preview. Like session
+	// updates, patches apply to every later request as well.
+	Files []FilePatch `json:"files,omitempty"`
+	// Snapshot asks for a full response on a session with delta responses,
+	// for example after the client missed a response.
+	Snapshot bool `json:"snapshot,omitempty"`
+
+	// updateDiags are the diagnostics from applying the session update.
+	updateDiags hcl.Diagnostics
+	// reload is set for requests replayed after the template changed.
+	reload bool
 }
 
 type Response struct {
-	ID          int               `json:"id"`
+	ID int `json:"id"`
+	Result
+	// Session are the session inputs the preview used.
+	Session SessionInputs `json:"session"`
+	// Reloaded is set on responses that were not requested by the client,
+	// but sent because the template files changed. The ID is that of the
+	// newest request.
+	Reloaded bool `json:"reloaded,omitempty"`
+
+	// Seq numbers the responses of a session with delta responses, starting
+	// at 1. It is not set otherwise.
+	Seq int `json:"seq,omitempty"`
+	// Delta is set instead of the result when the response is a delta from
+	// the previous response. The embedded result is empty, and must be
+	// ignored.
+	Delta *ResponseDelta `json:"delta,omitempty"`
+}
+
+// Result is the outcome of a preview. It is shared by websocket responses
+// and stateless previews.
+type Result struct {
 	Diagnostics types.Diagnostics `json:"diagnostics"`
 	Parameters  []types.Parameter `json:"parameters"`
-	// TODO: Workspace tags
+	// WorkspaceTags are the provisioner tags the workspace would be
+	// created with.
+	WorkspaceTags WorkspaceTags `json:"workspace_tags"`
+}
+
+type WorkspaceTags struct {
+	// Tags are the resolved tags.
+	Tags map[string]string `json:"tags"`
+	// Unusable are the tags whose key or value could not be resolved with
+	// the given inputs.
+	Unusable []types.TagProvenance `json:"unusable"`
+	// Diagnostics is the subset of the response diagnostics that relate to
+	// the workspace tags.
+	Diagnostics types.Diagnostics `json:"diagnostics"`
 }
 
 // @typescript-ignore Session
 type Session struct {
-	logger       slog.Logger
-	dir          fs.FS
-	staticInputs SessionInputs
+	logger slog.Logger
+	opts   Options
+
+	mu  sync.Mutex
+	dir fs.FS
+	// dirHash is the hash of dir for recordings, computed once per template
+	// rather than once per response.
+	dirHash string
+	inputs  SessionInputs
+	// lastInputs are the parameter values of the newest request, replayed
+	// when the template is reloaded.
+	lastInputs map[string]string
+	// patches are the file contents layered over dir. A nil value is a
+	// deleted file.
+	patches map[string][]byte
+	// latest is the newest request ID received. Requests with an older ID
+	// are stale, and their responses are never sent.
+	latest int
+	// cancelPreview cancels the in-flight preview, if any.
+	cancelPreview context.CancelFunc
+	// snapshot is set when the client asked for a full response, until one
+	// is written.
+	snapshot bool
 
+	// seq and sent are the sequence number and result of the last response
+	// written, for delta responses. They are only used by the write loop.
+	seq  int
+	sent *Result
+
+	// requests and responses hold at most one item. A newer item replaces
+	// a queued one that has not been consumed yet.
 	requests  chan *Request
 	responses chan *Response
 }
 
 type SessionInputs struct {
-	PlanPath string
-	User     types.WorkspaceOwner
+	PlanPath string `json:"plan_path"`
+	// UserName is the name of the user in the template's users file that
+	// User was loaded from, if any.
+	UserName string               `json:"user_name"`
+	User     types.WorkspaceOwner `json:"user"`
+	// PreviousValues are parameter values from a previous build. They are
+	// used for any parameter the request does not set a value for.
+	PreviousValues map[string]string `json:"previous_values"`
+}
+
+// SessionInputsUpdate changes the inputs of a session. Fields that are not
+// set are left unchanged.
+type SessionInputsUpdate struct {
+	PlanPath *string `json:"plan_path,omitempty"`
+	// UserName selects a user from the template's users file. It takes
+	// precedence over User.
+	UserName *string               `json:"user_name,omitempty"`
+	User     *types.WorkspaceOwner `json:"user,omitempty"`
+	// PreviousValues replaces the previous values. An empty object clears
+	// them.
+	PreviousValues map[string]string `json:"previous_values,omitempty"`
 }
 
-func NewSession(logger slog.Logger, dir fs.FS, staticInputs SessionInputs) *Session {
+func NewSession(logger slog.Logger, dir fs.FS, inputs SessionInputs, opts Options) *Session {
+	if opts.ParseCache == nil {
+		// Only the files a patch changed are parsed again.
+		opts.ParseCache = preview.NewParseCache(0)
+	}
 	return &Session{
-		logger:       logger,
-		dir:          dir,
-		staticInputs: staticInputs,
-		requests:     make(chan *Request, 2),
-		responses:    make(chan *Response, 2),
+		logger:    logger,
+		opts:      opts,
+		dir:       dir,
+		inputs:    inputs,
+		latest:    math.MinInt,
+		requests:  make(chan *Request, 1),
+		responses: make(chan *Response, 1),
 	}
 }
 
@@ -54,31 +159,242 @@ func (s *Session) handleRequests(ctx context.Context) {
 		case <-ctx.Done():
 			return
 		case req := <-s.requests:
-			resp := s.preview(ctx, req)
-			// TODO: If this blocks, that is unfortunate. We should drop the
-			// oldest requests.
-			s.responses <- &resp
+			previewCtx, cancel := context.WithCancel(ctx)
+			s.mu.Lock()
+			if s.stale(req) {
+				s.mu.Unlock()
+				cancel()
+				continue
+			}
+			s.cancelPreview = cancel
+			dir := s.dir
+			dirHash := s.recordingHash(ctx)
+			inputs := s.inputs
+			// Patches are replaced, never modified, so the map can be shared.
+			patches := s.patches
+			s.mu.Unlock()
+
+			resp := evaluate(previewCtx, s.opts, req, dir, inputs, patches)
+
+			s.mu.Lock()
+			s.cancelPreview = nil
+			stale := s.stale(req)
+			s.mu.Unlock()
+			canceled := previewCtx.Err() != nil
+			cancel()
+
+			if stale || canceled {
+				s.logger.Debug(ctx, "dropping superseded response", slog.F("id", req.ID))
+				continue
+			}
+			if s.opts.Recorder != nil {
+				s.opts.Recorder.record(ctx, req, dirHash, inputs, patches, &resp)
+			}
+			s.sendResponse(ctx, &resp)
 		}
 	}
 }
 
+// sendRequest queues the request, replacing any queued request that has not
+// started yet. An in-flight preview for an older request is canceled.
 func (s *Session) sendRequest(ctx context.Context, req Request) {
+	s.mu.Lock()
+	if req.ID < s.latest {
+		s.mu.Unlock()
+		s.logger.Debug(ctx, "ignoring out of order request",
+			slog.F("id", req.ID),
+			slog.F("latest", s.latest),
+		)
+		return
+	}
+	if req.ID > s.latest && s.cancelPreview != nil {
+		s.cancelPreview()
+	}
+	s.latest = req.ID
+	s.lastInputs = req.Inputs
+	if req.Snapshot {
+		s.snapshot = true
+	}
+	// Updates are applied as they arrive, so that they are not lost if the
+	// request itself is superseded.
+	if req.Session != nil {
+		inputs, err := s.applyUpdate(s.inputs, *req.Session)
+		if err != nil {
+			req.updateDiags = hcl.Diagnostics{
+				{
+					Severity: hcl.DiagError,
+					Summary:  "Invalid session update",
+					Detail:   err.Error(),
+				},
+			}
+		} else {
+			s.inputs = inputs
+		}
+	}
+	if len(req.Files) > 0 {
+		patches, err := applyPatches(s.patches, req.Files)
+		if err != nil {
+			req.updateDiags = req.updateDiags.Append(&hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Invalid file patch",
+				Detail:   err.Error(),
+			})
+		} else {
+			s.patches = patches
+		}
+	}
+	s.mu.Unlock()
+
+	s.enqueue(ctx, &req)
+}
+
+// Reload replaces the template files, and previews the newest request again.
+// The response is sent without a request from the client.
+func (s *Session) Reload(ctx context.Context, dir fs.FS) {
+	s.mu.Lock()
+	s.dir = dir
+	s.dirHash = ""
+	if s.latest == math.MinInt {
+		// Nothing has been previewed yet.
+		s.mu.Unlock()
+		return
+	}
+	if s.cancelPreview != nil {
+		s.cancelPreview()
+	}
+	req := &Request{
+		ID:     s.latest,
+		Inputs: s.lastInputs,
+		reload: true,
+	}
+	s.mu.Unlock()
+
+	s.logger.Debug(ctx, "template changed, reloading", slog.F("id", req.ID))
+	s.enqueue(ctx, req)
+}
+
+// enqueue queues the request, replacing a queued request that has not
+// started yet.
+func (s *Session) enqueue(ctx context.Context, req *Request) {
+	select {
+	case queued := <-s.requests:
+		s.logger.Debug(ctx, "dropping queued request", slog.F("id", queued.ID))
+	default:
+	}
+
+	// Another sender can fill the slot in between, in which case this
+	// waits for the preview loop to take it.
 	select {
 	case <-ctx.Done():
-		return
-	case s.requests <- &req:
+	case s.requests <- req:
+	}
+}
+
+// sendResponse queues the response for the write loop, replacing any queued
+// response that has not been written yet.
+func (s *Session) sendResponse(ctx context.Context, resp *Response) {
+	select {
+	case <-s.responses:
+	default:
+	}
+
+	select {
+	case <-ctx.Done():
+	case s.responses <- resp:
+	}
+}
+
+// applyUpdate returns the inputs with the update applied.
+func (s *Session) applyUpdate(inputs SessionInputs, update SessionInputsUpdate) (SessionInputs, error) {
+	if update.PlanPath != nil {
+		inputs.PlanPath = *update.PlanPath
+	}
+	if update.User != nil {
+		inputs.UserName = ""
+		inputs.User = *update.User
+	}
+	if update.UserName != nil {
+		inputs.UserName = *update.UserName
+		inputs.User = types.WorkspaceOwner{}
+		if inputs.UserName != "" {
+			users, err := AvailableUsers(s.dir)
+			if err != nil {
+				return inputs, err
+			}
+			user, ok := users[inputs.UserName]
+			if !ok {
+				return inputs, fmt.Errorf("unknown user %q", inputs.UserName)
+			}
+			inputs.User = user
+		}
+	}
+	if update.PreviousValues != nil {
+		inputs.PreviousValues = update.PreviousValues
 	}
+	return inputs, nil
 }
 
-func (s *Session) preview(ctx context.Context, req *Request) Response {
-	output, diags := preview.Preview(ctx, preview.Input{
-		PlanJSONPath:    s.staticInputs.PlanPath,
-		ParameterValues: req.Inputs,
-		Owner:           s.staticInputs.User,
-	}, s.dir)
+// recordingHash returns the hash of the template for recordings, or an empty
+// string if the session is not recorded. The caller must hold s.mu.
+func (s *Session) recordingHash(ctx context.Context) string {
+	if s.opts.Recorder == nil || s.dirHash != "" {
+		return s.dirHash
+	}
+	hash, err := TemplateHash(s.dir)
+	if err != nil {
+		s.logger.Warn(ctx, "failed to hash template for recording", slog.Error(err))
+		return ""
+	}
+	s.dirHash = hash
+	return hash
+}
 
-	r := Response{
-		ID:          req.ID,
+// stale reports whether a newer request has been received. The caller must
+// hold s.mu.
+func (s *Session) stale(req *Request) bool {
+	return req.ID < s.latest
+}
+
+// evaluate previews the request with the session state it was sent in.
+func evaluate(ctx context.Context, opts Options, req *Request, dir fs.FS, inputs SessionInputs, patches map[string][]byte) Response {
+	// Unpatched files are served from the shared template copy, and their
+	// parsed form from the parse cache.
+	dir, err := patchedFS(dir, patches)
+	if err != nil {
+		return Response{
+			ID: req.ID,
+			Result: newResult(nil, req.updateDiags.Append(&hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Invalid file patch",
+				Detail:   err.Error(),
+			})),
+			Session:  inputs,
+			Reloaded: req.reload,
+		}
+	}
+
+	values := maps.Clone(inputs.PreviousValues)
+	if values == nil {
+		values = make(map[string]string)
+	}
+	maps.Copy(values, req.Inputs)
+
+	output, diags := opts.preview(ctx, preview.Input{
+		PlanJSONPath:    inputs.PlanPath,
+		ParameterValues: values,
+		Owner:           inputs.User,
+	}, dir)
+
+	return Response{
+		ID:       req.ID,
+		Result:   newResult(output, req.updateDiags.Extend(diags)),
+		Session:  inputs,
+		Reloaded: req.reload,
+	}
+}
+
+func newResult(output *preview.Output, diags hcl.Diagnostics) Result {
+	r := Result{
 		Diagnostics: types.Diagnostics(diags),
 	}
 	if output == nil {
@@ -86,6 +402,11 @@ func (s *Session) preview(ctx context.Context, req *Request) Response {
 	}
 
 	r.Parameters = output.Parameters
+	r.WorkspaceTags = WorkspaceTags{
+		Tags:        output.WorkspaceTags.Tags(),
+		Unusable:    output.WorkspaceTags.UnusableTags().Provenance(),
+		Diagnostics: types.Diagnostics(output.WorkspaceTagDiagnostics),
+	}
 
 	return r
 }
@@ -0,0 +1,315 @@
+package web
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"cdr.dev/slog/sloggers/slogtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sync/semaphore"
+
+	"github.com/coder/preview/types"
+)
+
+func TestSessionCoalescesRequests(t *testing.T) {
+	t.Parallel()
+
+	dir := fstest.MapFS{"main.tf": &fstest.MapFile{Data: []byte(`
+data "coder_parameter" "count" {
+  name    = "count"
+  type    = "number"
+  default = 0
+}
+`)}}
+	const burst = 20
+
+	for _, tc := range []struct {
+		name string
+		// inFlight starts the preview loop before the burst, with the first
+		// preview waiting for a concurrency slot until the burst is over.
+		inFlight bool
+	}{
+		{name: "Queued"},
+		{name: "InFlight", inFlight: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+
+			// Holding the only slot blocks every preview.
+			slots := semaphore.NewWeighted(1)
+			require.NoError(t, slots.Acquire(ctx, 1))
+			s := NewSession(slogtest.Make(t, nil), dir, SessionInputs{}, Options{Concurrency: slots})
+
+			if tc.inFlight {
+				go s.handleRequests(ctx)
+			}
+			for id := 1; id <= burst; id++ {
+				s.sendRequest(ctx, Request{ID: id, Inputs: map[string]string{"count": strconv.Itoa(id)}})
+			}
+			if !tc.inFlight {
+				go s.handleRequests(ctx)
+			}
+			slots.Release(1)
+
+			select {
+			case resp := <-s.responses:
+				require.Equal(t, burst, resp.ID)
+				require.Len(t, resp.Parameters, 1)
+				assert.Equal(t, strconv.Itoa(burst), resp.Parameters[0].Value.AsString())
+			case <-ctx.Done():
+				t.Fatal("no response")
+			}
+
+			select {
+			case resp := <-s.responses:
+				t.Fatalf("unexpected response %d", resp.ID)
+			case <-time.After(200 * time.Millisecond):
+			}
+		})
+	}
+}
+
+func TestSessionReload(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	dir := filepath.Join(root, "demo")
+	require.NoError(t, os.Mkdir(dir, 0o755))
+	write := func(value string) {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "main.tf"), []byte(`
+data "coder_parameter" "count" {
+  name    = "count"
+  type    = "number"
+  default = `+value+`
+}
+`), 0o600))
+	}
+	write("1")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	logger := slogtest.Make(t, nil)
+
+	// Sessions are reloaded like in 'web --hot-reload'.
+	watcher := NewWatcher(logger, root, 10*time.Millisecond)
+	changes, unsubscribe := watcher.Subscribe("demo")
+	defer unsubscribe()
+	go watcher.Run(ctx)
+
+	s := NewSession(logger, os.DirFS(dir), SessionInputs{}, Options{})
+	go s.handleRequests(ctx)
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-changes:
+				s.Reload(ctx, os.DirFS(dir))
+			}
+		}
+	}()
+
+	receive := func() *Response {
+		t.Helper()
+		select {
+		case resp := <-s.responses:
+			return resp
+		case <-ctx.Done():
+			t.Fatal("no response")
+			return nil
+		}
+	}
+
+	s.sendRequest(ctx, Request{ID: 1, Inputs: map[string]string{}})
+	resp := receive()
+	require.Len(t, resp.Parameters, 1)
+	assert.False(t, resp.Reloaded)
+	assert.Equal(t, "1", resp.Parameters[0].Value.AsString())
+
+	// The watcher must be running before the template changes.
+	time.Sleep(100 * time.Millisecond)
+	write("2")
+
+	// The newest request is previewed again, without a new request.
+	resp = receive()
+	require.Len(t, resp.Parameters, 1)
+	assert.Equal(t, 1, resp.ID)
+	assert.True(t, resp.Reloaded)
+	assert.Equal(t, "2", resp.Parameters[0].Value.AsString())
+}
+
+func TestSessionWorkspaceTags(t *testing.T) {
+	t.Parallel()
+
+	dir := fstest.MapFS{"main.tf": &fstest.MapFile{Data: []byte(`
+data "coder_parameter" "region" {
+  name    = "region"
+  type    = "string"
+  default = "eu"
+}
+
+data "coder_parameter" "zone" {
+  name = "zone"
+  type = "string"
+}
+
+data "coder_workspace_tags" "tags" {
+  tags = {
+    "region" = data.coder_parameter.region.value
+    "zone"   = data.coder_parameter.zone.value
+  }
+}
+`)}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	preview := runSession(ctx, t, NewSession(slogtest.Make(t, nil), dir, SessionInputs{}, Options{}))
+
+	// The zone has no value yet, so its tag cannot be used.
+	resp := preview(Request{ID: 1, Inputs: map[string]string{"region": "us"}})
+	assert.Equal(t, map[string]string{"region": "us"}, resp.WorkspaceTags.Tags)
+	require.Len(t, resp.WorkspaceTags.Unusable, 1)
+	unusable := resp.WorkspaceTags.Unusable[0]
+	assert.Equal(t, "zone", unusable.Key)
+	assert.False(t, unusable.Known)
+	require.Len(t, unusable.Inputs, 1)
+	assert.Equal(t, "zone", unusable.Inputs[0].Name)
+	assert.Empty(t, resp.WorkspaceTags.Diagnostics)
+
+	resp = preview(Request{ID: 2, Inputs: map[string]string{"zone": "a"}})
+	assert.Equal(t, map[string]string{"region": "eu", "zone": "a"}, resp.WorkspaceTags.Tags)
+	assert.Empty(t, resp.WorkspaceTags.Unusable)
+}
+
+func TestSessionWorkspaceTagDiagnostics(t *testing.T) {
+	t.Parallel()
+
+	dir := fstest.MapFS{"main.tf": &fstest.MapFile{Data: []byte(`
+data "coder_parameter" "region" {
+  name    = "region"
+  type    = "string"
+  default = "eu"
+}
+
+data "coder_workspace_tags" "tags" {
+  tags = {
+    "region" = data.coder_parameter.region.value
+    "zones"  = ["a", "b"]
+  }
+}
+`)}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	preview := runSession(ctx, t, NewSession(slogtest.Make(t, nil), dir, SessionInputs{}, Options{}))
+
+	// The tag diagnostics are also response diagnostics.
+	resp := preview(Request{ID: 1})
+	require.Len(t, resp.WorkspaceTags.Diagnostics, 1)
+	assert.Equal(t, "Invalid value type for tag", resp.WorkspaceTags.Diagnostics[0].Summary)
+	assert.Contains(t, resp.Diagnostics, resp.WorkspaceTags.Diagnostics[0])
+	assert.Equal(t, map[string]string{"region": "eu"}, resp.WorkspaceTags.Tags)
+}
+
+func TestSessionUpdate(t *testing.T) {
+	t.Parallel()
+
+	dir := fstest.MapFS{
+		"main.tf": &fstest.MapFile{Data: []byte(`
+data "coder_workspace_owner" "me" {}
+
+data "coder_parameter" "groups" {
+  name    = "groups"
+  type    = "string"
+  default = join(",", data.coder_workspace_owner.me.groups)
+}
+
+data "coder_parameter" "size" {
+  name    = "size"
+  type    = "number"
+  default = 1
+}
+`)},
+		UsersFile: &fstest.MapFile{Data: []byte(`{
+  "alice": {"name": "alice", "groups": ["admins"]},
+  "bob": {"name": "bob", "groups": ["devs", "ops"]}
+}`)},
+	}
+	str := func(s string) *string { return &s }
+	values := func(resp *Response) map[string]string {
+		values := make(map[string]string)
+		for _, p := range resp.Parameters {
+			values[p.Name] = p.Value.AsString()
+		}
+		return values
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	preview := runSession(ctx, t, NewSession(slogtest.Make(t, nil), dir, SessionInputs{}, Options{}))
+
+	resp := preview(Request{ID: 1})
+	assert.Equal(t, map[string]string{"groups": "", "size": "1"}, values(resp))
+
+	// A user name selects the user from the users file.
+	resp = preview(Request{ID: 2, Session: &SessionInputsUpdate{UserName: str("bob")}})
+	assert.Empty(t, resp.Diagnostics)
+	assert.Equal(t, "bob", resp.Session.UserName)
+	assert.Equal(t, map[string]string{"groups": "devs,ops", "size": "1"}, values(resp))
+
+	// Updates apply to later requests as well.
+	resp = preview(Request{ID: 3, Inputs: map[string]string{"size": "2"}})
+	assert.Equal(t, "bob", resp.Session.UserName)
+	assert.Equal(t, map[string]string{"groups": "devs,ops", "size": "2"}, values(resp))
+
+	// A failed update leaves the inputs unchanged.
+	resp = preview(Request{ID: 4, Session: &SessionInputsUpdate{UserName: str("carol")}})
+	require.Len(t, resp.Diagnostics, 1)
+	assert.Equal(t, "Invalid session update", resp.Diagnostics[0].Summary)
+	assert.Contains(t, resp.Diagnostics[0].Detail, `unknown user "carol"`)
+	assert.Equal(t, "bob", resp.Session.UserName)
+	assert.Equal(t, map[string]string{"groups": "devs,ops", "size": "1"}, values(resp))
+
+	// A user replaces the user name.
+	resp = preview(Request{ID: 5, Session: &SessionInputsUpdate{User: &types.WorkspaceOwner{Groups: []string{"qa"}}}})
+	assert.Empty(t, resp.Session.UserName)
+	assert.Equal(t, map[string]string{"groups": "qa", "size": "1"}, values(resp))
+
+	// Previous values apply to the parameters the request has no value for.
+	resp = preview(Request{ID: 6, Session: &SessionInputsUpdate{PreviousValues: map[string]string{"size": "3", "groups": "old"}}})
+	assert.Equal(t, map[string]string{"groups": "old", "size": "3"}, values(resp))
+	resp = preview(Request{ID: 7, Inputs: map[string]string{"size": "4"}})
+	assert.Equal(t, map[string]string{"groups": "old", "size": "4"}, values(resp))
+
+	// An empty object clears them.
+	resp = preview(Request{ID: 8, Session: &SessionInputsUpdate{PreviousValues: map[string]string{}}})
+	assert.Empty(t, resp.Session.PreviousValues)
+	assert.Equal(t, map[string]string{"groups": "qa", "size": "1"}, values(resp))
+}
+
+// runSession runs the preview loop of the session until the context is
+// canceled. It returns a function that sends a request, and waits for its
+// response.
+func runSession(ctx context.Context, t *testing.T, s *Session) func(Request) *Response {
+	go s.handleRequests(ctx)
+	return func(req Request) *Response {
+		t.Helper()
+		s.sendRequest(ctx, req)
+		select {
+		case resp := <-s.responses:
+			return resp
+		case <-ctx.Done():
+			t.Fatal("no response")
+			return nil
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package web
+
+import (
+	"io/fs"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// DefaultMaxUploads is the number of uploaded templates kept when no
+	// limit is given.
+	//
+	// @typescript-ignore DefaultMaxUploads
+	DefaultMaxUploads = 32
+	// DefaultUploadTTL is how long an uploaded template is kept after it was
+	// last used.
+	//
+	// @typescript-ignore DefaultUploadTTL
+	DefaultUploadTTL = time.Hour
+)
+
+// UploadResponse is returned when a template archive is uploaded.
+type UploadResponse struct {
+	// ID identifies the uploaded template in later requests.
+	ID string `json:"id"`
+}
+
+// Uploads holds templates uploaded as archives, so that sessions can be
+// started for them by ID. Uploads expire once they have not been used for
+// the TTL, and the oldest upload is dropped when the limit is reached.
+//
+// @typescript-ignore Uploads
+type Uploads struct {
+	cache *TemplateCache
+	max   int
+	ttl   time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*upload
+}
+
+// @typescript-ignore upload
+type upload struct {
+	tmpl     *CachedTemplate
+	lastUsed time.Time
+}
+
+func NewUploads(cache *TemplateCache, maxUploads int, ttl time.Duration) *Uploads {
+	if maxUploads <= 0 {
+		maxUploads = DefaultMaxUploads
+	}
+	if ttl <= 0 {
+		ttl = DefaultUploadTTL
+	}
+	return &Uploads{
+		cache:   cache,
+		max:     maxUploads,
+		ttl:     ttl,
+		entries: make(map[string]*upload),
+	}
+}
+
+// Add stores the template and returns its ID.
+func (u *Uploads) Add(dir fs.FS) (string, error) {
+	tmpl, err := u.cache.Acquire("", dir)
+	if err != nil {
+		return "", err
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.expire()
+	for len(u.entries) >= u.max {
+		u.removeOldest()
+	}
+
+	id := uuid.NewString()
+	u.entries[id] = &upload{
+		tmpl:     tmpl,
+		lastUsed: time.Now(),
+	}
+	return id, nil
+}
+
+// Acquire returns a reference to the uploaded template. The caller must
+// release it.
+func (u *Uploads) Acquire(id string) (*CachedTemplate, bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.expire()
+	entry, ok := u.entries[id]
+	if !ok {
+		return nil, false
+	}
+	entry.lastUsed = time.Now()
+	return entry.tmpl.Acquire(), true
+}
+
+// expire drops uploads that have not been used within the TTL. The caller
+// must hold u.mu.
+func (u *Uploads) expire() {
+	cutoff := time.Now().Add(-u.ttl)
+	for id, entry := range u.entries {
+		if entry.lastUsed.Before(cutoff) {
+			entry.tmpl.Release()
+			delete(u.entries, id)
+		}
+	}
+}
+
+// removeOldest drops the least recently used upload. The caller must hold
+// u.mu.
+func (u *Uploads) removeOldest() {
+	var (
+		oldestID string
+		oldest   *upload
+	)
+	for id, entry := range u.entries {
+		if oldest == nil || entry.lastUsed.Before(oldest.lastUsed) {
+			oldestID, oldest = id, entry
+		}
+	}
+	if oldest == nil {
+		return
+	}
+	oldest.tmpl.Release()
+	delete(u.entries, oldestID)
+}
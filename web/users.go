@@ -0,0 +1,34 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+
+	"github.com/coder/preview/types"
+)
+
+// UsersFile is an optional file in a template directory that lists the
+// workspace owners a session can preview as, keyed by user name.
+const UsersFile = "users.json"
+
+// AvailableUsers returns the users listed in the template's users file. A
+// template without the file has no users.
+func AvailableUsers(dirFS fs.FS) (map[string]types.WorkspaceOwner, error) {
+	file, err := dirFS.Open(UsersFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		return map[string]types.WorkspaceOwner{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not open users file: %w", err)
+	}
+	defer file.Close()
+
+	var users map[string]types.WorkspaceOwner
+	if err := json.NewDecoder(file).Decode(&users); err != nil {
+		return nil, fmt.Errorf("could not decode users file: %w", err)
+	}
+
+	return users, nil
+}
@@ -0,0 +1,98 @@
+package web
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"cdr.dev/slog"
+
+	"github.com/coder/preview/internal/watch"
+)
+
+// Watcher reports changes to the template directories in a root directory.
+// It uses filesystem notifications where available, and otherwise polls.
+//
+// @typescript-ignore Watcher
+type Watcher struct {
+	logger  slog.Logger
+	watcher *watch.Watcher
+
+	mu   sync.Mutex
+	subs map[string]map[chan struct{}]struct{}
+}
+
+// NewWatcher returns a watcher for the template directories in root. The
+// poll interval is used if filesystem notifications are not available.
+func NewWatcher(logger slog.Logger, root string, poll time.Duration) *Watcher {
+	w := &Watcher{
+		logger: logger,
+		subs:   make(map[string]map[chan struct{}]struct{}),
+	}
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		absRoot = root
+	}
+	w.watcher = watch.New(watch.Options{
+		Dir: root,
+		// Changes are grouped by the template directory they are in.
+		Key: func(path string) (string, bool) {
+			rel, err := filepath.Rel(absRoot, path)
+			if err != nil || rel == "." || !filepath.IsLocal(rel) {
+				return "", false
+			}
+			return strings.SplitN(filepath.ToSlash(rel), "/", 2)[0], true
+		},
+		Changed: w.changed,
+		Poll:    poll,
+		Unavailable: func(err error) {
+			logger.Warn(context.Background(), "filesystem notifications unavailable, polling for changes",
+				slog.Error(err),
+				slog.F("interval", poll),
+			)
+		},
+	})
+	return w
+}
+
+// Subscribe returns a channel that receives a value after the template
+// directory changes. Changes that happen before the value is received are
+// coalesced. The returned function ends the subscription.
+func (w *Watcher) Subscribe(dir string) (<-chan struct{}, func()) {
+	ch := make(chan struct{}, 1)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.subs[dir] == nil {
+		w.subs[dir] = make(map[chan struct{}]struct{})
+	}
+	w.subs[dir][ch] = struct{}{}
+
+	return ch, func() {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		delete(w.subs[dir], ch)
+		if len(w.subs[dir]) == 0 {
+			delete(w.subs, dir)
+		}
+	}
+}
+
+// Run watches the root directory until the context is canceled.
+func (w *Watcher) Run(ctx context.Context) {
+	w.watcher.Run(ctx)
+}
+
+// changed notifies the subscribers of the template directory.
+func (w *Watcher) changed(dir string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for ch := range w.subs[dir] {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
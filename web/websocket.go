@@ -47,12 +47,50 @@ func (s *Session) readLoop(ctx context.Context, cancel func(), conn *websocket.C
 	}
 }
 
+// delta numbers the response, and replaces its result with the delta from
+// the previous response, unless a snapshot is due.
+func (s *Session) delta(ctx context.Context, resp *Response) *Response {
+	s.mu.Lock()
+	snapshot := s.snapshot
+	s.snapshot = false
+	s.mu.Unlock()
+
+	prev := s.sent
+	s.seq++
+	s.sent = &resp.Result
+
+	full := *resp
+	full.Seq = s.seq
+	if prev == nil || snapshot {
+		return &full
+	}
+
+	delta, ok, err := diffResults(*prev, resp.Result)
+	if err != nil {
+		s.logger.Warn(ctx, "failed to compute delta response, sending a snapshot", slog.Error(err))
+	}
+	if !ok {
+		return &full
+	}
+	delta.BaseSeq = s.seq - 1
+	return &Response{
+		ID:       resp.ID,
+		Session:  resp.Session,
+		Reloaded: resp.Reloaded,
+		Seq:      s.seq,
+		Delta:    delta,
+	}
+}
+
 func (s *Session) writeLoop(ctx context.Context, cancel func(), conn *websocket.Conn) {
 	defer cancel()
 
 	for {
 		select {
 		case resp := <-s.responses:
+			if s.opts.DeltaResponses {
+				resp = s.delta(ctx, resp)
+			}
 			err := wsjson.Write(ctx, conn, resp)
 			if err != nil {
 				s.logger.Error(ctx, "failed to write response", slog.F("err", err))
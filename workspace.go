@@ -0,0 +1,44 @@
+package preview
+
+import (
+	"io/fs"
+
+	"github.com/aquasecurity/trivy/pkg/iac/terraform"
+	tfcontext "github.com/aquasecurity/trivy/pkg/iac/terraform/context"
+	"github.com/zclconf/go-cty/cty"
+
+	"github.com/coder/preview/types"
+)
+
+// WorkspaceHook sets the 'coder_workspace' data source to the workspace in
+// the input. If no workspace is given, the data source is left as is, so
+// values from a plan are not overwritten.
+func WorkspaceHook(dfs fs.FS, input Input) (func(ctx *tfcontext.Context, blocks terraform.Blocks, inputVars map[string]cty.Value), error) {
+	ws := input.Workspace
+	if ws == (types.Workspace{}) {
+		return func(ctx *tfcontext.Context, blocks terraform.Blocks, inputVars map[string]cty.Value) {}, nil
+	}
+
+	workspaceValue := cty.ObjectVal(map[string]cty.Value{
+		"id":               cty.StringVal(ws.ID.String()),
+		"name":             cty.StringVal(ws.Name),
+		"access_url":       cty.StringVal(ws.AccessURL),
+		"access_port":      cty.NumberIntVal(int64(ws.AccessPort)),
+		"start_count":      cty.NumberIntVal(int64(ws.StartCount)),
+		"transition":       cty.StringVal(ws.Transition),
+		"is_prebuild":      cty.BoolVal(ws.IsPrebuild),
+		"prebuild_count":   cty.NumberIntVal(int64(ws.PrebuildCount)),
+		"template_id":      cty.StringVal(ws.TemplateID.String()),
+		"template_name":    cty.StringVal(ws.TemplateName),
+		"template_version": cty.StringVal(ws.TemplateVersion),
+	})
+
+	return func(ctx *tfcontext.Context, blocks terraform.Blocks, inputVars map[string]cty.Value) {
+		for _, block := range blocks.OfType("data") {
+			if block.TypeLabel() == "coder_workspace" && block.NameLabel() == "me" {
+				block.Context().Parent().Set(workspaceValue,
+					"data", block.TypeLabel(), block.NameLabel())
+			}
+		}
+	}, nil
+}
@@ -5,6 +5,7 @@ import (
 
 	"github.com/aquasecurity/trivy/pkg/iac/terraform"
 	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
 	"github.com/zclconf/go-cty/cty"
 
 	"github.com/coder/preview/types"
@@ -13,6 +14,7 @@ import (
 func WorkspaceTags(modules terraform.Modules, files map[string]*hcl.File) (types.TagBlocks, hcl.Diagnostics) {
 	diags := make(hcl.Diagnostics, 0)
 	tagBlocks := make(types.TagBlocks, 0)
+	resolver := newInputResolver(modules)
 
 	for _, mod := range modules {
 		blocks := mod.GetDatasByType("coder_workspace_tags")
@@ -62,15 +64,34 @@ func WorkspaceTags(modules terraform.Modules, files map[string]*hcl.File) (types
 			//	continue
 			//}
 
+			// If the tags are written as an object literal, each tag can be
+			// traced back to its own key and value expressions. Otherwise,
+			// every tag depends on the full 'tags' expression.
+			tagsExpr := tagsAttr.HCLAttribute().Expr
+			items := tagItemExpressions(tagsExpr, evCtx)
+			var blockInputs types.TagInputs
+
 			var tags []types.Tag
 			tagsValue.ForEachElement(func(key cty.Value, val cty.Value) (stop bool) {
-				r := tagsAttr.HCLAttribute().Expr.Range()
+				r := tagsExpr.Range()
 				tag, tagDiag := NewTag(&r, files, key, val)
 				if tagDiag != nil {
 					diags = diags.Append(tagDiag)
 					return false
 				}
 
+				if item, ok := items[tag.KeyString()]; ok && key.IsKnown() {
+					tag.Key.ValueExpr = item.KeyExpr
+					tag.Value.ValueExpr = item.ValueExpr
+					tag.Inputs = resolver.Inputs(block, item.KeyExpr, item.ValueExpr)
+				} else {
+					if blockInputs == nil {
+						blockInputs = resolver.Inputs(block, tagsExpr)
+					}
+					tag.Value.ValueExpr = tagsExpr
+					tag.Inputs = blockInputs
+				}
+
 				tags = append(tags, tag)
 
 				return false
@@ -94,6 +115,24 @@ func WorkspaceTags(modules terraform.Modules, files map[string]*hcl.File) (types
 	return tagBlocks, diags
 }
 
+// tagItemExpressions maps the keys of an object literal to its items.
+func tagItemExpressions(expr hcl.Expression, evCtx *hcl.EvalContext) map[string]hclsyntax.ObjectConsItem {
+	items := make(map[string]hclsyntax.ObjectConsItem)
+	obj, ok := expr.(*hclsyntax.ObjectConsExpr)
+	if !ok {
+		return items
+	}
+
+	for _, item := range obj.Items {
+		key, kdiags := item.KeyExpr.Value(evCtx)
+		if kdiags.HasErrors() || !key.IsKnown() || key.IsNull() || !key.Type().Equals(cty.String) {
+			continue
+		}
+		items[key.AsString()] = item
+	}
+	return items
+}
+
 // NewTag creates a workspace tag from its hcl expression.
 func NewTag(srcRange *hcl.Range, files map[string]*hcl.File, key, val cty.Value) (types.Tag, *hcl.Diagnostic) {
 	//key, kdiags := expr.KeyExpr.Value(evCtx)